@@ -7,6 +7,7 @@ import (
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"syscall"
 	"time"
 
@@ -14,23 +15,45 @@ import (
 	"github.com/haisum/smpp-app/pkg/db"
 	campaignmodel "github.com/haisum/smpp-app/pkg/db/models/campaign"
 	filemodel "github.com/haisum/smpp-app/pkg/db/models/campaign/file"
+	configmodel "github.com/haisum/smpp-app/pkg/db/models/config"
+	creditmodel "github.com/haisum/smpp-app/pkg/db/models/credit"
+	inboundmodel "github.com/haisum/smpp-app/pkg/db/models/inbound"
 	msgmodel "github.com/haisum/smpp-app/pkg/db/models/message"
+	optoutmodel "github.com/haisum/smpp-app/pkg/db/models/optout"
+	sendermodel "github.com/haisum/smpp-app/pkg/db/models/sender"
+	templatemodel "github.com/haisum/smpp-app/pkg/db/models/template"
+	throttlemodel "github.com/haisum/smpp-app/pkg/db/models/throttle"
 	usermodel "github.com/haisum/smpp-app/pkg/db/models/user"
+	webhookmodel "github.com/haisum/smpp-app/pkg/db/models/webhook"
+	"github.com/haisum/smpp-app/pkg/dispatcher"
 	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
 	"github.com/haisum/smpp-app/pkg/errs"
 	"github.com/haisum/smpp-app/pkg/excel"
+	"github.com/haisum/smpp-app/pkg/generator"
 	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/receiver"
 	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/scheduler"
 	"github.com/haisum/smpp-app/pkg/services/campaign"
 	filesvc "github.com/haisum/smpp-app/pkg/services/campaign/file"
+	configsvc "github.com/haisum/smpp-app/pkg/services/config"
+	inboxsvc "github.com/haisum/smpp-app/pkg/services/inbox"
 	"github.com/haisum/smpp-app/pkg/services/message"
+	optoutsvc "github.com/haisum/smpp-app/pkg/services/optout"
+	sendersvc "github.com/haisum/smpp-app/pkg/services/sender"
+	templatesvc "github.com/haisum/smpp-app/pkg/services/template"
 	"github.com/haisum/smpp-app/pkg/services/user"
 	"github.com/haisum/smpp-app/pkg/services/users"
+	webhooksvc "github.com/haisum/smpp-app/pkg/services/webhook"
+	"github.com/haisum/smpp-app/pkg/smsc/fake"
 	"github.com/haisum/smpp-app/pkg/stringutils"
+	"github.com/haisum/smpp-app/pkg/webhook"
 )
 
 const (
 	defaultPort = "8080"
+	// defaultMaxRetries is number of times a failed message can be retried
+	defaultMaxRetries = 3
 )
 
 func main() {
@@ -38,43 +61,78 @@ func main() {
 		addr = envString("PORT", defaultPort)
 
 		httpAddr        = flag.String("http.addr", ":"+addr, "HTTP listen address")
+		mode            = flag.String("mode", "http", "mode to run in: http, dispatcher or smsc")
+		smscAddr        = flag.String("smsc.addr", ":2775", "fake SMSC listen address, used in smsc mode")
+		smscErrorRate   = flag.Float64("smsc.errorRate", 0, "fraction of submit_sm fake SMSC should fail, used in smsc mode")
+		smscDelay       = flag.Duration("smsc.deliveryDelay", time.Second, "delay before fake SMSC sends delivery receipts, used in smsc mode")
+		smscStat        = flag.String("smsc.deliveryStat", "DELIVRD", "stat fake SMSC reports in delivery receipts, used in smsc mode")
 		ctx             = context.Background()
 		userSvc         user.Service
 		usersSvc        users.Service
 		msgSvc          message.Service
 		campaignSvc     campaign.Service
 		campaignFileSvc filesvc.Service
+		configSvc       configsvc.Service
+		templateSvc     templatesvc.Service
+		optOutSvc       optoutsvc.Service
+		inboxSvc        inboxsvc.Service
+		webhookSvc      webhooksvc.Service
+		senderSvc       sendersvc.Service
 	)
 	flag.Parse()
 
 	log := logger.Get()
 	httpLogger := log.(logger.WithLogger).With(log, "", "component", "http")
+	if *mode == "smsc" {
+		runFakeSMSC(log, *smscAddr, *smscErrorRate, *smscDelay, *smscStat)
+		return
+	}
 	db := getDB(ctx, log)
+	if *mode == "dispatcher" {
+		runDispatcher(ctx, log, db)
+		return
+	}
 	userStore := usermodel.NewStore(db, log, stringutils.Hash)
-	authenticator := usermodel.NewAuthenticator(userStore.Get, stringutils.HashMatch)
+	tokenStore := usermodel.NewTokenStore(db)
+	authenticator := usermodel.NewAuthenticator(userStore.Get, stringutils.HashMatch, tokenStore)
 	msgStore := msgmodel.NewStore(db, log)
 	fileStore := filemodel.NewStore(db)
 	fileOpener := file.NewOpener(envString("FILES_PATH", file.DefaultPath))
 	campaignStore := campaignmodel.NewStore(db, fileStore, log)
+	configStore := configmodel.NewStore(db)
+	templateStore := templatemodel.NewStore(db)
+	optOutStore := optoutmodel.NewStore(db)
+	inboundStore := inboundmodel.NewStore(db)
+	creditStore := creditmodel.NewStore(db)
+	senderStore := sendermodel.NewStore(db)
 	// user service is used for logged in user to change/access their information
 	{
 		userLogger := httpLogger.With("service", "user")
-		userSvc = user.NewService(userLogger, userStore, authenticator)
+		userSvc = user.NewService(userLogger, userStore, tokenStore, creditStore, authenticator)
 	}
 	// users service is used by privileged users to edit/add or access all the system users
 	{
 		usersLogger := httpLogger.With("service", "users")
-		usersSvc = users.NewService(usersLogger, userStore, authenticator)
+		usersSvc = users.NewService(usersLogger, userStore, tokenStore, creditStore, authenticator)
 	}
 	// message service is used to get reports about sent messages and sending single messages
 	{
 		messageLogger := httpLogger.With("service", "message")
-		msgSvc = message.NewService(messageLogger, msgStore, excel.ExportMessages, authenticator)
+		msgSvc = message.NewService(messageLogger, msgStore, templateStore, configStore, optOutStore, creditStore, senderStore, excel.ExportMessages, authenticator)
 	}
 	// campaign service is used to get reports about campaigns in progress, stop campaigns and starting new campaigns
 	{
 		campaignLogger := httpLogger.With("service", "campaign")
-		campaignSvc = campaign.NewService(campaignLogger, campaignStore, msgStore, fileStore, fileOpener, excel.ToNumbers, authenticator)
+		maxRetries, err := strconv.Atoi(envString("MAX_RETRIES", strconv.Itoa(defaultMaxRetries)))
+		if err != nil {
+			log.Error("error", err, "msg", "invalid MAX_RETRIES, using default", "default", defaultMaxRetries)
+			maxRetries = defaultMaxRetries
+		}
+		jobStore := campaignmodel.NewJobStore(db)
+		gen := generator.New(jobStore, campaignStore, msgStore, optOutStore, creditStore, fileStore, fileOpener, excel.ToNumbers, campaignLogger.With("component", "generator"))
+		// resume campaigns whose messages weren't all generated before last shutdown
+		go gen.Run(ctx)
+		campaignSvc = campaign.NewService(campaignLogger, campaignStore, msgStore, fileStore, templateStore, configStore, creditStore, senderStore, jobStore, gen, fileOpener, excel.ToNumbers, authenticator, maxRetries)
 	}
 	// campaign file service is used to upload, download and manage campaign files
 	{
@@ -82,7 +140,37 @@ func main() {
 		randFunc := func() string {
 			return stringutils.SecureRandomAlphaString(4) + time.Now().Format(".2006.01.02.15.04.05")
 		}
-		campaignFileSvc = filesvc.NewService(campaignFileLogger, fileStore, fileOpener, excel.ToNumbers, randFunc, authenticator)
+		campaignFileSvc = filesvc.NewService(campaignFileLogger, fileStore, configStore, fileOpener, excel.ToNumbers, randFunc, authenticator)
+	}
+	// config service is used by privileged users to see and edit connection groups and connections and see their throughput
+	{
+		configLogger := httpLogger.With("service", "config")
+		configSvc = configsvc.NewService(configLogger, configStore, throttlemodel.NewStore(db), authenticator)
+	}
+	// template service is used to manage message templates which can be used in campaigns and single messages
+	{
+		templateLogger := httpLogger.With("service", "template")
+		templateSvc = templatesvc.NewService(templateLogger, templateStore, authenticator)
+	}
+	// opt out service is used to manage numbers which don't want to receive messages of a user or of everyone
+	{
+		optOutLogger := httpLogger.With("service", "optout")
+		optOutSvc = optoutsvc.NewService(optOutLogger, optOutStore, configStore, excel.ToNumbers, authenticator)
+	}
+	// inbox service lists messages received from mobile numbers on short codes and long numbers of users
+	{
+		inboxLogger := httpLogger.With("service", "inbox")
+		inboxSvc = inboxsvc.NewService(inboxLogger, inboundStore, authenticator)
+	}
+	// webhook service is used to register urls which are called when messages of a user are sent, delivered or received
+	{
+		webhookLogger := httpLogger.With("service", "webhook")
+		webhookSvc = webhooksvc.NewService(webhookLogger, webhookmodel.NewStore(db), webhookmodel.NewOutboxStore(db), authenticator)
+	}
+	// sender service is used to request sender ids and by privileged users to approve or reject them
+	{
+		senderLogger := httpLogger.With("service", "sender")
+		senderSvc = sendersvc.NewService(senderLogger, senderStore, authenticator)
 	}
 
 	mux := http.NewServeMux()
@@ -98,6 +186,12 @@ func main() {
 	mux.Handle("/message/v1/", message.MakeHandler(msgSvc, opts, respEncoder.EncodeSuccess))
 	mux.Handle("/campaign/v1/", campaign.MakeHandler(campaignSvc, opts, respEncoder.EncodeSuccess))
 	mux.Handle("/file/v1/", filesvc.MakeHandler(campaignFileSvc, opts, respEncoder.EncodeSuccess))
+	mux.Handle("/config/v1/", configsvc.MakeHandler(configSvc, opts, respEncoder.EncodeSuccess))
+	mux.Handle("/template/v1/", templatesvc.MakeHandler(templateSvc, opts, respEncoder.EncodeSuccess))
+	mux.Handle("/optout/v1/", optoutsvc.MakeHandler(optOutSvc, opts, respEncoder.EncodeSuccess))
+	mux.Handle("/inbox/v1/", inboxsvc.MakeHandler(inboxSvc, opts, respEncoder.EncodeSuccess))
+	mux.Handle("/webhook/v1/", webhooksvc.MakeHandler(webhookSvc, opts, respEncoder.EncodeSuccess))
+	mux.Handle("/sender/v1/", sendersvc.MakeHandler(senderSvc, opts, respEncoder.EncodeSuccess))
 	http.Handle("/", accessControl(mux))
 
 	errs := make(chan error, 2)
@@ -115,6 +209,50 @@ func main() {
 
 }
 
+// runDispatcher queues scheduled messages, sends queued messages to SMSCs and posts webhook deliveries until interrupted
+func runDispatcher(ctx context.Context, log logger.Logger, db *db.DB) {
+	dispatcherLogger := log.(logger.WithLogger).With("component", "dispatcher")
+	ctx, cancel := context.WithCancel(ctx)
+	go func() {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+		dispatcherLogger.Info("msg", "stopping", "signal", <-c)
+		cancel()
+	}()
+	msgStore := msgmodel.NewStore(db, log)
+	webhookStore := webhookmodel.NewStore(db)
+	outboxStore := webhookmodel.NewOutboxStore(db)
+	webhookLogger := log.(logger.WithLogger).With("component", "webhook")
+	notifier := webhook.NewNotifier(webhookStore, outboxStore, webhookLogger)
+	go webhook.NewSender(webhookStore, outboxStore, webhookLogger).Run(ctx)
+	recv := receiver.New(msgStore, inboundmodel.NewStore(db), usermodel.NewStore(db, log, stringutils.Hash), notifier, log.(logger.WithLogger).With("component", "receiver"))
+	go recv.Run(ctx)
+	sched := scheduler.New(msgStore, log.(logger.WithLogger).With("component", "scheduler"))
+	go sched.Run(ctx)
+	d := dispatcher.New(msgStore, configmodel.NewStore(db), throttlemodel.NewStore(db), creditmodel.NewStore(db), notifier, dispatcher.NewBinder(recv.Handler), dispatcherLogger)
+	dispatcherLogger.Info("msg", "dispatching")
+	d.Run(ctx)
+}
+
+// runFakeSMSC runs an in process SMSC until interrupted, for demos and testing dispatcher without a carrier
+func runFakeSMSC(log logger.Logger, addr string, errorRate float64, delay time.Duration, stat string) {
+	smscLogger := log.(logger.WithLogger).With("component", "smsc")
+	smsc := fake.New()
+	smsc.ErrorRate = errorRate
+	smsc.DeliveryDelay = delay
+	smsc.DeliveryStat = stat
+	smsc.Log = smscLogger
+	if err := smsc.Start(addr); err != nil {
+		smscLogger.Error("error", err, "msg", "couldn't start fake smsc")
+		return
+	}
+	smscLogger.Info("msg", "listening", "address", smsc.Addr())
+	c := make(chan os.Signal, 1)
+	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
+	smscLogger.Info("msg", "stopping", "signal", <-c, "received", len(smsc.Received()))
+	smsc.Close()
+}
+
 func envString(env, fallback string) string {
 	e := os.Getenv(env)
 	if e == "" {
@@ -137,7 +275,7 @@ func accessControl(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
 		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type")
+		w.Header().Set("Access-Control-Allow-Headers", "Origin, Content-Type, Authorization")
 
 		if r.Method == "OPTIONS" {
 			return
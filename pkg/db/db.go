@@ -3,6 +3,7 @@ package db
 import (
 	"database/sql"
 	"fmt"
+	"os"
 	"testing"
 
 	"context"
@@ -95,3 +96,33 @@ func ConnectMockContext(ctx context.Context, t *testing.T) (*DB, sqlmock.Sqlmock
 	}
 	return db, mock, err
 }
+
+// ConnectTest connects to MySQL database given by SMPP_TEST_MYSQL_DSN, e.g. root:str0ng@tcp(localhost:3306)/hsmppdb,
+// and creates its tables if they don't exist. Test is skipped if it isn't set.
+func ConnectTest(t *testing.T) *DB {
+	dsn := os.Getenv("SMPP_TEST_MYSQL_DSN")
+	if dsn == "" {
+		t.Skip("SMPP_TEST_MYSQL_DSN isn't set")
+	}
+	config, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.MultiStatements = true
+	con, err := sql.Open("mysql", config.FormatDSN())
+	if err == nil {
+		err = con.Ping()
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	db := &DB{
+		Ctx:      context.Background(),
+		Database: goqu.New("mysql", con),
+		Logger:   logger.Get(),
+	}
+	if _, err := CheckAndCreateDB(db); err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
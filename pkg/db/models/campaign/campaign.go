@@ -8,6 +8,7 @@ import (
 	"github.com/haisum/smpp-app/pkg/db"
 	"github.com/haisum/smpp-app/pkg/entities/campaign"
 	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
+	"github.com/haisum/smpp-app/pkg/entities/message"
 	"github.com/haisum/smpp-app/pkg/logger"
 	"github.com/pkg/errors"
 	"gopkg.in/doug-martin/goqu.v3"
@@ -46,17 +47,27 @@ func (st *store) Save(c *campaign.Campaign) (int64, error) {
 	return resp.LastInsertId()
 }
 
+// Delete removes a campaign from db
+func (st *store) Delete(ID int64) error {
+	_, err := st.db.From("Campaign").Where(goqu.I("ID").Eq(ID)).Delete().Exec()
+	return err
+}
+
 // Progress returns count for a campaign in progress
 func (st *store) Progress(ID int64) (campaign.Progress, error) {
 	cp := campaign.Progress{
 		"Total":        0,
 		"Queued":       0,
+		"Sending":      0,
 		"Delivered":    0,
 		"NotDelivered": 0,
 		"Sent":         0,
 		"Error":        0,
 		"Scheduled":    0,
 		"Stopped":      0,
+		"Paused":       0,
+		"Held":         0,
+		"Suppressed":   0,
 		"Pending":      0,
 	}
 	var vals []struct {
@@ -106,6 +117,9 @@ func (st *store) Report(ID int64) (campaign.Report, error) {
 	// Select connection wise
 	err = ds.Select(goqu.L("Connection as name, count(*) as count")).GroupBy("Connection").ScanStructs(&cr.Connections)
 	errs = appendNotNil(errs, errors.WithMessage(err, "connection query"))
+	// count paused messages
+	_, err = ds.Select(goqu.L("count(*) as Paused")).Where(goqu.I("Status").Eq(message.Paused)).ScanVal(&cr.Paused)
+	errs = appendNotNil(errs, errors.WithMessage(err, "paused query"))
 	if len(errs) > 0 {
 		err = errors.New(strings.Join(errs, "\n"))
 		return cr, err
@@ -109,18 +109,29 @@ func (s *store) List(c *file.Criteria) ([]file.File, error) {
 // Generally io.ReadCloser should be uploaded file's pointer
 // io.Writer should be instance of file.opener
 // processExcelFunc is pkg/excel.ToNumbers
+// countryCode is default country code of numbers in national format
 // in testing, you may implement your own interfaces
-func (s *store) Save(f *file.File, processExcelFunc file.ProcessExcelFunc, reader io.ReadCloser, writer io.WriteCloser) (int64, error) {
+func (s *store) Save(f *file.File, processExcelFunc file.ProcessExcelFunc, countryCode string, reader io.ReadCloser, writer io.WriteCloser) (int64, error) {
 	fileType := file.Type(filepath.Ext(strings.ToLower(f.Name)))
 	if fileType != file.CSV && fileType != file.TXT && fileType != file.XLSX {
 		return 0, fmt.Errorf("only csv, txt and xlsx extensions are allowed; given file %s has extension %s", f.Name, fileType)
 	}
 	f.Type = fileType
-	_, err := file.ToNumbers(f, processExcelFunc, reader)
 	defer reader.Close()
+	rows, err := file.NewRows(f, processExcelFunc, reader, countryCode)
 	if err != nil {
 		return 0, err
 	}
+	// every row is read to validate file, only hashes of numbers are kept in memory
+	if err = file.Each(rows, func(r file.Row) error { return nil }); err != nil {
+		return 0, err
+	}
+	// uploaded files can seek, file is written from its start after validation
+	if seeker, ok := reader.(io.Seeker); ok {
+		if _, err = seeker.Seek(0, io.SeekStart); err != nil {
+			return 0, errors.Wrap(err, "couldn't read file again")
+		}
+	}
 	_, err = io.Copy(writer, reader)
 	defer writer.Close()
 	if err != nil {
@@ -0,0 +1,77 @@
+package campaign
+
+import (
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/campaign"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+type jobStore struct {
+	db *db.DB
+}
+
+// NewJobStore returns a campaign job store
+func NewJobStore(db *db.DB) *jobStore {
+	return &jobStore{db}
+}
+
+// Add saves a new job
+func (js *jobStore) Add(j *campaign.Job) (int64, error) {
+	resp, err := js.db.From("CampaignJob").Insert(j).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return resp.LastInsertId()
+}
+
+// Update saves job if its version hasn't changed since it was read and increments version
+func (js *jobStore) Update(j *campaign.Job) (bool, error) {
+	params, err := j.Params.Value()
+	if err != nil {
+		return false, err
+	}
+	res, err := js.db.From("CampaignJob").Where(
+		goqu.I("ID").Eq(j.ID),
+		goqu.I("Version").Eq(j.Version),
+	).Update(goqu.Record{
+		"Status":     j.Status,
+		"Checkpoint": j.Checkpoint,
+		"Total":      j.Total,
+		"Params":     params,
+		"Error":      j.Error,
+		"Version":    j.Version + 1,
+		"UpdatedAt":  j.UpdatedAt,
+	}).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	j.Version++
+	return true, nil
+}
+
+// Pause sets Paused of job of a campaign, Version isn't changed
+func (js *jobStore) Pause(campaignID int64, paused bool) error {
+	_, err := js.db.From("CampaignJob").Where(goqu.I("CampaignID").Eq(campaignID)).Update(goqu.Record{"Paused": paused}).Exec()
+	return err
+}
+
+// List filters jobs based on criteria
+func (js *jobStore) List(c *campaign.JobCriteria) ([]campaign.Job, error) {
+	var jobs []campaign.Job
+	query := js.db.From("CampaignJob")
+	if c.CampaignID != 0 {
+		query = query.Where(goqu.I("CampaignID").Eq(c.CampaignID))
+	}
+	if len(c.Statuses) > 0 {
+		query = query.Where(goqu.I("Status").In(c.Statuses))
+	}
+	if c.UpdatedBefore != 0 {
+		query = query.Where(goqu.I("UpdatedAt").Lt(c.UpdatedBefore))
+	}
+	err := query.Order(goqu.I("ID").Asc()).ScanStructs(&jobs)
+	return jobs, err
+}
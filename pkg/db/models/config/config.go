@@ -0,0 +1,54 @@
+package config
+
+import (
+	"encoding/json"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/pkg/errors"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+const (
+	// settingName is Name of row in settings table which holds config
+	settingName = "config"
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a config store backed by settings table
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Get reads config from settings table
+func (s *store) Get() (*config.Config, error) {
+	var value string
+	found, err := s.db.From("settings").Select("Value").Where(goqu.I("Name").Eq(settingName)).ScanVal(&value)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read config")
+	}
+	if !found {
+		return nil, errors.New("config not found in settings")
+	}
+	c := &config.Config{}
+	if err := json.Unmarshal([]byte(value), c); err != nil {
+		return nil, errors.Wrap(err, "couldn't parse config")
+	}
+	return c, nil
+}
+
+// Save replaces config in settings table
+func (s *store) Save(c *config.Config) error {
+	b, err := json.Marshal(c)
+	if err != nil {
+		return errors.Wrap(err, "couldn't marshal config")
+	}
+	_, err = s.db.From("settings").Where(goqu.I("Name").Eq(settingName)).Update(goqu.Record{"Value": string(b)}).Exec()
+	if err != nil {
+		return errors.Wrap(err, "couldn't save config")
+	}
+	return nil
+}
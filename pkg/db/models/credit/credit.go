@@ -0,0 +1,130 @@
+package credit
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a new credit ledger store
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Balance returns credits left with username
+func (s *store) Balance(username string) (int64, error) {
+	var balance int64
+	_, err := s.db.From("Credit").Select("Balance").Where(goqu.I("Username").Eq(username)).ScanVal(&balance)
+	return balance, err
+}
+
+// Add changes balance and records entry in a transaction. Balance is changed with a single conditional UPDATE, so
+// concurrent debits can't take it below zero. Row of user stays locked until entry is saved, so Balance of entries
+// of a user is always in order of their IDs.
+func (s *store) Add(e *credit.Entry) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	return tx.Wrap(func() error {
+		// row of a user is created on first change of balance
+		if _, err := tx.From("Credit").InsertIgnore(goqu.Record{"Username": e.Username, "Balance": 0}).Exec(); err != nil {
+			return err
+		}
+		res, err := tx.From("Credit").Where(
+			goqu.I("Username").Eq(e.Username),
+			goqu.L("`Balance` + ? >= 0", e.Amount),
+		).Update(goqu.Record{"Balance": goqu.L("`Balance` + ?", e.Amount)}).Exec()
+		if err != nil {
+			return err
+		}
+		if n, err := res.RowsAffected(); err != nil || n == 0 {
+			if err == nil {
+				err = credit.ErrInsufficientBalance
+			}
+			return err
+		}
+		if _, err := tx.From("Credit").Select("Balance").Where(goqu.I("Username").Eq(e.Username)).ScanVal(&e.Balance); err != nil {
+			return err
+		}
+		res, err = tx.From("Ledger").Insert(e).Exec()
+		if err != nil {
+			return err
+		}
+		e.ID, err = res.LastInsertId()
+		return err
+	})
+}
+
+// Ledger filters ledger entries based on criteria
+func (s *store) Ledger(c *credit.Criteria) ([]credit.Entry, error) {
+	var entries []credit.Entry
+	query := s.db.From("Ledger")
+	if c.ID != 0 {
+		query = query.Where(goqu.I("ID").Eq(c.ID))
+	}
+	if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	if c.Kind != "" {
+		query = query.Where(goqu.I("Kind").Eq(c.Kind))
+	}
+	if c.MessageID != 0 {
+		query = query.Where(goqu.I("MessageID").Eq(c.MessageID))
+	}
+	if c.CampaignID != 0 {
+		query = query.Where(goqu.I("CampaignID").Eq(c.CampaignID))
+	}
+	if c.CreatedAfter != 0 {
+		query = query.Where(goqu.I("CreatedAt").Gte(c.CreatedAfter))
+	}
+	if c.CreatedBefore != 0 {
+		query = query.Where(goqu.I("CreatedAt").Lte(c.CreatedBefore))
+	}
+	if c.OrderByKey == "" {
+		c.OrderByKey = "ID"
+	}
+	var from interface{}
+	if c.From != "" {
+		switch c.OrderByKey {
+		case "ID", "CreatedAt", "Amount", "Balance", "MessageID", "CampaignID":
+			var err error
+			from, err = strconv.ParseInt(c.From, 10, 64)
+			if err != nil {
+				return entries, fmt.Errorf("invalid value for from: %s", c.From)
+			}
+		default:
+			from = c.From
+		}
+	}
+	orderDir := "DESC"
+	if strings.ToUpper(c.OrderByDir) == "ASC" {
+		orderDir = "ASC"
+	}
+	if from != nil {
+		if orderDir == "ASC" {
+			query = query.Where(goqu.I(c.OrderByKey).Gt(from))
+		} else {
+			query = query.Where(goqu.I(c.OrderByKey).Lt(from))
+		}
+	}
+	orderExp := goqu.I(c.OrderByKey).Desc()
+	if orderDir == "ASC" {
+		orderExp = goqu.I(c.OrderByKey).Asc()
+	}
+	query = query.Order(orderExp)
+	if c.PerPage == 0 {
+		c.PerPage = 100
+	}
+	query = query.Limit(c.PerPage)
+	err := query.ScanStructs(&entries)
+	return entries, err
+}
@@ -0,0 +1,65 @@
+package credit
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
+	"gopkg.in/doug-martin/goqu.v3"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestStore_AddConcurrentDebits(t *testing.T) {
+	assert := assert.New(t)
+	d := db.ConnectTest(t)
+	s := NewStore(d)
+	username := fmt.Sprintf("credittest%d", time.Now().UnixNano())
+	defer func() {
+		d.From("Ledger").Where(goqu.I("Username").Eq(username)).Delete().Exec()
+		d.From("Credit").Where(goqu.I("Username").Eq(username)).Delete().Exec()
+	}()
+	if err := s.Add(&credit.Entry{Username: username, Kind: credit.TopUp, Amount: 10}); err != nil {
+		t.Fatal(err)
+	}
+
+	var (
+		wg                    sync.WaitGroup
+		mu                    sync.Mutex
+		debited, insufficient int
+	)
+	for i := 0; i < 25; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.Add(&credit.Entry{Username: username, Kind: credit.Debit, Amount: -1})
+			mu.Lock()
+			defer mu.Unlock()
+			switch err {
+			case nil:
+				debited++
+			case credit.ErrInsufficientBalance:
+				insufficient++
+			default:
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(10, debited)
+	assert.Equal(15, insufficient)
+	balance, err := s.Balance(username)
+	assert.Nil(err)
+	assert.Equal(int64(0), balance)
+
+	// balance of entries is running balance in order of their IDs
+	entries, err := s.Ledger(&credit.Criteria{Username: username, OrderByKey: "ID", OrderByDir: "ASC", PerPage: 100})
+	assert.Nil(err)
+	if assert.Len(entries, 11) {
+		for i, e := range entries {
+			assert.Equal(int64(10-i), e.Balance)
+		}
+	}
+}
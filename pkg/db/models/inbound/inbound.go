@@ -0,0 +1,101 @@
+package inbound
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/inbound"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+const (
+	receivedAt            = "ReceivedAt"
+	defaultPerPageListing = 100
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a new inbound message store
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Save saves a received message in Inbound table
+func (s *store) Save(m *inbound.Message) (int64, error) {
+	resp, err := s.db.From("Inbound").Insert(m).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return resp.LastInsertId()
+}
+
+// List filters received messages based on criteria
+func (s *store) List(c *inbound.Criteria) ([]inbound.Message, error) {
+	var m []inbound.Message
+	query := s.db.From("Inbound")
+	if c.ID != 0 {
+		query = query.Where(goqu.I("ID").Eq(c.ID))
+	}
+	if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	if c.Src != "" {
+		query = query.Where(goqu.I("Src").Eq(c.Src))
+	}
+	if c.Dst != "" {
+		query = query.Where(goqu.I("Dst").Eq(c.Dst))
+	}
+	if c.Enc != "" {
+		query = query.Where(goqu.I("Enc").Eq(c.Enc))
+	}
+	if c.Connection != "" {
+		query = query.Where(goqu.I("Connection").Eq(c.Connection))
+	}
+	if c.ReceivedAfter != 0 {
+		query = query.Where(goqu.I(receivedAt).Gte(c.ReceivedAfter))
+	}
+	if c.ReceivedBefore != 0 {
+		query = query.Where(goqu.I(receivedAt).Lte(c.ReceivedBefore))
+	}
+	if c.OrderByKey == "" {
+		c.OrderByKey = receivedAt
+	}
+	var from interface{}
+	if c.From != "" {
+		if c.OrderByKey == receivedAt || c.OrderByKey == "ID" {
+			var err error
+			from, err = strconv.ParseInt(c.From, 10, 64)
+			if err != nil {
+				return m, fmt.Errorf("invalid value for from: %s", c.From)
+			}
+		} else {
+			from = c.From
+		}
+	}
+	orderDir := "DESC"
+	if strings.ToUpper(c.OrderByDir) == "ASC" {
+		orderDir = "ASC"
+	}
+	if from != nil {
+		if orderDir == "ASC" {
+			query = query.Where(goqu.I(c.OrderByKey).Gt(from))
+		} else {
+			query = query.Where(goqu.I(c.OrderByKey).Lt(from))
+		}
+	}
+	orderExp := goqu.I(c.OrderByKey).Desc()
+	if orderDir == "ASC" {
+		orderExp = goqu.I(c.OrderByKey).Asc()
+	}
+	query = query.Order(orderExp)
+	if c.PerPage == 0 {
+		c.PerPage = defaultPerPageListing
+	}
+	query = query.Limit(c.PerPage)
+	err := query.ScanStructs(&m)
+	return m, err
+}
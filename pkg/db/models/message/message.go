@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/haisum/smpp-app/pkg/db"
 	"github.com/haisum/smpp-app/pkg/entities/message"
@@ -28,8 +29,9 @@ func (dsm *deliverySM) Scan(src interface{}) error {
 }
 
 // Value implements the driver.Valuer interface
-func (dsm *deliverySM) Value() (driver.Value, error) {
-	return json.Marshal(dsm)
+func (dsm deliverySM) Value() (driver.Value, error) {
+	b, err := json.Marshal(dsm)
+	return string(b), err
 }
 
 const (
@@ -120,6 +122,17 @@ func (store *store) Update(m *message.Message) error {
 	return err
 }
 
+// UpdateFrom updates an existing message in Message table if its status is still from. Status of m must differ from
+// from, otherwise an unchanged row isn't counted as updated.
+func (store *store) UpdateFrom(m *message.Message, from message.Status) (bool, error) {
+	res, err := store.db.From("Message").Where(goqu.I("id").Eq(m.ID), goqu.I("Status").Eq(from)).Update(m).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
 // List filters messages based on criteria
 func (store *store) List(c *message.Criteria) ([]message.Message, error) {
 	var m []message.Message
@@ -168,7 +181,7 @@ func (store *store) Stats(c *message.Criteria) (*message.Stats, error) {
 		}
 	}
 	ds := store.prepareQuery(c, from)
-	ds = ds.GroupBy("Status").Select(goqu.L("status, count(*) as total"))
+	ds = ds.GroupBy("Status").Select(goqu.L("status, count(*) as total, coalesce(sum(Total), 0) as segments"))
 	stats := make(map[string]int64, 8)
 	query, args, err := ds.ToSql()
 	if err != nil {
@@ -180,11 +193,13 @@ func (store *store) Stats(c *message.Criteria) (*message.Stats, error) {
 	}
 	for rows.Next() {
 		var (
-			status string
-			total  int64
+			status   string
+			total    int64
+			segments int64
 		)
-		rows.Scan(&status, &total)
+		rows.Scan(&status, &total, &segments)
 		stats[status] = total
+		m.Segments += segments
 	}
 	rows.Close()
 	for k, v := range stats {
@@ -193,6 +208,8 @@ func (store *store) Stats(c *message.Criteria) (*message.Stats, error) {
 			m.Delivered = v
 		case message.Error:
 			m.Error = v
+		case message.Sending:
+			m.Sending = v
 		case message.Sent:
 			m.Sent = v
 		case message.Queued:
@@ -203,9 +220,28 @@ func (store *store) Stats(c *message.Criteria) (*message.Stats, error) {
 			m.Scheduled = v
 		case message.Stopped:
 			m.Stopped = v
+		case message.Paused:
+			m.Paused = v
+		case message.Held:
+			m.Held = v
+		case message.Suppressed:
+			m.Suppressed = v
 		}
 	}
-	m.Total = m.Delivered + m.Error + m.Sent + m.Queued + m.NotDelivered + m.Scheduled + m.Stopped
+	if m.Scheduled > 0 {
+		due := c.ScheduledBefore
+		if due == 0 || due > time.Now().UTC().Unix() {
+			due = time.Now().UTC().Unix()
+		}
+		cs := *c
+		cs.Status = message.Scheduled
+		cs.ScheduledBefore = due
+		m.ScheduledDue, err = store.prepareQuery(&cs, from).Count()
+		if err != nil {
+			return m, errors.Wrap(err, "couldn't count due scheduled messages")
+		}
+	}
+	m.Total = m.Delivered + m.Error + m.Sent + m.Sending + m.Queued + m.NotDelivered + m.Scheduled + m.Stopped + m.Paused + m.Held + m.Suppressed
 	return m, err
 }
 
@@ -305,63 +341,212 @@ func (store *store) prepareQuery(c *message.Criteria, from interface{}) *goqu.Da
 	return t
 }
 
-// StopPending marks stopped as true in all messages which are queued or scheduled in a campaign
-func (store *store) StopPending(campID int64) (int64, error) {
+// StopPending marks stopped as true in all messages which are queued, scheduled, held or paused in a campaign.
+// Segments of messages are summed in same transaction with their rows locked, so they're exactly segments of
+// stopped messages. Messages dispatcher has claimed are Sending, they aren't stopped and their segments aren't counted.
+func (store *store) StopPending(campID int64) (int64, int64, error) {
+	where := []goqu.Expression{
+		goqu.I("CampaignID").Eq(campID),
+		goqu.Or(
+			goqu.I("Status").Eq(message.Queued),
+			goqu.I("Status").Eq(message.Scheduled),
+			goqu.I("Status").Eq(message.Held),
+			goqu.I("Status").Eq(message.Paused),
+		),
+	}
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	var stopped, segments int64
+	err = tx.Wrap(func() error {
+		if segments, err = sumSegments(tx, where); err != nil {
+			return err
+		}
+		res, err := tx.From("Message").Where(where...).Update(goqu.Record{"Status": message.Stopped}).Exec()
+		if err != nil {
+			return err
+		}
+		stopped, err = res.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	return stopped, segments, nil
+}
+
+// sumSegments returns total segments of messages matching where and locks them until tx ends
+func sumSegments(tx *goqu.TxDatabase, where []goqu.Expression) (int64, error) {
+	query, args, err := tx.From("Message").Select(goqu.L("COALESCE(SUM(`Total`), 0)")).Where(where...).ToSql()
+	if err != nil {
+		return 0, err
+	}
+	var segments int64
+	_, err = tx.ScanVal(&segments, query+" FOR UPDATE", args...)
+	return segments, err
+}
+
+// PausePending marks all messages which are queued, scheduled or held in a campaign as paused. Messages which are
+// Sending have already been claimed by dispatcher and are sent.
+func (store *store) PausePending(campID int64) (int64, error) {
 	res, err := store.db.From("Message").Where(goqu.I("CampaignID").Eq(campID),
 		goqu.Or(
 			goqu.I("Status").Eq(message.Queued),
 			goqu.I("Status").Eq(message.Scheduled),
+			goqu.I("Status").Eq(message.Held),
 		),
-	).Update(goqu.Record{"Status": message.Stopped}).Exec()
+	).Update(goqu.Record{"Status": message.Paused}).Exec()
 	if err != nil {
 		return 0, err
 	}
 	return res.RowsAffected()
 }
 
-/*
-// SaveDelivery updates an existing message in Message table and adds delivery status
-func SaveDelivery(respID, status string) error {
-	res, err := db.Get().From("Message").Where(goqu.I("RespID").Eq(respID)).Update(goqu.Record{
-		"Status":      status,
-		"DeliveredAt": time.Now().UTC().Unix(),
-	}).Exec()
+// ResumePaused puts paused messages of a campaign back in queue. Messages which are scheduled after now
+// are marked scheduled instead.
+func (store *store) ResumePaused(campID int64, now int64) (int64, error) {
+	res, err := store.db.From("Message").Where(goqu.I("CampaignID").Eq(campID),
+		goqu.I("Status").Eq(message.Paused),
+		goqu.I("ScheduledAt").Gt(now),
+	).Update(goqu.Record{"Status": message.Scheduled}).Exec()
 	if err != nil {
-		log.WithFields(log.Fields{
-			"Error": err,
-		}).Error("Error in updating message.")
-		return err
+		return 0, err
 	}
-	if affected, _ := res.RowsAffected(); affected == 0 {
-		log.WithField("RespID", respID).Error("couldn't update delivery sm. No such response id found")
-		return errors.New("couldn't update delivery sm. No such response id found")
+	scheduled, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	res, err = store.db.From("Message").Where(goqu.I("CampaignID").Eq(campID),
+		goqu.I("Status").Eq(message.Paused),
+	).Update(goqu.Record{"Status": message.Queued}).Exec()
+	if err != nil {
+		return scheduled, err
+	}
+	queued, err := res.RowsAffected()
+	return scheduled + queued, err
 }
 
-// ListWithError returns all messages with status error in a campaign
-func ListWithError(campID int64) ([]Message, error) {
-	m, err := List(Criteria{
-		CampaignID: campID,
-		Status:     Error,
-		PerPage:    maxPerPageListing,
-	})
+// PromoteScheduled queues at most limit scheduled messages whose ScheduledAt is at or before now, oldest first.
+// Rows are claimed by a single UPDATE so it's safe to call from several schedulers at once, a message is
+// promoted by only one of them.
+func (store *store) PromoteScheduled(now int64, limit uint) (int64, error) {
+	res, err := store.db.From("Message").Where(
+		goqu.I("Status").Eq(message.Scheduled),
+		goqu.I("ScheduledAt").Lte(now),
+	).Order(goqu.I("ScheduledAt").Asc()).Limit(limit).Update(goqu.Record{"Status": message.Queued}).Exec()
 	if err != nil {
-		log.WithError(err).Error("Couldn't load messages")
+		return 0, errors.Wrap(err, "couldn't promote scheduled messages")
 	}
-	return m, err
+	return res.RowsAffected()
+}
+
+// ReleaseHeld queues held messages of a connection group whose send window has opened
+func (store *store) ReleaseHeld(connectionGroup string, now int64) (int64, error) {
+	res, err := store.db.From("Message").Where(
+		goqu.I("ConnectionGroup").Eq(connectionGroup),
+		goqu.I("Status").Eq(message.Held),
+		goqu.I("HeldUntil").Lte(now),
+	).Update(goqu.Record{"Status": message.Queued, "HeldUntil": 0}).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't release held messages")
+	}
+	return res.RowsAffected()
 }
 
-// ListQueued returns all messages with status queued in a campaign
-func ListQueued(campID int64) ([]Message, error) {
-	m, err := List(Criteria{
-		CampaignID: campID,
-		Status:     Queued,
-		PerPage:    maxPerPageListing,
+// ReleaseSending queues messages of a connection group left in Sending status
+func (store *store) ReleaseSending(connectionGroup string) (int64, error) {
+	res, err := store.db.From("Message").Where(
+		goqu.I("ConnectionGroup").Eq(connectionGroup),
+		goqu.I("Status").Eq(message.Sending),
+	).Update(goqu.Record{"Status": message.Queued}).Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't release sending messages")
+	}
+	return res.RowsAffected()
+}
+
+// Retry queues failed messages matching criteria again and increments their Retries. It returns number of messages
+// queued and number of matching messages which weren't queued because they have reached c.MaxRetries.
+// Messages are locked while c.Charge is called so segments charged are exactly segments of queued messages.
+func (store *store) Retry(c message.RetryCriteria, now int64) (int64, int64, error) {
+	var statuses []interface{}
+	for _, st := range c.Statuses {
+		statuses = append(statuses, st)
+	}
+	where := []goqu.Expression{
+		goqu.I("CampaignID").Eq(c.CampaignID),
+		goqu.I("Status").In(statuses...),
+	}
+	if len(c.ErrorCodes) > 0 {
+		where = append(where, goqu.Or(
+			goqu.I("Error").In(c.ErrorCodes),
+			goqu.L("JSON_UNQUOTE(JSON_EXTRACT(`DeliverySM`, '$.err')) IN ?", c.ErrorCodes),
+		))
+	}
+	retry := append(where, goqu.I("Retries").Lt(c.MaxRetries))
+	tx, err := store.db.Begin()
+	if err != nil {
+		return 0, 0, err
+	}
+	var retried int64
+	err = tx.Wrap(func() error {
+		if c.Charge != nil {
+			segments, err := sumSegments(tx, retry)
+			if err != nil {
+				return err
+			}
+			if segments > 0 {
+				if err := c.Charge(segments); err != nil {
+					return err
+				}
+			}
+		}
+		res, err := tx.From("Message").Where(retry...).Update(goqu.Record{
+			"Status":      message.Queued,
+			"Retries":     goqu.L("`Retries` + 1"),
+			"QueuedAt":    now,
+			"SentAt":      0,
+			"DeliveredAt": 0,
+			"RespID":      "",
+			"Error":       "",
+			"Connection":  "",
+			"DeliverySM":  nil,
+		}).Exec()
+		if err != nil {
+			return errors.Wrap(err, "couldn't requeue messages")
+		}
+		retried, err = res.RowsAffected()
+		return err
 	})
 	if err != nil {
-		log.WithError(err).Error("Couldn't load messages")
+		return 0, 0, err
 	}
-	return m, err
+	exhausted, err := store.db.From("Message").Where(append(where, goqu.I("Retries").Gte(c.MaxRetries))...).Count()
+	if err != nil {
+		return retried, 0, errors.Wrap(err, "couldn't count exhausted messages")
+	}
+	return retried, exhausted, nil
+}
+
+// SaveDelivery updates status of message with given respID sent on connection conn and stores delivery receipt
+// fields in DeliverySM column. Connection isn't matched if conn is empty.
+// message.ErrNotFound is returned if no message has given respID.
+func (store *store) SaveDelivery(conn, respID string, status message.Status, deliveredAt int64, fields map[string]string) error {
+	where := []goqu.Expression{goqu.I("RespID").Eq(respID)}
+	if conn != "" {
+		where = append(where, goqu.I("Connection").Eq(conn))
+	}
+	res, err := store.db.From("Message").Where(where...).Update(goqu.Record{
+		"Status":      status,
+		"DeliveredAt": deliveredAt,
+		"DeliverySM":  deliverySM(fields),
+	}).Exec()
+	if err != nil {
+		return errors.Wrap(err, "couldn't update delivery")
+	}
+	if affected, _ := res.RowsAffected(); affected == 0 {
+		return message.ErrNotFound
+	}
+	return nil
 }
-*/
@@ -0,0 +1,118 @@
+package optout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/optout"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a new opt out store
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Add saves opt outs, numbers already opted out in same scope are ignored by unique key of table
+func (s *store) Add(o []optout.OptOut) (int64, error) {
+	if len(o) == 0 {
+		return 0, nil
+	}
+	if len(o) > optout.MaxAddCount {
+		return 0, fmt.Errorf("can't add more than %d opt outs at a time", optout.MaxAddCount)
+	}
+	res, err := s.db.From("OptOut").InsertIgnore(interface{}(o)).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Remove deletes opt outs of numbers in scope of username
+func (s *store) Remove(username string, numbers []string) (int64, error) {
+	if len(numbers) == 0 {
+		return 0, nil
+	}
+	res, err := s.db.From("OptOut").Where(
+		goqu.I("Username").Eq(username),
+		goqu.I("Number").In(numbers),
+	).Delete().Exec()
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+// Suppressed returns numbers which are opted out globally or by username
+func (s *store) Suppressed(username string, numbers []string) (map[string]bool, error) {
+	suppressed := make(map[string]bool)
+	if len(numbers) == 0 {
+		return suppressed, nil
+	}
+	var found []string
+	err := s.db.From("OptOut").Select("Number").Where(
+		goqu.I("Number").In(numbers),
+		goqu.I("Username").In("", username),
+	).ScanVals(&found)
+	for _, n := range found {
+		suppressed[n] = true
+	}
+	return suppressed, err
+}
+
+// List filters opt outs based on criteria
+func (s *store) List(c *optout.Criteria) ([]optout.OptOut, error) {
+	var o []optout.OptOut
+	query := s.db.From("OptOut")
+	if c.Number != "" {
+		query = query.Where(goqu.I("Number").Eq(c.Number))
+	}
+	if c.Global {
+		query = query.Where(goqu.I("Username").Eq(""))
+	} else if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	if c.OrderByKey == "" {
+		c.OrderByKey = "CreatedAt"
+	}
+	var from interface{}
+	if c.From != "" {
+		if c.OrderByKey == "CreatedAt" {
+			var err error
+			from, err = strconv.ParseInt(c.From, 10, 64)
+			if err != nil {
+				return o, fmt.Errorf("invalid value for from: %s", c.From)
+			}
+		} else {
+			from = c.From
+		}
+	}
+	orderDir := "DESC"
+	if strings.ToUpper(c.OrderByDir) == "ASC" {
+		orderDir = "ASC"
+	}
+	if from != nil {
+		if orderDir == "ASC" {
+			query = query.Where(goqu.I(c.OrderByKey).Gt(from))
+		} else {
+			query = query.Where(goqu.I(c.OrderByKey).Lt(from))
+		}
+	}
+	orderExp := goqu.I(c.OrderByKey).Desc()
+	if orderDir == "ASC" {
+		orderExp = goqu.I(c.OrderByKey).Asc()
+	}
+	query = query.Order(orderExp)
+	if c.PerPage == 0 {
+		c.PerPage = 100
+	}
+	query = query.Limit(c.PerPage)
+	err := query.ScanStructs(&o)
+	return o, err
+}
@@ -0,0 +1,156 @@
+package sender
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/sender"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a new sender id store
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Save inserts a new sender id or updates status and review of an existing one, and records audit entry a for it
+func (s *store) Save(sd *sender.Sender, a *sender.Audit) (int64, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	err = tx.Wrap(func() error {
+		if sd.ID != 0 {
+			res, err := tx.From("Sender").Where(goqu.I("ID").Eq(sd.ID)).Update(goqu.Record{
+				"Status":     sd.Status,
+				"Note":       sd.Note,
+				"ReviewedBy": sd.ReviewedBy,
+				"ReviewNote": sd.ReviewNote,
+				"UpdatedAt":  sd.UpdatedAt,
+			}).Exec()
+			if err != nil {
+				return err
+			}
+			if n, err := res.RowsAffected(); err != nil {
+				return err
+			} else if n == 0 {
+				return sender.ErrNotFound
+			}
+		} else {
+			res, err := tx.From("Sender").Insert(sd).Exec()
+			if err != nil {
+				return err
+			}
+			if sd.ID, err = res.LastInsertId(); err != nil {
+				return err
+			}
+		}
+		a.SenderID = sd.ID
+		_, err := tx.From("SenderAudit").Insert(a).Exec()
+		return err
+	})
+	return sd.ID, err
+}
+
+// List filters sender ids based on criteria
+func (s *store) List(c *sender.Criteria) ([]sender.Sender, error) {
+	var ss []sender.Sender
+	query := s.db.From("Sender")
+	if c.ID != 0 {
+		query = query.Where(goqu.I("ID").Eq(c.ID))
+	}
+	if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	if c.Src != "" {
+		query = query.Where(goqu.I("Src").Eq(c.Src))
+	}
+	if c.Status != "" {
+		query = query.Where(goqu.I("Status").Eq(c.Status))
+	}
+	query, err := page(query, c.OrderByKey, c.OrderByDir, c.From, c.PerPage, "ID", "CreatedAt", "UpdatedAt")
+	if err != nil {
+		return ss, err
+	}
+	err = query.ScanStructs(&ss)
+	return ss, err
+}
+
+// Audits filters audit trail of sender ids based on criteria
+func (s *store) Audits(c *sender.AuditCriteria) ([]sender.Audit, error) {
+	var a []sender.Audit
+	query := s.db.From("SenderAudit")
+	if c.ID != 0 {
+		query = query.Where(goqu.I("ID").Eq(c.ID))
+	}
+	if c.SenderID != 0 {
+		query = query.Where(goqu.I("SenderID").Eq(c.SenderID))
+	}
+	if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	if c.Action != "" {
+		query = query.Where(goqu.I("Action").Eq(c.Action))
+	}
+	if c.ChangedBy != "" {
+		query = query.Where(goqu.I("ChangedBy").Eq(c.ChangedBy))
+	}
+	if c.CreatedAfter != 0 {
+		query = query.Where(goqu.I("CreatedAt").Gte(c.CreatedAfter))
+	}
+	if c.CreatedBefore != 0 {
+		query = query.Where(goqu.I("CreatedAt").Lte(c.CreatedBefore))
+	}
+	query, err := page(query, c.OrderByKey, c.OrderByDir, c.From, c.PerPage, "ID", "CreatedAt", "SenderID")
+	if err != nil {
+		return a, err
+	}
+	err = query.ScanStructs(&a)
+	return a, err
+}
+
+// page orders query by key, defaulting to first of intKeys, and limits it to perPage rows after from.
+// from is parsed as a number if key is one of intKeys.
+func page(query *goqu.Dataset, key, dir, from string, perPage uint, intKeys ...string) (*goqu.Dataset, error) {
+	if key == "" {
+		key = intKeys[0]
+	}
+	var fromVal interface{}
+	if from != "" {
+		fromVal = from
+		for _, k := range intKeys {
+			if k == key {
+				v, err := strconv.ParseInt(from, 10, 64)
+				if err != nil {
+					return query, fmt.Errorf("invalid value for from: %s", from)
+				}
+				fromVal = v
+			}
+		}
+	}
+	orderDir := "DESC"
+	if strings.ToUpper(dir) == "ASC" {
+		orderDir = "ASC"
+	}
+	if fromVal != nil {
+		if orderDir == "ASC" {
+			query = query.Where(goqu.I(key).Gt(fromVal))
+		} else {
+			query = query.Where(goqu.I(key).Lt(fromVal))
+		}
+	}
+	orderExp := goqu.I(key).Desc()
+	if orderDir == "ASC" {
+		orderExp = goqu.I(key).Asc()
+	}
+	if perPage == 0 {
+		perPage = 100
+	}
+	return query.Order(orderExp).Limit(perPage), nil
+}
@@ -0,0 +1,102 @@
+package template
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/template"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a new template store
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Save inserts a new template or updates an existing one if ID is populated
+func (s *store) Save(t *template.Template) (int64, error) {
+	if t.ID != 0 {
+		_, err := s.db.From("Template").Where(goqu.I("ID").Eq(t.ID)).Update(goqu.Record{
+			"Name":        t.Name,
+			"Description": t.Description,
+			"Msg":         t.Msg,
+			"UpdatedAt":   t.UpdatedAt,
+		}).Exec()
+		return t.ID, err
+	}
+	resp, err := s.db.From("Template").Insert(t).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return resp.LastInsertId()
+}
+
+// Delete deletes a template
+func (s *store) Delete(id int64) error {
+	res, err := s.db.From("Template").Where(goqu.I("ID").Eq(id)).Delete().Exec()
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return template.ErrNotFound
+	}
+	return nil
+}
+
+// List filters templates based on criteria
+func (s *store) List(c *template.Criteria) ([]template.Template, error) {
+	var t []template.Template
+	query := s.db.From("Template")
+	if c.ID != 0 {
+		query = query.Where(goqu.I("ID").Eq(c.ID))
+	}
+	if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	if c.Name != "" {
+		query = query.Where(goqu.I("Name").Eq(c.Name))
+	}
+	if c.OrderByKey == "" {
+		c.OrderByKey = "CreatedAt"
+	}
+	var from interface{}
+	if c.From != "" {
+		if c.OrderByKey == "CreatedAt" || c.OrderByKey == "UpdatedAt" {
+			var err error
+			from, err = strconv.ParseInt(c.From, 10, 64)
+			if err != nil {
+				return t, fmt.Errorf("invalid value for from: %s", c.From)
+			}
+		} else {
+			from = c.From
+		}
+	}
+	orderDir := "DESC"
+	if strings.ToUpper(c.OrderByDir) == "ASC" {
+		orderDir = "ASC"
+	}
+	if from != nil {
+		if orderDir == "ASC" {
+			query = query.Where(goqu.I(c.OrderByKey).Gt(from))
+		} else {
+			query = query.Where(goqu.I(c.OrderByKey).Lt(from))
+		}
+	}
+	orderExp := goqu.I(c.OrderByKey).Desc()
+	if orderDir == "ASC" {
+		orderExp = goqu.I(c.OrderByKey).Asc()
+	}
+	query = query.Order(orderExp)
+	if c.PerPage == 0 {
+		c.PerPage = 100
+	}
+	query = query.Limit(c.PerPage)
+	err := query.ScanStructs(&t)
+	return t, err
+}
@@ -0,0 +1,61 @@
+package throttle
+
+import (
+	"encoding/json"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/throttle"
+	"github.com/pkg/errors"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+const (
+	// settingName is Name of row in settings table which holds token levels
+	settingName = "throttle"
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a throttle store backed by settings table
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Get reads last saved token levels, empty levels are returned if dispatcher hasn't saved any yet
+func (s *store) Get() (*throttle.Levels, error) {
+	var value string
+	found, err := s.db.From("settings").Select("Value").Where(goqu.I("Name").Eq(settingName)).ScanVal(&value)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't read token levels")
+	}
+	l := &throttle.Levels{}
+	if !found {
+		return l, nil
+	}
+	if err := json.Unmarshal([]byte(value), l); err != nil {
+		return nil, errors.Wrap(err, "couldn't parse token levels")
+	}
+	return l, nil
+}
+
+// Save replaces token levels in settings table, inserting row if it doesn't exist
+func (s *store) Save(l *throttle.Levels) error {
+	b, err := json.Marshal(l)
+	if err != nil {
+		return errors.Wrap(err, "couldn't marshal token levels")
+	}
+	res, err := s.db.From("settings").Where(goqu.I("Name").Eq(settingName)).Update(goqu.Record{"Value": string(b)}).Exec()
+	if err != nil {
+		return errors.Wrap(err, "couldn't save token levels")
+	}
+	if n, err := res.RowsAffected(); err == nil && n > 0 {
+		return nil
+	}
+	_, err = s.db.From("settings").Insert(goqu.Record{"Name": settingName, "Value": string(b)}).Exec()
+	if err != nil {
+		return errors.Wrap(err, "couldn't save token levels")
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package user
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/stringutils"
+	"github.com/pkg/errors"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+const (
+	// tokenLength is length of random tokens issued on login
+	tokenLength = 48
+)
+
+type tokenStore struct {
+	db *db.DB
+}
+
+// NewTokenStore returns a token store backed by token table.
+// Tokens are saved as sha256 hashes so a leaked table can't be used to log in.
+func NewTokenStore(db *db.DB) *tokenStore {
+	return &tokenStore{db}
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// Add issues a new token for user
+func (ts *tokenStore) Add(username string, validity int64) (string, error) {
+	token := stringutils.SecureRandomAlphaString(tokenLength)
+	_, err := ts.db.From("token").Insert(user.Token{
+		Token:        hashToken(token),
+		Username:     username,
+		Validity:     validity,
+		LastAccessed: time.Now().UTC().Unix(),
+	}).Exec()
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't insert token")
+	}
+	return token, nil
+}
+
+// Get returns token by token string, user.ErrTokenNotFound is returned if there's no such token
+func (ts *tokenStore) Get(token string) (*user.Token, error) {
+	t := &user.Token{}
+	found, err := ts.db.From("token").Where(goqu.I("Token").Eq(hashToken(token))).ScanStruct(t)
+	if err != nil {
+		return nil, errors.Wrap(err, "token select error")
+	}
+	if !found {
+		return nil, user.ErrTokenNotFound
+	}
+	return t, nil
+}
+
+// Touch updates LastAccessed of token
+func (ts *tokenStore) Touch(token string, lastAccessed int64) error {
+	_, err := ts.db.From("token").Where(goqu.I("Token").Eq(hashToken(token))).Update(goqu.Record{"LastAccessed": lastAccessed}).Exec()
+	return errors.Wrap(err, "couldn't update token")
+}
+
+// Delete revokes a single token
+func (ts *tokenStore) Delete(token string) error {
+	_, err := ts.db.From("token").Where(goqu.I("Token").Eq(hashToken(token))).Delete().Exec()
+	return errors.Wrap(err, "couldn't delete token")
+}
+
+// DeleteAll revokes all tokens of a user
+func (ts *tokenStore) DeleteAll(username string) (int64, error) {
+	res, err := ts.db.From("token").Where(goqu.I("Username").Eq(username)).Delete().Exec()
+	if err != nil {
+		return 0, errors.Wrap(err, "couldn't delete tokens")
+	}
+	return res.RowsAffected()
+}
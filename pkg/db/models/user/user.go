@@ -5,7 +5,9 @@ import (
 	"strings"
 
 	"strconv"
+	"time"
 
+	"github.com/go-sql-driver/mysql"
 	"github.com/haisum/smpp-app/pkg/db"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/logger"
@@ -16,6 +18,8 @@ import (
 const (
 	// defaultConnectionGroup is set for each user who doesn't specifically specify a group
 	defaultConnectionGroup = "Default"
+	// errDuplicateEntry is number of MySQL error returned when a unique key is violated
+	errDuplicateEntry = 1062
 )
 
 type store struct {
@@ -24,10 +28,17 @@ type store struct {
 	hash   func(string) (string, error)
 }
 
-// userAuthenticator is RDBMS implementation of user.Authenticator interface
+const (
+	// touchInterval is minimum seconds between updates of a token's LastAccessed, so that every request doesn't
+	// write to token table
+	touchInterval = 60
+)
+
+// userAuthenticator is RDBMS implementation of user.Authenticator and user.TokenAuthenticator interfaces
 type userAuthenticator struct {
 	GetUser       func(v interface{}) (*user.User, error)
 	HashMatchFunc func(hash, str string) bool
+	Tokens        user.TokenStore
 }
 
 // Authenticate authenticates username, password in User table of RDBMS database
@@ -42,11 +53,41 @@ func (ua *userAuthenticator) Authenticate(username, password string) (*user.User
 	return nil, errors.New("username or password is wrong")
 }
 
-// NewAuthenticator returns implementation of user.Authenticator
-func NewAuthenticator(getUser func(v interface{}) (*user.User, error), hashMatchFunc func(hash, str string) bool) *userAuthenticator {
+// AuthenticateToken authenticates a bearer token issued on login. Expired tokens are deleted, valid ones have their
+// LastAccessed moved forward. Tokens of suspended users are rejected.
+func (ua *userAuthenticator) AuthenticateToken(token string) (*user.User, error) {
+	t, err := ua.Tokens.Get(token)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid token")
+	}
+	now := time.Now().UTC().Unix()
+	if t.Expired(now) {
+		if err := ua.Tokens.Delete(token); err != nil {
+			return nil, errors.Wrap(err, "token expired")
+		}
+		return nil, errors.New("token expired")
+	}
+	if now-t.LastAccessed >= touchInterval {
+		if err := ua.Tokens.Touch(token, now); err != nil {
+			return nil, err
+		}
+	}
+	u, err := ua.GetUser(t.Username)
+	if err != nil {
+		return nil, errors.Wrap(err, "invalid token")
+	}
+	if u.Suspended {
+		return nil, errors.New("user is suspended")
+	}
+	return u, nil
+}
+
+// NewAuthenticator returns implementation of user.Authenticator which also authenticates tokens in tokenStore
+func NewAuthenticator(getUser func(v interface{}) (*user.User, error), hashMatchFunc func(hash, str string) bool, tokenStore user.TokenStore) *userAuthenticator {
 	return &userAuthenticator{
 		GetUser:       getUser,
 		HashMatchFunc: hashMatchFunc,
+		Tokens:        tokenStore,
 	}
 }
 
@@ -57,48 +98,106 @@ func NewStore(db *db.DB, logger logger.Logger, hash func(string) (string, error)
 	}
 }
 
-// Add adds a user to database and returns its primary key
-func (us *store) Add(user *user.User) (int64, error) {
-	err := user.Validate()
+// Add adds a user to database and returns its primary key. Numbers of user are saved in UserNumber table in same
+// transaction, user.NumberTakenError is returned if one of them is owned by another user.
+func (us *store) Add(u *user.User) (int64, error) {
+	err := u.Validate()
 	if err != nil {
 		return 0, err
 	}
-	if us.Exists(user.Username) {
+	if us.Exists(u.Username) {
 		return 0, fmt.Errorf("user already exists")
 	}
-	user.Password, err = us.hash(user.Password)
+	u.Password, err = us.hash(u.Password)
 	if err != nil {
 		us.logger.Error("error", err, "msg", "couldn't hash")
 		return 0, fmt.Errorf("couldn't hash password %s", err)
 	}
-	if user.ConnectionGroup == "" {
-		user.ConnectionGroup = defaultConnectionGroup
+	if u.ConnectionGroup == "" {
+		u.ConnectionGroup = defaultConnectionGroup
 	}
-	w, err := us.db.From("User").Insert(us).Exec()
+	tx, err := us.db.Begin()
 	if err != nil {
 		return 0, err
 	}
-	user.ID, err = w.LastInsertId()
-	return user.ID, err
+	err = tx.Wrap(func() error {
+		w, err := tx.From("User").Insert(u).Exec()
+		if err != nil {
+			return err
+		}
+		if u.ID, err = w.LastInsertId(); err != nil {
+			return err
+		}
+		return setNumbers(tx, u.Username, u.Numbers)
+	})
+	return u.ID, err
 }
 
-// Update updates an existing user
-func (us *store) Update(user *user.User, passwdChanged bool) error {
-	err := user.Validate()
+// Update updates an existing user and replaces its numbers in UserNumber table in same transaction.
+// user.NumberTakenError is returned if one of numbers is owned by another user.
+func (us *store) Update(u *user.User, passwdChanged bool) error {
+	err := u.Validate()
 	if err != nil {
 		return err
 	}
 	if passwdChanged {
-		user.Password, err = us.hash(user.Password)
+		u.Password, err = us.hash(u.Password)
 		if err != nil {
 			return errors.Wrap(err, "hash error")
 		}
 	}
-	_, err = us.db.From("User").Where(goqu.I("id").Eq(user.ID)).Update(us).Exec()
+	tx, err := us.db.Begin()
+	if err != nil {
+		return err
+	}
+	err = tx.Wrap(func() error {
+		if _, err := tx.From("User").Where(goqu.I("id").Eq(u.ID)).Update(u).Exec(); err != nil {
+			return err
+		}
+		return setNumbers(tx, u.Username, u.Numbers)
+	})
 	if err != nil {
 		return errors.Wrap(err, "update error")
 	}
-	return err
+	return nil
+}
+
+// setNumbers replaces numbers of username in UserNumber table. Numbers are saved without leading +, so a long number
+// is owned by one user whether it's written with + or not. Unique key on Number makes sure concurrent updates can't
+// give a number to two users.
+func setNumbers(tx *goqu.TxDatabase, username string, numbers []string) error {
+	if _, err := tx.From("UserNumber").Where(goqu.I("Username").Eq(username)).Delete().Exec(); err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	for _, n := range numbers {
+		num := numberKey(n)
+		if seen[num] {
+			continue
+		}
+		seen[num] = true
+		var owner string
+		found, err := tx.From("UserNumber").Select("Username").Where(goqu.I("Number").Eq(num)).ScanVal(&owner)
+		if err != nil {
+			return err
+		}
+		if found {
+			return user.NumberTakenError{Number: n}
+		}
+		_, err = tx.From("UserNumber").Insert(goqu.Record{"Number": num, "Username": username}).Exec()
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok && mysqlErr.Number == errDuplicateEntry {
+			return user.NumberTakenError{Number: n}
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// numberKey returns number as it's saved in UserNumber table
+func numberKey(n string) string {
+	return strings.TrimPrefix(strings.TrimSpace(n), "+")
 }
 
 // Get gets a single user identified by username (if provided string parameter) or user id (if parameter is int64).
@@ -113,11 +212,19 @@ func (us *store) Get(v interface{}) (*user.User, error) {
 	default:
 		return u, errors.New("unsupported argument for user.Get. Expected string or int64")
 	}
-	_, err := q.ScanStruct(u)
+	found, err := q.ScanStruct(u)
 	if err != nil {
 		return u, errors.Wrap(err, "user select error")
 	}
-	return u, err
+	if !found {
+		return u, nil
+	}
+	numbers, err := us.numbers(u.Username)
+	if err != nil {
+		return u, err
+	}
+	u.Numbers = numbers[u.Username]
+	return u, nil
 }
 
 // List filters users by a criteria and returns filtered users
@@ -154,6 +261,9 @@ func (us *store) List(c user.Criteria) ([]user.User, error) {
 	if c.Email != "" {
 		t = t.Where(goqu.I("Email").Eq(c.Email))
 	}
+	if c.Number != "" {
+		t = t.Where(goqu.L("`Username` IN (SELECT `Username` FROM `UserNumber` WHERE `Number` = ?)", numberKey(c.Number)))
+	}
 	if c.Name != "" {
 		t = t.Where(goqu.I("Name").Eq(c.Name))
 	}
@@ -188,12 +298,41 @@ func (us *store) List(c user.Criteria) ([]user.User, error) {
 	if err != nil {
 		return users, errors.Wrap(err, "user filter error")
 	}
+	if len(users) == 0 {
+		return users, nil
+	}
+	usernames := make([]interface{}, len(users))
+	for i := range users {
+		usernames[i] = users[i].Username
+	}
+	numbers, err := us.numbers(usernames...)
+	if err != nil {
+		return users, err
+	}
 	for i := range users {
 		users[i].Password = ""
+		users[i].Numbers = numbers[users[i].Username]
 	}
 	return users, nil
 }
 
+// numbers returns numbers of given usernames from UserNumber table
+func (us *store) numbers(usernames ...interface{}) (map[string][]string, error) {
+	var rows []struct {
+		Number   string `db:"Number"`
+		Username string `db:"Username"`
+	}
+	err := us.db.From("UserNumber").Where(goqu.I("Username").In(usernames...)).Order(goqu.I("Number").Asc()).ScanStructs(&rows)
+	if err != nil {
+		return nil, errors.Wrap(err, "user number select error")
+	}
+	numbers := make(map[string][]string)
+	for _, r := range rows {
+		numbers[r.Username] = append(numbers[r.Username], r.Number)
+	}
+	return numbers, nil
+}
+
 // Exists checks if another user with same username exists
 func (us *store) Exists(username string) bool {
 	count, err := us.db.From("User").Where(goqu.I("username").Eq(username)).Count()
@@ -0,0 +1,128 @@
+package user
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
+	"gopkg.in/doug-martin/goqu.v3"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestStore_Numbers(t *testing.T) {
+	assert := assert.New(t)
+	d := db.ConnectTest(t)
+	s := NewStore(d, logger.Get(), func(p string) (string, error) { return p, nil })
+	suffix := time.Now().UnixNano() % 1e6
+	alice, bob := fmt.Sprintf("alice%d", suffix), fmt.Sprintf("bob%d", suffix)
+	number := fmt.Sprintf("+97150%06d", suffix)
+	defer func() {
+		d.From("UserNumber").Where(goqu.I("Username").In(alice, bob)).Delete().Exec()
+		d.From("User").Where(goqu.I("Username").In(alice, bob)).Delete().Exec()
+	}()
+	newUser := func(username string, numbers ...string) *user.User {
+		return &user.User{Username: username, Password: "secret", Email: username + "@example.com", Name: username, Numbers: numbers}
+	}
+
+	a := newUser(alice, number)
+	_, err := s.Add(a)
+	assert.Nil(err)
+	users, err := s.List(user.Criteria{Number: number[1:]})
+	assert.Nil(err)
+	if assert.Len(users, 1) {
+		assert.Equal(alice, users[0].Username)
+		assert.Equal([]string{number[1:]}, []string(users[0].Numbers))
+	}
+	got, err := s.Get(alice)
+	assert.Nil(err)
+	assert.Equal([]string{number[1:]}, []string(got.Numbers))
+
+	// a number can't be given to another user, with or without +
+	_, err = s.Add(newUser(bob, number[1:]))
+	assert.Equal(user.NumberTakenError{Number: number[1:]}, errors.Cause(err))
+	assert.False(s.Exists(bob))
+
+	// number is released when its owner doesn't have it anymore
+	a.Numbers = nil
+	assert.Nil(s.Update(a, false))
+	_, err = s.Add(newUser(bob, number))
+	assert.Nil(err)
+	users, err = s.List(user.Criteria{Number: number})
+	assert.Nil(err)
+	if assert.Len(users, 1) {
+		assert.Equal(bob, users[0].Username)
+	}
+}
+
+type memTokenStore map[string]*user.Token
+
+func (m memTokenStore) Add(username string, validity int64) (string, error) {
+	token := fmt.Sprintf("token%d", len(m))
+	m[token] = &user.Token{Token: token, Username: username, Validity: validity, LastAccessed: time.Now().UTC().Unix()}
+	return token, nil
+}
+
+func (m memTokenStore) Get(token string) (*user.Token, error) {
+	t, ok := m[token]
+	if !ok {
+		return nil, user.ErrTokenNotFound
+	}
+	return t, nil
+}
+
+func (m memTokenStore) Touch(token string, lastAccessed int64) error {
+	m[token].LastAccessed = lastAccessed
+	return nil
+}
+
+func (m memTokenStore) Delete(token string) error {
+	delete(m, token)
+	return nil
+}
+
+func (m memTokenStore) DeleteAll(username string) (int64, error) {
+	var n int64
+	for k, t := range m {
+		if t.Username == username {
+			delete(m, k)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func TestUserAuthenticator_AuthenticateToken(t *testing.T) {
+	assert := assert.New(t)
+	users := map[string]*user.User{
+		"active":    {Username: "active"},
+		"suspended": {Username: "suspended", Suspended: true},
+	}
+	getUser := func(v interface{}) (*user.User, error) {
+		u, ok := users[v.(string)]
+		if !ok {
+			return nil, errors.New("user not found")
+		}
+		return u, nil
+	}
+	tokens := memTokenStore{}
+	ua := NewAuthenticator(getUser, nil, tokens)
+
+	token, _ := tokens.Add("active", user.DefaultTokenValidity)
+	u, err := ua.AuthenticateToken(token)
+	assert.Nil(err)
+	if assert.NotNil(u) {
+		assert.Equal("active", u.Username)
+	}
+
+	token, _ = tokens.Add("suspended", user.DefaultTokenValidity)
+	u, err = ua.AuthenticateToken(token)
+	assert.NotNil(err)
+	assert.Nil(u)
+
+	_, err = ua.AuthenticateToken("missing")
+	assert.NotNil(err)
+}
@@ -0,0 +1,216 @@
+package webhook
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/db"
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"gopkg.in/doug-martin/goqu.v3"
+)
+
+type store struct {
+	db *db.DB
+}
+
+// NewStore returns a new webhook store
+func NewStore(db *db.DB) *store {
+	return &store{db}
+}
+
+// Save inserts a new webhook or updates an existing one if ID is populated
+func (s *store) Save(w *webhook.Webhook) (int64, error) {
+	if w.ID != 0 {
+		_, err := s.db.From("Webhook").Where(goqu.I("ID").Eq(w.ID)).Update(goqu.Record{
+			"URL":       w.URL,
+			"Secret":    w.Secret,
+			"Events":    w.Events.String(),
+			"UpdatedAt": w.UpdatedAt,
+		}).Exec()
+		return w.ID, err
+	}
+	resp, err := s.db.From("Webhook").Insert(goqu.Record{
+		"Username":  w.Username,
+		"URL":       w.URL,
+		"Secret":    w.Secret,
+		"Events":    w.Events.String(),
+		"CreatedAt": w.CreatedAt,
+		"UpdatedAt": w.UpdatedAt,
+	}).Exec()
+	if err != nil {
+		return 0, err
+	}
+	return resp.LastInsertId()
+}
+
+// Delete deletes a webhook, its pending deliveries are dropped
+func (s *store) Delete(id int64) error {
+	res, err := s.db.From("Webhook").Where(goqu.I("ID").Eq(id)).Delete().Exec()
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		return webhook.ErrNotFound
+	}
+	_, err = s.db.From("WebhookDelivery").Where(
+		goqu.I("WebhookID").Eq(id),
+		goqu.I("Status").Eq(webhook.DeliveryPending),
+	).Delete().Exec()
+	return err
+}
+
+// List filters webhooks based on criteria
+func (s *store) List(c *webhook.Criteria) ([]webhook.Webhook, error) {
+	var w []webhook.Webhook
+	query := s.db.From("Webhook")
+	if c.ID != 0 {
+		query = query.Where(goqu.I("ID").Eq(c.ID))
+	}
+	if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	query, err := page(query, c.OrderByKey, c.OrderByDir, c.From, c.PerPage, "CreatedAt", "UpdatedAt", "ID")
+	if err != nil {
+		return w, err
+	}
+	err = query.ScanStructs(&w)
+	return w, err
+}
+
+type outboxStore struct {
+	db *db.DB
+}
+
+// NewOutboxStore returns a new store of webhook deliveries
+func NewOutboxStore(db *db.DB) *outboxStore {
+	return &outboxStore{db}
+}
+
+// Add saves new deliveries
+func (s *outboxStore) Add(ds []webhook.Delivery) error {
+	if len(ds) == 0 {
+		return nil
+	}
+	_, err := s.db.From("WebhookDelivery").Insert(interface{}(ds)).Exec()
+	return err
+}
+
+// Due returns pending deliveries whose next attempt time has passed
+func (s *outboxStore) Due(now int64, limit uint) ([]webhook.Delivery, error) {
+	var ds []webhook.Delivery
+	err := s.db.From("WebhookDelivery").Where(
+		goqu.I("Status").Eq(webhook.DeliveryPending),
+		goqu.I("NextAttemptAt").Lte(now),
+	).Order(goqu.I("NextAttemptAt").Asc()).Limit(limit).ScanStructs(&ds)
+	return ds, err
+}
+
+// Claim moves next attempt time of d to until if no other process has done it since d was read
+func (s *outboxStore) Claim(d *webhook.Delivery, until int64) (bool, error) {
+	res, err := s.db.From("WebhookDelivery").Where(
+		goqu.I("ID").Eq(d.ID),
+		goqu.I("Status").Eq(webhook.DeliveryPending),
+		goqu.I("NextAttemptAt").Eq(d.NextAttemptAt),
+	).Update(goqu.Record{
+		"NextAttemptAt": until,
+	}).Exec()
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil || n == 0 {
+		return false, err
+	}
+	d.NextAttemptAt = until
+	return true, nil
+}
+
+// Update records attempt a and saves new state of d
+func (s *outboxStore) Update(d *webhook.Delivery, a *webhook.Attempt) error {
+	if _, err := s.db.From("WebhookAttempt").Insert(a).Exec(); err != nil {
+		return err
+	}
+	_, err := s.db.From("WebhookDelivery").Where(goqu.I("ID").Eq(d.ID)).Update(goqu.Record{
+		"Status":        d.Status,
+		"Attempts":      d.Attempts,
+		"NextAttemptAt": d.NextAttemptAt,
+	}).Exec()
+	return err
+}
+
+// Attempts filters delivery attempts based on criteria
+func (s *outboxStore) Attempts(c *webhook.AttemptCriteria) ([]webhook.Attempt, error) {
+	var a []webhook.Attempt
+	query := s.db.From("WebhookAttempt")
+	if c.ID != 0 {
+		query = query.Where(goqu.I("ID").Eq(c.ID))
+	}
+	if c.DeliveryID != 0 {
+		query = query.Where(goqu.I("DeliveryID").Eq(c.DeliveryID))
+	}
+	if c.WebhookID != 0 {
+		query = query.Where(goqu.I("WebhookID").Eq(c.WebhookID))
+	}
+	if c.Username != "" {
+		query = query.Where(goqu.I("Username").Eq(c.Username))
+	}
+	if c.Event != "" {
+		query = query.Where(goqu.I("Event").Eq(c.Event))
+	}
+	if c.ResponseCode != 0 {
+		query = query.Where(goqu.I("ResponseCode").Eq(c.ResponseCode))
+	}
+	if c.AttemptedAfter != 0 {
+		query = query.Where(goqu.I("AttemptedAt").Gte(c.AttemptedAfter))
+	}
+	if c.AttemptedBefore != 0 {
+		query = query.Where(goqu.I("AttemptedAt").Lte(c.AttemptedBefore))
+	}
+	query, err := page(query, c.OrderByKey, c.OrderByDir, c.From, c.PerPage, "AttemptedAt", "ID", "DeliveryID", "WebhookID", "ResponseCode")
+	if err != nil {
+		return a, err
+	}
+	err = query.ScanStructs(&a)
+	return a, err
+}
+
+// page orders query by key, defaulting to first of intKeys, and limits it to perPage rows after from.
+// from is parsed as a number if key is one of intKeys.
+func page(query *goqu.Dataset, key, dir, from string, perPage uint, intKeys ...string) (*goqu.Dataset, error) {
+	if key == "" {
+		key = intKeys[0]
+	}
+	var fromVal interface{}
+	if from != "" {
+		fromVal = from
+		for _, k := range intKeys {
+			if k == key {
+				v, err := strconv.ParseInt(from, 10, 64)
+				if err != nil {
+					return query, fmt.Errorf("invalid value for from: %s", from)
+				}
+				fromVal = v
+			}
+		}
+	}
+	orderDir := "DESC"
+	if strings.ToUpper(dir) == "ASC" {
+		orderDir = "ASC"
+	}
+	if fromVal != nil {
+		if orderDir == "ASC" {
+			query = query.Where(goqu.I(key).Gt(fromVal))
+		} else {
+			query = query.Where(goqu.I(key).Lt(fromVal))
+		}
+	}
+	orderExp := goqu.I(key).Desc()
+	if orderDir == "ASC" {
+		orderExp = goqu.I(key).Asc()
+	}
+	if perPage == 0 {
+		perPage = 100
+	}
+	return query.Order(orderExp).Limit(perPage), nil
+}
@@ -0,0 +1,75 @@
+package dispatcher
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// bucket is a token bucket which allows size tokens per period. It starts full.
+// A take may leave bucket in debt if it asks for more tokens than are available, so that multipart messages
+// bigger than bucket still honour the average rate.
+type bucket struct {
+	mu     sync.Mutex
+	size   float64
+	rate   float64 // tokens per second
+	tokens float64
+	last   time.Time
+}
+
+func newBucket(size int32, period time.Duration) *bucket {
+	if size < 1 {
+		size = 1
+	}
+	if period <= 0 {
+		period = time.Second
+	}
+	return &bucket{
+		size:   float64(size),
+		rate:   float64(size) / period.Seconds(),
+		tokens: float64(size),
+		last:   time.Now(),
+	}
+}
+
+// refill adds tokens earned since last refill, must be called with mu held
+func (b *bucket) refill(now time.Time) {
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.size {
+		b.tokens = b.size
+	}
+	b.last = now
+}
+
+// wait blocks until n tokens can be taken from bucket or ctx is done
+func (b *bucket) wait(ctx context.Context, n int) error {
+	want := float64(n)
+	for {
+		b.mu.Lock()
+		b.refill(time.Now())
+		need := want
+		if need > b.size {
+			need = b.size
+		}
+		if b.tokens >= need {
+			b.tokens -= want
+			b.mu.Unlock()
+			return nil
+		}
+		delay := time.Duration((need - b.tokens) / b.rate * float64(time.Second))
+		b.mu.Unlock()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+	}
+}
+
+// level returns tokens currently available, negative if bucket is in debt
+func (b *bucket) level() float64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(time.Now())
+	return b.tokens
+}
@@ -0,0 +1,30 @@
+package dispatcher
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestBucket(t *testing.T) {
+	assert := assert.New(t)
+	b := newBucket(10, time.Millisecond*100)
+	ctx := context.Background()
+	start := time.Now()
+	assert.Nil(b.wait(ctx, 4))
+	assert.Nil(b.wait(ctx, 6))
+	assert.True(time.Since(start) < time.Millisecond*20, "full bucket shouldn't block")
+	assert.True(b.level() < 1)
+	assert.Nil(b.wait(ctx, 5))
+	assert.True(time.Since(start) >= time.Millisecond*40, "empty bucket should block until refilled")
+
+	// bigger than bucket takes whole bucket and leaves it in debt
+	b = newBucket(2, time.Second)
+	assert.Nil(b.wait(ctx, 3))
+	assert.True(b.level() < 0)
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*10)
+	defer cancel()
+	assert.Equal(context.DeadlineExceeded, b.wait(ctx, 1))
+}
@@ -0,0 +1,428 @@
+// Package dispatcher sends queued messages to SMSCs.
+// A dispatcher runs one poller per connection group which reads Queued messages of that group from message store
+// and hands them to workers, one worker per SMPP connection in group. Worker for a message is chosen by router
+// from prefix of its destination.
+// Only one dispatcher should run for a connection group at a time.
+// Config is reloaded periodically and groups whose config has changed are restarted.
+// Every connection has a token bucket of Conn.Size segments per Conn.Time seconds, shared by its workers and kept
+// when its group is restarted. Token levels of all workers are saved to throttle store periodically so they can be
+// seen from http service.
+// Messages outside their SendAfter/SendBefore window are marked Held until window opens, and queued again by poller.
+package dispatcher
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/throttle"
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/router"
+	"github.com/haisum/smpp-app/pkg/smpp"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+)
+
+const (
+	// DefaultPollInterval is time to wait before polling store again when no queued messages were found
+	DefaultPollInterval = 2 * time.Second
+	// DefaultBatchSize is maximum number of queued messages read from store at once for a group
+	DefaultBatchSize = 500
+	// DefaultReloadInterval is interval at which config is checked for changes
+	DefaultReloadInterval = 10 * time.Second
+	// DefaultLevelsInterval is interval at which token levels are saved in throttle store
+	DefaultLevelsInterval = time.Second
+	maxBindBackoff        = time.Minute
+)
+
+// Submitter is a bound SMPP session which can submit messages
+type Submitter interface {
+	Submit(p *pdu.PDU) (string, error)
+	Done() <-chan struct{}
+	Close() error
+}
+
+// BindFunc binds a new session for given connection
+type BindFunc func(ctx context.Context, conn config.Conn) (Submitter, error)
+
+// Dispatcher reads queued messages from store and submits them to SMSC
+type Dispatcher struct {
+	msgStore       message.Store
+	confStore      config.Store
+	throttleStore  throttle.Store
+	creditStore    credit.Store
+	notifier       webhook.Notifier
+	bind           BindFunc
+	log            logger.Logger
+	PollInterval   time.Duration
+	BatchSize      uint
+	ReloadInterval time.Duration
+	LevelsInterval time.Duration
+
+	mu      sync.Mutex
+	workers map[string][]*worker
+	buckets map[string]*connBucket
+}
+
+// connBucket is token bucket of a connection and Size and Time it was made for
+type connBucket struct {
+	size   int32
+	period int
+	b      *bucket
+}
+
+// New returns a new dispatcher for connection groups in config store. throttleStore may be nil if token levels
+// don't need to be saved. Segments of messages which fail are refunded in creditStore if it isn't nil and notifier
+// may be nil if webhooks aren't called.
+func New(msgStore message.Store, confStore config.Store, throttleStore throttle.Store, creditStore credit.Store, notifier webhook.Notifier, bind BindFunc, log logger.Logger) *Dispatcher {
+	return &Dispatcher{
+		msgStore:       msgStore,
+		confStore:      confStore,
+		throttleStore:  throttleStore,
+		creditStore:    creditStore,
+		notifier:       notifier,
+		bind:           bind,
+		log:            log,
+		PollInterval:   DefaultPollInterval,
+		BatchSize:      DefaultBatchSize,
+		ReloadInterval: DefaultReloadInterval,
+		LevelsInterval: DefaultLevelsInterval,
+		workers:        make(map[string][]*worker),
+		buckets:        make(map[string]*connBucket),
+	}
+}
+
+// bucket returns token bucket of conn. A bucket is kept for every connection ID so a group restart doesn't refill
+// it, it's only replaced if Size or Time of connection has changed.
+func (d *Dispatcher) bucket(conn config.Conn) *bucket {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if cb, ok := d.buckets[conn.ID]; ok && cb.size == conn.Size && cb.period == conn.Time {
+		return cb.b
+	}
+	cb := &connBucket{size: conn.Size, period: conn.Time, b: newBucket(conn.Size, time.Duration(conn.Time)*time.Second)}
+	d.buckets[conn.ID] = cb
+	return cb.b
+}
+
+// Levels returns token levels of workers of all running groups
+func (d *Dispatcher) Levels() *throttle.Levels {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	l := &throttle.Levels{Conns: []throttle.Level{}, UpdatedAt: time.Now().UTC().Unix()}
+	for group, workers := range d.workers {
+		for _, w := range workers {
+			l.Conns = append(l.Conns, throttle.Level{
+				Group:      group,
+				Connection: w.conn.ID,
+				Tokens:     w.bucket.level(),
+				Size:       w.conn.Size,
+				Time:       w.conn.Time,
+			})
+		}
+	}
+	sort.Slice(l.Conns, func(i, j int) bool {
+		if l.Conns[i].Group != l.Conns[j].Group {
+			return l.Conns[i].Group < l.Conns[j].Group
+		}
+		return l.Conns[i].Connection < l.Conns[j].Connection
+	})
+	return l
+}
+
+// saveLevels saves token levels in throttle store every LevelsInterval until ctx is done
+func (d *Dispatcher) saveLevels(ctx context.Context) {
+	t := time.NewTicker(d.LevelsInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			if err := d.throttleStore.Save(d.Levels()); err != nil {
+				d.log.Error("error", err, "msg", "couldn't save token levels")
+			}
+		}
+	}
+}
+
+// NewBinder returns a BindFunc which binds a transceiver session on conn.URL. If connection has a separate Receiver,
+// a transmitter session is bound on conn.URL and a receiver session on conn.Receiver instead.
+// handler returns function which is called for every deliver_sm received on connection with given id.
+func NewBinder(handler func(conn string) smpp.HandlerFunc) BindFunc {
+	return func(ctx context.Context, conn config.Conn) (Submitter, error) {
+		opts := smpp.BindOpts{
+			Addr:     conn.URL,
+			SystemID: conn.User,
+			Password: conn.Passwd,
+			BindType: pdu.BindTransceiverID,
+		}
+		if handler != nil {
+			opts.Handler = handler(conn.ID)
+		}
+		if conn.Receiver == "" {
+			return smpp.Bind(ctx, opts)
+		}
+		opts.BindType = pdu.BindTransmitterID
+		tx, err := smpp.Bind(ctx, opts)
+		if err != nil {
+			return nil, err
+		}
+		opts.Addr = conn.Receiver
+		opts.BindType = pdu.BindReceiverID
+		rx, err := smpp.Bind(ctx, opts)
+		if err != nil {
+			tx.Close()
+			return nil, err
+		}
+		return newPair(tx, rx), nil
+	}
+}
+
+// pair is a transmitter and receiver session used together, it ends when either of them ends
+type pair struct {
+	tx, rx *smpp.Session
+	done   chan struct{}
+}
+
+func newPair(tx, rx *smpp.Session) *pair {
+	p := &pair{tx, rx, make(chan struct{})}
+	go func() {
+		select {
+		case <-tx.Done():
+		case <-rx.Done():
+		}
+		close(p.done)
+	}()
+	return p
+}
+
+// Submit submits p on transmitter session
+func (p *pair) Submit(sm *pdu.PDU) (string, error) {
+	return p.tx.Submit(sm)
+}
+
+// Done returns a channel which is closed when either session ends
+func (p *pair) Done() <-chan struct{} {
+	return p.done
+}
+
+// Close closes both sessions
+func (p *pair) Close() error {
+	p.rx.Close()
+	return p.tx.Close()
+}
+
+// runningGroup is a connection group being dispatched
+type runningGroup struct {
+	conf   config.ConnGroup
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func (g *runningGroup) stop() {
+	g.cancel()
+	<-g.done
+}
+
+// Run starts dispatching messages of all connection groups and blocks until ctx is done.
+// Config is reloaded every ReloadInterval, groups which were changed are restarted, removed groups are stopped.
+func (d *Dispatcher) Run(ctx context.Context) {
+	running := make(map[string]*runningGroup)
+	if d.throttleStore != nil {
+		go d.saveLevels(ctx)
+	}
+	defer func() {
+		for _, g := range running {
+			g.stop()
+		}
+	}()
+	t := time.NewTicker(d.ReloadInterval)
+	defer t.Stop()
+	for {
+		d.reload(ctx, running)
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// reload reads config and brings running groups in line with it
+func (d *Dispatcher) reload(ctx context.Context, running map[string]*runningGroup) {
+	conf, err := d.confStore.Get()
+	if err != nil {
+		d.log.Error("error", err, "msg", "couldn't load config")
+		return
+	}
+	seen := make(map[string]bool)
+	for _, g := range conf.ConnGroups {
+		seen[g.Name] = true
+		if r, ok := running[g.Name]; ok {
+			if reflect.DeepEqual(r.conf, g) {
+				continue
+			}
+			d.log.Info("group", g.Name, "msg", "config changed, restarting group")
+			r.stop()
+			delete(running, g.Name)
+		}
+		if len(g.Conns) == 0 {
+			d.log.Error("group", g.Name, "msg", "connection group has no connections, skipping")
+			continue
+		}
+		gCtx, cancel := context.WithCancel(ctx)
+		r := &runningGroup{conf: g, cancel: cancel, done: make(chan struct{})}
+		go func(g config.ConnGroup) {
+			defer close(r.done)
+			d.runGroup(gCtx, g)
+		}(g)
+		running[g.Name] = r
+	}
+	for name, r := range running {
+		if !seen[name] {
+			d.log.Info("group", name, "msg", "group removed from config, stopping")
+			r.stop()
+			delete(running, name)
+		}
+	}
+}
+
+func (d *Dispatcher) runGroup(ctx context.Context, g config.ConnGroup) {
+	log := d.log.(logger.WithLogger).With("group", g.Name)
+	var (
+		workers = make(map[string]*worker)
+		wg      sync.WaitGroup
+	)
+	for _, c := range g.Conns {
+		w := newWorker(c, d, log.With("connection", c.ID))
+		workers[c.ID] = w
+		d.mu.Lock()
+		d.workers[g.Name] = append(d.workers[g.Name], w)
+		d.mu.Unlock()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.run(ctx)
+		}()
+	}
+	defer func() {
+		wg.Wait()
+		d.mu.Lock()
+		delete(d.workers, g.Name)
+		d.mu.Unlock()
+	}()
+	// only one dispatcher runs for a group, so messages left Sending were claimed before it was last stopped
+	if _, err := d.msgStore.ReleaseSending(g.Name); err != nil {
+		log.Error("error", err, "msg", "couldn't release sending messages")
+	}
+	// next is round robin counter per prefix for spreading messages between connections having same prefix
+	next := make(map[string]int)
+	for {
+		if _, err := d.msgStore.ReleaseHeld(g.Name, time.Now().UTC().Unix()); err != nil {
+			log.Error("error", err, "msg", "couldn't release held messages")
+		}
+		msgs, err := d.msgStore.List(&message.Criteria{
+			ConnectionGroup: g.Name,
+			Status:          message.Queued,
+			OrderByKey:      "QueuedAt",
+			OrderByDir:      "ASC",
+			PerPage:         d.BatchSize,
+		})
+		if err != nil {
+			log.Error("error", err, "msg", "couldn't list queued messages")
+		}
+		if len(msgs) == 0 {
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(d.PollInterval):
+				continue
+			}
+		}
+		var batch sync.WaitGroup
+		for i := range msgs {
+			m := &msgs[i]
+			if d.hold(m, log) {
+				continue
+			}
+			route, err := router.Find(g, m.Dst)
+			if err != nil {
+				log.Error("error", err, "msg", "couldn't route message", "id", m.ID, "dst", m.Dst)
+				m.Status = message.Error
+				m.Error = truncate(err.Error(), maxErrorLen)
+				if ok, err := d.msgStore.UpdateFrom(m, message.Queued); err != nil {
+					log.Error("error", err, "msg", "couldn't update message", "id", m.ID)
+				} else if ok {
+					d.updated(m, int64(m.Total))
+				}
+				continue
+			}
+			w := workers[route.Conns[next[route.Pfx]%len(route.Conns)]]
+			next[route.Pfx]++
+			batch.Add(1)
+			select {
+			case w.jobs <- job{m: m, done: batch.Done}:
+			case <-ctx.Done():
+				return
+			}
+		}
+		// wait for batch to finish so that next List doesn't return messages which are still being sent
+		batch.Wait()
+	}
+}
+
+// hold marks message Held if it's outside its send window and returns true if it was held.
+// A message with invalid window is marked Error.
+func (d *Dispatcher) hold(m *message.Message, log logger.Logger) bool {
+	now := time.Now()
+	next, err := message.NextSendTime(m.SendAfter, m.SendBefore, m.TimeZone, now)
+	if err != nil {
+		m.Status = message.Error
+		m.Error = truncate(err.Error(), maxErrorLen)
+	} else if next.After(now) {
+		m.Status = message.Held
+		m.HeldUntil = next.UTC().Unix()
+	} else {
+		return false
+	}
+	if ok, err := d.msgStore.UpdateFrom(m, message.Queued); err != nil {
+		log.Error("error", err, "msg", "couldn't update message", "id", m.ID)
+	} else if ok {
+		d.updated(m, int64(m.Total))
+	}
+	return true
+}
+
+// updated refunds refund segments of m if it failed and calls webhooks of its user if it was sent or failed.
+// refund is less than m.Total when some segments of a multipart message were accepted before one failed.
+func (d *Dispatcher) updated(m *message.Message, refund int64) {
+	if m.Status == message.Error && refund > 0 && d.creditStore != nil {
+		e := credit.Entry{
+			Username:   m.Username,
+			Kind:       credit.Refund,
+			Amount:     refund,
+			MessageID:  m.ID,
+			CampaignID: m.CampaignID,
+			Note:       "message failed",
+			CreatedAt:  time.Now().UTC().Unix(),
+		}
+		if err := d.creditStore.Add(&e); err != nil {
+			d.log.Error("error", err, "msg", "couldn't refund failed message", "id", m.ID)
+		}
+	}
+	if d.notifier == nil {
+		return
+	}
+	switch m.Status {
+	case message.Sent:
+		d.notifier.Notify(m.Username, webhook.MessagePayload(webhook.EventSent, m))
+	case message.Error:
+		d.notifier.Notify(m.Username, webhook.MessagePayload(webhook.EventError, m))
+	}
+}
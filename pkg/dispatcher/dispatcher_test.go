@@ -0,0 +1,484 @@
+package dispatcher
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+	"github.com/haisum/smpp-app/pkg/smsc/fake"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// memStore is an in memory message.Store which only implements methods used by dispatcher
+type memStore struct {
+	message.Store
+	mu   sync.Mutex
+	msgs map[int64]message.Message
+}
+
+func (s *memStore) List(c *message.Criteria) ([]message.Message, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var ms []message.Message
+	for _, m := range s.msgs {
+		if m.Status == c.Status && m.ConnectionGroup == c.ConnectionGroup {
+			ms = append(ms, m)
+		}
+	}
+	return ms, nil
+}
+
+func (s *memStore) Update(m *message.Message) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.msgs[m.ID] = *m
+	return nil
+}
+
+func (s *memStore) UpdateFrom(m *message.Message, from message.Status) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.msgs[m.ID].Status != from {
+		return false, nil
+	}
+	s.msgs[m.ID] = *m
+	return true, nil
+}
+
+func (s *memStore) ReleaseSending(group string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, m := range s.msgs {
+		if m.Status == message.Sending && m.ConnectionGroup == group {
+			m.Status = message.Queued
+			s.msgs[id] = m
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memStore) ReleaseHeld(group string, now int64) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var n int64
+	for id, m := range s.msgs {
+		if m.Status == message.Held && m.ConnectionGroup == group && m.HeldUntil <= now {
+			m.Status = message.Queued
+			m.HeldUntil = 0
+			s.msgs[id] = m
+			n++
+		}
+	}
+	return n, nil
+}
+
+// confStore is an in memory config.Store
+type confStore struct {
+	mu   sync.Mutex
+	conf config.Config
+}
+
+func (s *confStore) Get() (*config.Config, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c := s.conf
+	return &c, nil
+}
+
+func (s *confStore) Save(c *config.Config) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conf = *c
+	return nil
+}
+
+func (s *memStore) get(id int64) message.Message {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.msgs[id]
+}
+
+// pending returns true if message with id hasn't been sent yet
+func (s *memStore) pending(id int64) bool {
+	st := s.get(id).Status
+	return st == message.Queued || st == message.Sending
+}
+
+func TestDispatcher_Run(t *testing.T) {
+	assert := assert.New(t)
+	smsc := fake.New()
+	smsc.DisableReceipts = true
+	assert.Nil(smsc.Start("127.0.0.1:0"))
+	defer smsc.Close()
+
+	store := &memStore{msgs: map[int64]message.Message{
+		1: {ID: 1, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "+971501234567", Msg: "hello", Enc: message.EncLatin},
+		2: {ID: 2, ConnectionGroup: "Default", Status: message.Queued, Src: "1234", Dst: "971521234568", Msg: "سلام", Enc: message.EncUCS},
+		3: {ID: 3, ConnectionGroup: "Other", Status: message.Queued, Src: "1234", Dst: "971501234569", Msg: "hello", Enc: message.EncLatin},
+	}}
+	conf := &confStore{conf: config.Config{
+		ConnGroups: []config.ConnGroup{
+			{Name: "Default", DefaultPfx: "+971", Conns: []config.Conn{
+				{ID: "c1", URL: smsc.Addr(), Pfxs: []string{"+97150"}, Size: 5, Time: 1},
+				{ID: "c2", URL: smsc.Addr(), Pfxs: []string{"+971"}, Size: 5, Time: 1},
+			}},
+		},
+	}}
+	d := New(store, conf, nil, nil, nil, NewBinder(nil), logger.Get())
+	d.PollInterval = time.Millisecond * 10
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		d.Run(ctx)
+		close(done)
+	}()
+	deadline := time.After(time.Second * 5)
+	for store.pending(1) || store.pending(2) {
+		select {
+		case <-deadline:
+			t.Fatal("messages weren't sent in time")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	levels := d.Levels()
+	assert.Len(levels.Conns, 2)
+	for _, l := range levels.Conns {
+		assert.Equal("Default", l.Group)
+		assert.Equal(int32(5), l.Size)
+		assert.True(l.Tokens < 5)
+	}
+	cancel()
+	<-done
+	assert.Len(d.Levels().Conns, 0)
+	for _, id := range []int64{1, 2} {
+		m := store.get(id)
+		assert.Equal(message.Sent, m.Status)
+		assert.NotEmpty(m.RespID)
+		assert.NotZero(m.SentAt)
+	}
+	assert.Equal("c1", store.get(1).Connection)
+	assert.Equal("c2", store.get(2).Connection)
+	assert.Equal(message.Queued, store.get(3).Status)
+	sms := smsc.Submitted()
+	assert.Len(sms, 2)
+	for _, sm := range sms {
+		if sm.Fields.String(pdu.SourceAddr) == "Sender" {
+			assert.Equal(uint8(5), sm.Fields.Uint8(pdu.SourceAddrTON))
+			assert.Equal("971501234567", sm.Fields.String(pdu.DestinationAddr))
+			assert.Equal([]byte("hello"), sm.Fields.Bytes(pdu.ShortMessage))
+		} else {
+			assert.Equal(uint8(0x08), sm.Fields.Uint8(pdu.DataCoding))
+		}
+	}
+}
+
+func TestDispatcher_SubmitError(t *testing.T) {
+	assert := assert.New(t)
+	smsc := fake.New()
+	smsc.ErrorRate = 1
+	smsc.ErrorStatus = pdu.StatusInvDstAdr
+	assert.Nil(smsc.Start("127.0.0.1:0"))
+	defer smsc.Close()
+	store := &memStore{msgs: map[int64]message.Message{
+		1: {ID: 1, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin},
+	}}
+	conf := &confStore{conf: config.Config{
+		ConnGroups: []config.ConnGroup{{Name: "Default", DefaultPfx: "+971", Conns: []config.Conn{{ID: "c1", URL: smsc.Addr(), Pfxs: []string{"+971"}}}}},
+	}}
+	d := New(store, conf, nil, nil, nil, NewBinder(nil), logger.Get())
+	d.PollInterval = time.Millisecond * 10
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	go d.Run(ctx)
+	for store.pending(1) && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	m := store.get(1)
+	assert.Equal(message.Error, m.Status)
+	assert.Equal("ESME_RINVDSTADR", m.Error)
+	assert.Equal("c1", m.Connection)
+}
+
+func TestDispatcher_Reload(t *testing.T) {
+	assert := assert.New(t)
+	smsc := fake.New()
+	smsc.DisableReceipts = true
+	assert.Nil(smsc.Start("127.0.0.1:0"))
+	defer smsc.Close()
+	store := &memStore{msgs: map[int64]message.Message{
+		1: {ID: 1, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin},
+	}}
+	conf := &confStore{conf: config.Config{
+		ConnGroups: []config.ConnGroup{{Name: "Default", DefaultPfx: "+971", Conns: []config.Conn{{ID: "c1", URL: smsc.Addr(), Pfxs: []string{"+971"}}}}},
+	}}
+	d := New(store, conf, nil, nil, nil, NewBinder(nil), logger.Get())
+	d.PollInterval = time.Millisecond * 10
+	d.ReloadInterval = time.Millisecond * 20
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	go d.Run(ctx)
+	for store.pending(1) && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal("c1", store.get(1).Connection)
+
+	conf.Save(&config.Config{
+		ConnGroups: []config.ConnGroup{{Name: "Default", DefaultPfx: "+971", Conns: []config.Conn{{ID: "c2", URL: smsc.Addr(), Pfxs: []string{"+971"}}}}},
+	})
+	time.Sleep(time.Millisecond * 100)
+	store.Update(&message.Message{ID: 2, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin})
+	for store.pending(2) && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal("c2", store.get(2).Connection)
+}
+
+func TestDispatcher_Hold(t *testing.T) {
+	assert := assert.New(t)
+	smsc := fake.New()
+	smsc.DisableReceipts = true
+	assert.Nil(smsc.Start("127.0.0.1:0"))
+	defer smsc.Close()
+	now := time.Now().UTC()
+	// window which opens an hour from now and one which is open now
+	closed := now.Add(time.Hour).Format("15:04")
+	open := now.Add(-time.Hour).Format("15:04")
+	store := &memStore{msgs: map[int64]message.Message{
+		1: {ID: 1, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin, SendAfter: closed, SendBefore: open},
+		2: {ID: 2, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin, SendAfter: open, SendBefore: closed},
+		3: {ID: 3, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin, SendAfter: open, SendBefore: closed, TimeZone: "Nowhere/Nothing"},
+		4: {ID: 4, ConnectionGroup: "Default", Status: message.Held, HeldUntil: now.Unix() - 1, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin},
+	}}
+	conf := &confStore{conf: config.Config{
+		ConnGroups: []config.ConnGroup{{Name: "Default", DefaultPfx: "+971", Conns: []config.Conn{{ID: "c1", URL: smsc.Addr(), Pfxs: []string{"+971"}, Size: 10, Time: 1}}}},
+	}}
+	d := New(store, conf, nil, nil, nil, NewBinder(nil), logger.Get())
+	d.PollInterval = time.Millisecond * 10
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	go d.Run(ctx)
+	for (store.get(2).Status != message.Sent || store.get(4).Status != message.Sent) && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	m := store.get(1)
+	assert.Equal(message.Held, m.Status)
+	assert.Equal(now.Add(time.Hour).Truncate(time.Minute).Unix(), m.HeldUntil)
+	assert.Equal(message.Sent, store.get(2).Status)
+	assert.Equal(message.Error, store.get(3).Status)
+	assert.Equal(message.Sent, store.get(4).Status)
+}
+
+func TestDispatcher_Multipart(t *testing.T) {
+	assert := assert.New(t)
+	smsc := fake.New()
+	smsc.DisableReceipts = true
+	assert.Nil(smsc.Start("127.0.0.1:0"))
+	defer smsc.Close()
+	text := strings.Repeat("a", 134) + strings.Repeat("b", 134) + "c"
+	store := &memStore{msgs: map[int64]message.Message{
+		1: {ID: 1, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: text, Enc: message.EncLatin, Total: message.Total(text, message.EncLatin)},
+	}}
+	conf := &confStore{conf: config.Config{
+		ConnGroups: []config.ConnGroup{{Name: "Default", DefaultPfx: "+971", Conns: []config.Conn{{ID: "c1", URL: smsc.Addr(), Pfxs: []string{"+971"}, Size: 10, Time: 1}}}},
+	}}
+	d := New(store, conf, nil, nil, nil, NewBinder(nil), logger.Get())
+	d.PollInterval = time.Millisecond * 10
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	go d.Run(ctx)
+	for store.pending(1) && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(3, store.get(1).Total)
+	assert.Equal(message.Sent, store.get(1).Status)
+	sms := smsc.Submitted()
+	assert.Len(sms, 3)
+	var got string
+	for i, sm := range sms {
+		text := sm.Fields.Bytes(pdu.ShortMessage)
+		assert.Equal(uint8(0x40), sm.Fields.Uint8(pdu.ESMClass)&0x40)
+		assert.Equal([]byte{0x05, 0x00, 0x03}, text[:3])
+		assert.Equal([]byte{0x03, uint8(i + 1)}, text[4:6])
+		got += string(text[6:])
+		if i < 2 {
+			assert.Equal(uint8(0), sm.Fields.Uint8(pdu.RegisteredDelivery))
+		} else {
+			assert.Equal(uint8(1), sm.Fields.Uint8(pdu.RegisteredDelivery))
+		}
+	}
+	assert.Equal(text, got)
+}
+
+func TestWorker_SendStopped(t *testing.T) {
+	assert := assert.New(t)
+	// message was listed as queued but its campaign was stopped before worker got to it
+	store := &memStore{msgs: map[int64]message.Message{
+		1: {ID: 1, ConnectionGroup: "Default", Status: message.Stopped, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin},
+	}}
+	bind := func(ctx context.Context, conn config.Conn) (Submitter, error) {
+		t.Fatal("stopped message shouldn't be submitted")
+		return nil, nil
+	}
+	d := New(store, &confStore{}, nil, nil, nil, bind, logger.Get())
+	w := newWorker(config.Conn{ID: "c1", Size: 10, Time: 1}, d, logger.Get().(logger.WithLogger))
+	m := store.get(1)
+	m.Status = message.Queued
+	w.send(context.Background(), &m)
+	assert.Equal(message.Stopped, store.get(1).Status)
+	assert.Empty(store.get(1).Connection)
+	// message which wasn't claimed doesn't take tokens of connection
+	assert.Equal(float64(10), w.bucket.tokens)
+
+	// claim is released if worker is stopped while waiting for tokens
+	store.msgs[1] = message.Message{ID: 1, ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: "hello", Enc: message.EncLatin, Total: 1}
+	w.bucket = newBucket(1, time.Hour)
+	w.bucket.tokens = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	m = store.get(1)
+	w.send(ctx, &m)
+	assert.Equal(message.Queued, store.get(1).Status)
+	assert.Empty(store.get(1).Connection)
+}
+
+// memCredit is an in memory credit.Store which records entries added to it
+type memCredit struct {
+	credit.Store
+	mu      sync.Mutex
+	entries []credit.Entry
+}
+
+func (c *memCredit) Add(e *credit.Entry) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries = append(c.entries, *e)
+	return nil
+}
+
+// failingSubmitter accepts first ok submit_sm and rejects the rest
+type failingSubmitter struct {
+	ok        int
+	submitted int
+	done      chan struct{}
+}
+
+func (s *failingSubmitter) Submit(p *pdu.PDU) (string, error) {
+	s.submitted++
+	if s.submitted > s.ok {
+		return "", pdu.StatusSubmitFail
+	}
+	return "id", nil
+}
+
+func (s *failingSubmitter) Done() <-chan struct{} {
+	return s.done
+}
+
+func (s *failingSubmitter) Close() error {
+	return nil
+}
+
+func TestWorker_SendPartialRefund(t *testing.T) {
+	assert := assert.New(t)
+	text := strings.Repeat("a", 134) + strings.Repeat("b", 134) + "c"
+	store := &memStore{msgs: map[int64]message.Message{
+		1: {ID: 1, Username: "user", ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: text, Enc: message.EncLatin, Total: message.Total(text, message.EncLatin)},
+	}}
+	sub := &failingSubmitter{ok: 1, done: make(chan struct{})}
+	bind := func(ctx context.Context, conn config.Conn) (Submitter, error) {
+		return sub, nil
+	}
+	credits := &memCredit{}
+	d := New(store, &confStore{}, nil, credits, nil, bind, logger.Get())
+	w := newWorker(config.Conn{ID: "c1", Size: 10, Time: 1}, d, logger.Get().(logger.WithLogger))
+	m := store.get(1)
+	w.send(context.Background(), &m)
+	assert.Equal(2, sub.submitted)
+	assert.Equal(message.Error, store.get(1).Status)
+	// first segment was accepted by SMSC so only remaining two are refunded
+	if assert.Len(credits.entries, 1) {
+		assert.Equal(credit.Refund, credits.entries[0].Kind)
+		assert.Equal(int64(2), credits.entries[0].Amount)
+		assert.Equal(int64(1), credits.entries[0].MessageID)
+	}
+}
+
+// brokenSubmitter accepts first ok submit_sm and fails rest as if connection broke
+type brokenSubmitter struct {
+	failingSubmitter
+}
+
+func (s *brokenSubmitter) Submit(p *pdu.PDU) (string, error) {
+	s.submitted++
+	if s.submitted > s.ok {
+		return "", errors.New("connection reset")
+	}
+	return "id", nil
+}
+
+func TestWorker_SendAborted(t *testing.T) {
+	assert := assert.New(t)
+	text := strings.Repeat("a", 134) + strings.Repeat("b", 134) + "c"
+	for accepted, status := range map[int]message.Status{0: message.Queued, 1: message.Error} {
+		store := &memStore{msgs: map[int64]message.Message{
+			1: {ID: 1, Username: "user", ConnectionGroup: "Default", Status: message.Queued, Src: "Sender", Dst: "123", Msg: text, Enc: message.EncLatin, Total: message.Total(text, message.EncLatin)},
+		}}
+		ctx, cancel := context.WithCancel(context.Background())
+		sub := &brokenSubmitter{failingSubmitter{ok: accepted, done: make(chan struct{})}}
+		binds := 0
+		// session breaks after accepted segments and dispatcher is stopped while it's rebinding
+		bind := func(ctx context.Context, conn config.Conn) (Submitter, error) {
+			binds++
+			if binds > 1 {
+				cancel()
+				return nil, errors.New("connection refused")
+			}
+			return sub, nil
+		}
+		credits := &memCredit{}
+		d := New(store, &confStore{}, nil, credits, nil, bind, logger.Get())
+		w := newWorker(config.Conn{ID: "c1", Size: 10, Time: 1}, d, logger.Get().(logger.WithLogger))
+		m := store.get(1)
+		w.send(ctx, &m)
+		cancel()
+		assert.Equal(accepted+1, sub.submitted)
+		assert.Equal(status, store.get(1).Status)
+		if accepted == 0 {
+			assert.Empty(store.get(1).Connection)
+			assert.Empty(credits.entries)
+			continue
+		}
+		assert.Equal("stopped after 1 of 3 segments were submitted", store.get(1).Error)
+		if assert.Len(credits.entries, 1) {
+			assert.Equal(int64(2), credits.entries[0].Amount)
+		}
+	}
+}
+
+func TestDispatcher_Bucket(t *testing.T) {
+	assert := assert.New(t)
+	d := New(&memStore{}, &confStore{}, nil, nil, nil, nil, logger.Get())
+	conn := config.Conn{ID: "c1", Size: 10, Time: 60}
+	b := d.bucket(conn)
+	assert.Nil(b.wait(context.Background(), 10))
+
+	// workers of a restarted group get same bucket, so it isn't refilled
+	assert.True(b == d.bucket(conn))
+	assert.True(d.bucket(conn).level() < 1)
+	assert.True(b != d.bucket(config.Conn{ID: "c2", Size: 10, Time: 60}))
+
+	// bucket is replaced when rate of connection changes
+	conn.Size = 20
+	assert.True(b != d.bucket(conn))
+	assert.Equal(float64(20), d.bucket(conn).level())
+}
@@ -0,0 +1,250 @@
+package dispatcher
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/segment"
+	"github.com/haisum/smpp-app/pkg/smpp"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+	"github.com/pkg/errors"
+)
+
+const (
+	// maxErrorLen is size of Error column in Message table
+	maxErrorLen = 50
+	// esmClassUDHI is esm_class bit which tells short_message starts with user data header
+	esmClassUDHI = 0x40
+)
+
+type job struct {
+	m    *message.Message
+	done func()
+}
+
+// worker owns a single SMPP connection and submits messages given to it on jobs channel
+type worker struct {
+	conn    config.Conn
+	d       *Dispatcher
+	log     logger.WithLogger
+	jobs    chan job
+	session Submitter
+	bucket  *bucket
+	// ref is concatenation reference number of last multipart message
+	ref uint8
+}
+
+func newWorker(conn config.Conn, d *Dispatcher, log logger.WithLogger) *worker {
+	return &worker{
+		conn:   conn,
+		d:      d,
+		log:    log,
+		jobs:   make(chan job),
+		bucket: d.bucket(conn),
+	}
+}
+
+func (w *worker) run(ctx context.Context) {
+	defer func() {
+		if w.session != nil {
+			w.session.Close()
+		}
+	}()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case j := <-w.jobs:
+			w.send(ctx, j.m)
+			j.done()
+		}
+	}
+}
+
+// send claims message, waits for bucket of worker's connection to have tokens for all segments of it, submits them and updates
+// message status in store. If session breaks while submitting, current segment is retried on a new session until ctx is done.
+// RespID of a multipart message is id of its last segment, which is the only one delivery receipt is asked for.
+// Message is claimed by changing its status from Queued to Sending before it's submitted, so a message whose
+// campaign was stopped or paused after it was listed isn't sent and doesn't use tokens of bucket. If ctx is done before all segments are submitted,
+// message is released if none was submitted and marked Error otherwise, so its accepted segments aren't sent again.
+func (w *worker) send(ctx context.Context, m *message.Message) {
+	ps := submitSMs(m, w.conn, w.ref)
+	if len(ps) > 1 {
+		w.ref++
+	}
+	m.Status = message.Sending
+	m.Connection = w.conn.ID
+	if ok, err := w.d.msgStore.UpdateFrom(m, message.Queued); err != nil || !ok {
+		if err != nil {
+			w.log.Error("error", err, "msg", "couldn't claim message", "id", m.ID)
+		}
+		return
+	}
+	if err := w.bucket.wait(ctx, len(ps)); err != nil {
+		w.abort(m, 0)
+		return
+	}
+	var (
+		respID string
+		err    error
+		// accepted is number of segments SMSC accepted, they're charged even if a later one fails
+		accepted int
+	)
+	for accepted < len(ps) {
+		if err := w.ensureSession(ctx); err != nil {
+			w.abort(m, accepted)
+			return
+		}
+		respID, err = w.session.Submit(ps[accepted])
+		cause := errors.Cause(err)
+		if _, isStatus := cause.(pdu.Status); err != nil && !isStatus && cause != smpp.ErrTimeout {
+			w.log.Error("error", err, "msg", "session broke while submitting, rebinding", "id", m.ID, "segment", accepted+1)
+			w.session.Close()
+			w.session = nil
+			continue
+		}
+		if err != nil {
+			break
+		}
+		accepted++
+	}
+	m.SentAt = time.Now().UTC().Unix()
+	if err != nil {
+		m.Status = message.Error
+		m.Error = truncate(errors.Cause(err).Error(), maxErrorLen)
+	} else {
+		m.Status = message.Sent
+		m.RespID = respID
+	}
+	if ok, err := w.d.msgStore.UpdateFrom(m, message.Sending); err != nil {
+		w.log.Error("error", err, "msg", "couldn't update message", "id", m.ID, "respID", m.RespID)
+	} else if ok {
+		w.d.updated(m, int64(m.Total-accepted))
+	}
+}
+
+// abort ends sending of a claimed message when worker is stopped before or after accepted segments of it were submitted.
+// A message with no accepted segment is put back in queue, otherwise it's marked Error and rest of segments are
+// refunded, sending it again would deliver accepted segments twice.
+func (w *worker) abort(m *message.Message, accepted int) {
+	if accepted == 0 {
+		m.Status = message.Queued
+		m.Connection = ""
+	} else {
+		m.Status = message.Error
+		m.Error = fmt.Sprintf("stopped after %d of %d segments were submitted", accepted, m.Total)
+		m.SentAt = time.Now().UTC().Unix()
+	}
+	if ok, err := w.d.msgStore.UpdateFrom(m, message.Sending); err != nil {
+		w.log.Error("error", err, "msg", "couldn't update message", "id", m.ID)
+	} else if ok && m.Status == message.Error {
+		w.d.updated(m, int64(m.Total-accepted))
+	}
+}
+
+// ensureSession binds a session if there's none or current one has ended.
+// It retries binding with exponential back off and only returns error when ctx is done.
+func (w *worker) ensureSession(ctx context.Context) error {
+	if w.session != nil {
+		select {
+		case <-w.session.Done():
+			w.session.Close()
+			w.session = nil
+		default:
+			return nil
+		}
+	}
+	backoff := time.Second
+	for {
+		s, err := w.d.bind(ctx, w.conn)
+		if err == nil {
+			w.log.Info("msg", "bound", "url", w.conn.URL)
+			w.session = s
+			return nil
+		}
+		w.log.Error("error", err, "msg", "couldn't bind", "url", w.conn.URL, "retryIn", backoff)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBindBackoff {
+			backoff = maxBindBackoff
+		}
+	}
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
+
+// submitSM builds submit_sm PDU for a message using default fields of connection, without text
+func submitSM(m *message.Message, c config.Conn) *pdu.PDU {
+	p := pdu.New(pdu.SubmitSMID)
+	p.Fields[pdu.ServiceType] = c.Fields.ServiceType
+	p.Fields[pdu.SourceAddrTON] = c.Fields.SourceAddrTON
+	p.Fields[pdu.SourceAddrNPI] = c.Fields.SourceAddrNPI
+	if !isNumeric(m.Src) {
+		// alphanumeric sender
+		p.Fields[pdu.SourceAddrTON] = uint8(5)
+		p.Fields[pdu.SourceAddrNPI] = uint8(0)
+	}
+	p.Fields[pdu.SourceAddr] = m.Src
+	p.Fields[pdu.DestAddrTON] = c.Fields.DestAddrTON
+	p.Fields[pdu.DestAddrNPI] = c.Fields.DestAddrNPI
+	p.Fields[pdu.DestinationAddr] = strings.TrimPrefix(m.Dst, "+")
+	p.Fields[pdu.ESMClass] = c.Fields.ESMClass
+	p.Fields[pdu.ProtocolID] = c.Fields.ProtocolID
+	p.Fields[pdu.PriorityFlag] = c.Fields.PriorityFlag
+	p.Fields[pdu.ScheduleDeliveryTime] = c.Fields.ScheduleDeliveryTime
+	p.Fields[pdu.ReplaceIfPresentFlag] = c.Fields.ReplaceIfPresentFlag
+	p.Fields[pdu.SMDefaultMsgID] = c.Fields.SMDefaultMsgID
+	return p
+}
+
+// submitSMs builds submit_sm PDUs for all segments of a message. Segments of a multipart message carry
+// concatenation UDH with reference number ref, and delivery receipt is only asked for last one.
+func submitSMs(m *message.Message, c config.Conn, ref uint8) []*pdu.PDU {
+	msg := m.RealMsg
+	if msg == "" {
+		msg = m.Msg
+	}
+	parts := segment.Split(msg, message.Coding(m.Enc))
+	ps := make([]*pdu.PDU, len(parts))
+	for i, part := range parts {
+		p := submitSM(m, c)
+		text, dataCoding := message.Encode(part, m.Enc, m.IsFlash)
+		p.Fields[pdu.DataCoding] = dataCoding
+		if len(parts) > 1 {
+			text = append(segment.UDH(ref, len(parts), i+1), text...)
+			p.Fields[pdu.ESMClass] = p.Fields.Uint8(pdu.ESMClass) | esmClassUDHI
+		}
+		p.Fields[pdu.ShortMessage] = text
+		if i == len(parts)-1 {
+			p.Fields[pdu.RegisteredDelivery] = uint8(1)
+		}
+		ps[i] = p
+	}
+	return ps
+}
+
+func isNumeric(s string) bool {
+	s = strings.TrimPrefix(s, "+")
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,88 @@
+// Package e164 normalizes phone numbers to E.164 format, which is + followed by country code and subscriber number
+// with at most 15 digits in total, such as +971501234567.
+package e164
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const (
+	// MinLength is minimum number of digits in a number including its country code
+	MinLength = 7
+	// MaxLength is maximum number of digits in a number including its country code
+	MaxLength = 15
+)
+
+// ErrNoCountryCode is returned for a number in national format if no default country code is given
+var ErrNoCountryCode = errors.New("number is in national format and no default country code is set")
+
+// separators are characters commonly used to format numbers which are removed before normalizing
+var separators = strings.NewReplacer(" ", "", "-", "", ".", "", "(", "", ")", "", "\t", "", "\u00a0", "")
+
+// Normalize returns number in E.164 format.
+// A number starting with + or 00 is in international format. A number starting with a single 0 is in national format,
+// its trunk prefix 0 is replaced with countryCode. So with countryCode 971, 0501234567, +971501234567, 00971501234567
+// and 971 50 123 4567 are all +971501234567.
+// Any other number begins with its country code if it begins with countryCode or no countryCode is given. Otherwise
+// it's national if it's too short to have a country code, such as 501234 with countryCode 971, and it's rejected as
+// ambiguous if it could be either, such as 501234567, which is +971501234567 or +501234567.
+func Normalize(number, countryCode string) (string, error) {
+	num := separators.Replace(strings.TrimSpace(number))
+	cc := strings.TrimPrefix(countryCode, "+")
+	switch {
+	case strings.HasPrefix(num, "+"):
+		num = num[1:]
+	case strings.HasPrefix(num, "00"):
+		num = num[2:]
+	case strings.HasPrefix(num, "0"):
+		if countryCode == "" {
+			return "", ErrNoCountryCode
+		}
+		if !ValidCountryCode(countryCode) {
+			return "", fmt.Errorf("country code %s is invalid", countryCode)
+		}
+		num = cc + num[1:]
+	case countryCode != "" && !strings.HasPrefix(num, cc) && digits(num):
+		if !ValidCountryCode(countryCode) {
+			return "", fmt.Errorf("country code %s is invalid", countryCode)
+		}
+		national := len(cc)+len(num) >= MinLength && len(cc)+len(num) <= MaxLength
+		international := len(num) >= MinLength && len(num) <= MaxLength
+		if national && international {
+			return "", fmt.Errorf("number %s is ambiguous; write it with + and country code or with 0 in national format", number)
+		}
+		if national {
+			num = cc + num
+		}
+	}
+	if !digits(num) {
+		return "", fmt.Errorf("number %s must only have digits optionally starting with + or 00", number)
+	}
+	if strings.HasPrefix(num, "0") {
+		return "", fmt.Errorf("number %s doesn't have a valid country code", number)
+	}
+	if len(num) < MinLength || len(num) > MaxLength {
+		return "", fmt.Errorf("number %s must have %d to %d digits including country code", number, MinLength, MaxLength)
+	}
+	return "+" + num, nil
+}
+
+// ValidCountryCode returns true if cc is one to three digits optionally starting with +
+func ValidCountryCode(cc string) bool {
+	cc = strings.TrimPrefix(cc, "+")
+	return len(cc) > 0 && len(cc) <= 3 && cc[0] != '0' && digits(cc)
+}
+
+func digits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
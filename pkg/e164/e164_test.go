@@ -0,0 +1,44 @@
+package e164
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestNormalize(t *testing.T) {
+	assert := assert.New(t)
+	for _, in := range []string{"0501234567", "+971501234567", "00971501234567", "971 50 123-4567", "+971 (50) 123 4567"} {
+		num, err := Normalize(in, "971")
+		assert.Nil(err, in)
+		assert.Equal("+971501234567", num, in)
+	}
+	num, err := Normalize("0501234567", "+92")
+	assert.Nil(err)
+	assert.Equal("+92501234567", num)
+	_, err = Normalize("0501234567", "")
+	assert.Equal(ErrNoCountryCode, err)
+	_, err = Normalize("+9715012345678901", "971")
+	assert.EqualError(err, "number +9715012345678901 must have 7 to 15 digits including country code")
+	_, err = Normalize("012", "971")
+	assert.EqualError(err, "number 012 must have 7 to 15 digits including country code")
+	_, err = Normalize("+97150abc", "971")
+	assert.EqualError(err, "number +97150abc must only have digits optionally starting with + or 00")
+	_, err = Normalize("000971501234567", "971")
+	assert.EqualError(err, "number 000971501234567 doesn't have a valid country code")
+	// number without prefix which doesn't begin with default country code
+	num, err = Normalize("501234", "971")
+	assert.Nil(err)
+	assert.Equal("+971501234", num)
+	_, err = Normalize("501234567", "971")
+	assert.EqualError(err, "number 501234567 is ambiguous; write it with + and country code or with 0 in national format")
+	num, err = Normalize("501234567", "")
+	assert.Nil(err)
+	assert.Equal("+501234567", num)
+	num, err = Normalize("4479111234567", "971")
+	assert.Nil(err)
+	assert.Equal("+4479111234567", num)
+	assert.True(ValidCountryCode("+1"))
+	assert.False(ValidCountryCode("1234"))
+	assert.False(ValidCountryCode("01"))
+}
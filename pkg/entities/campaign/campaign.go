@@ -9,6 +9,8 @@ import (
 // Store is interface for campaign store implementations
 type Store interface {
 	Save(campaign *Campaign) (int64, error)
+	// Delete removes a campaign which has no job or messages
+	Delete(ID int64) error
 	List(criteria *Criteria) ([]Campaign, error)
 	Progress(ID int64) (Progress, error)
 	Report(ID int64) (Report, error)
@@ -22,9 +24,11 @@ type Campaign struct {
 	Msg         string `db:"msg"`
 	Priority    int    `db:"priority"`
 	FileID      int64  `db:"numfileid"`
+	TemplateID  int64  `db:"templateid"`
 	Username    string `db:"username"`
 	SendBefore  string `db:"sendbefore"`
 	SendAfter   string `db:"sendafter"`
+	TimeZone    string `db:"timezone"`
 	ScheduledAt int64  `db:"scheduledat"`
 	SubmittedAt int64  `db:"submittedat"`
 	Total       int    `db:"total"`
@@ -57,6 +61,8 @@ type Report struct {
 	Throughput    string
 	PerConnection string
 	Connections   []groupCount
+	// Paused is number of messages in campaign which are paused, campaign is paused if it's more than zero
+	Paused int
 }
 
 // groupCount is data structure to save results of .group(field).count() queries.
@@ -69,11 +75,14 @@ type groupCount struct {
 // Current map of progress is like this:
 // "Total":        int,
 // "Queued":       int,
+// "Sending":      int,
 // "Delivered":    int,
 // "NotDelivered": int,
 // "Sent":         int,
 // "Error":        int,
 // "Scheduled":    int,
 // "Stopped":      int,
+// "Paused":       int,
+// "Held":         int,
 // "Pending":      int,
 type Progress map[string]int
@@ -0,0 +1,166 @@
+package file
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// destinationHeader is name of column which has numbers in a file with header
+const destinationHeader = "Destination"
+
+// csvRows reads rows of a csv or txt file one line at a time. First line is header if it has a Destination column,
+// values of other columns in header are params of rows. A single column header such as "Number" is skipped.
+// Without a header, every value in file is a number, so numbers can be separated by commas, new lines or both.
+type csvRows struct {
+	name   string
+	reader *csv.Reader
+	// keys are columns of header, they're nil if file doesn't have a header
+	keys []string
+	dst  int
+	// pending are numbers left in current line of a file without header
+	pending []string
+	line    int
+	started bool
+}
+
+func newCSVRows(name string, reader io.Reader) *csvRows {
+	r := csv.NewReader(reader)
+	// number of values can be different in every line of a list
+	r.FieldsPerRecord = -1
+	r.TrimLeadingSpace = true
+	return &csvRows{name: name, reader: r}
+}
+
+func (c *csvRows) Next() (Row, error) {
+	if !c.started {
+		c.started = true
+		if err := c.readHeader(); err != nil {
+			return Row{}, err
+		}
+	}
+	if c.keys != nil {
+		return c.nextRecord()
+	}
+	for len(c.pending) == 0 {
+		record, err := c.read()
+		if err != nil {
+			return Row{}, err
+		}
+		c.pending = nonEmpty(record)
+	}
+	num := strings.Trim(c.pending[0], trimSet)
+	c.pending = c.pending[1:]
+	return Row{Destination: num, Line: c.line}, nil
+}
+
+// readHeader reads first line of file and keeps it as header if it is one
+func (c *csvRows) readHeader() error {
+	record, err := c.read()
+	if err != nil {
+		return err
+	}
+	if len(record) > 0 {
+		// excel adds byte order mark to csv files saved as UTF-8
+		record[0] = strings.TrimPrefix(record[0], "\ufeff")
+	}
+	c.dst = -1
+	for i, v := range record {
+		if strings.EqualFold(strings.Trim(v, trimSet), destinationHeader) {
+			c.dst = i
+			break
+		}
+	}
+	if c.dst != -1 {
+		c.keys = make([]string, len(record))
+		for i, v := range record {
+			c.keys[i] = strings.Trim(v, trimSet)
+			if c.keys[i] == "" {
+				return fmt.Errorf("header on line %d in file %s has an empty column at column number %d", c.line, c.name, i+1)
+			}
+		}
+		return nil
+	}
+	values := nonEmpty(record)
+	if len(values) == 1 && !isNumber(values[0]) {
+		return nil
+	}
+	if len(values) > 1 && !isNumber(values[0]) {
+		return fmt.Errorf("header on line %d in file %s must have a %s column", c.line, c.name, destinationHeader)
+	}
+	c.pending = values
+	return nil
+}
+
+// nextRecord returns row of next line of a file with header
+func (c *csvRows) nextRecord() (Row, error) {
+	var record []string
+	for len(nonEmpty(record)) == 0 {
+		var err error
+		if record, err = c.read(); err != nil {
+			return Row{}, err
+		}
+	}
+	if len(record) < len(c.keys) {
+		return Row{}, fmt.Errorf("line %d in file %s has blank values for some parameters", c.line, c.name)
+	}
+	if len(record) > len(c.keys) {
+		return Row{}, fmt.Errorf("line %d in file %s has more values than columns in header", c.line, c.name)
+	}
+	num := strings.Trim(record[c.dst], trimSet)
+	row := Row{
+		Destination: num,
+		Params:      map[string]string{},
+		Line:        c.line,
+	}
+	for i, key := range c.keys {
+		if i == c.dst {
+			continue
+		}
+		val := strings.Trim(record[i], trimSet)
+		if val == "" {
+			return row, fmt.Errorf("line %d in file %s contains no value at column %s", c.line, c.name, key)
+		}
+		row.Params[key] = val
+	}
+	return row, nil
+}
+
+// read returns next record of file and keeps number of its line
+func (c *csvRows) read() ([]string, error) {
+	record, err := c.reader.Read()
+	if err == io.EOF {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't parse file %s: %s", c.name, err)
+	}
+	c.line, _ = c.reader.FieldPos(0)
+	return record, nil
+}
+
+// nonEmpty returns values which aren't blank
+func nonEmpty(values []string) []string {
+	var vals []string
+	for _, v := range values {
+		if strings.Trim(v, trimSet) != "" {
+			vals = append(vals, v)
+		}
+	}
+	return vals
+}
+
+// isNumber returns true if s has only digits with an optional leading +
+func isNumber(s string) bool {
+	s = strings.TrimPrefix(strings.Trim(s, trimSet), "+")
+	if s == "" {
+		return false
+	}
+	for _, ch := range s {
+		if ch < '0' || ch > '9' {
+			return false
+		}
+	}
+	return true
+}
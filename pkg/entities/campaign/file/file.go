@@ -3,21 +3,19 @@ package file
 import (
 	"fmt"
 	"io"
-	"io/ioutil"
 	"strings"
-
-	"github.com/haisum/smpp-app/pkg/stringutils"
 )
 
 // Store represents a numbers file store
 type Store interface {
 	List(c *Criteria) ([]File, error)
 	Delete(f *File) error
-	Save(f *File, processExcelFunc ProcessExcelFunc, reader io.ReadCloser, writer io.WriteCloser) (int64, error)
+	// Save validates numbers in file, normalizing them with countryCode, then writes file to writer and saves it
+	Save(f *File, processExcelFunc ProcessExcelFunc, countryCode string, reader io.ReadCloser, writer io.WriteCloser) (int64, error)
 }
 
-// ProcessExcelFunc takes a io.Reader as parameter
-type ProcessExcelFunc func(reader io.Reader) (map[string]Row, error)
+// ProcessExcelFunc takes a io.Reader as parameter and returns rows of excel file read from it
+type ProcessExcelFunc func(reader io.Reader) (Rows, error)
 
 // File represents file uploaded to system for saving
 // files with numbers
@@ -43,9 +41,10 @@ func (n *Type) Scan(nf interface{}) error {
 }
 
 const (
-	// CSV is text file with .csv extension. This file should have comma separated numbers
+	// CSV is text file with .csv extension. This file can be a list of numbers separated by commas or new lines,
+	// or have a header row with a Destination column and parameter columns which follow same structure as XLSX
 	CSV Type = ".csv"
-	// TXT is text file with .txt extension. This file should have comma separated numbers
+	// TXT is text file with .txt extension. It's read same as CSV
 	TXT = ".txt"
 	// XLSX is excel file with .xlsx extension. These files should follow following structure:
 	// -----------------------------------------
@@ -64,8 +63,13 @@ const (
 
 // Row represents one single Row in excel or csv file
 type Row struct {
+	// Destination is number in E.164 format
 	Destination string
 	Params      map[string]string
+	// Original is number as it was written in file
+	Original string
+	// Line is line of csv file or row of xlsx sheet the number was read from, it's zero if number wasn't in a file
+	Line int
 }
 
 // Criteria represents filters we can give to GetFiles method.
@@ -97,37 +101,3 @@ func RowsFromString(numbers string) []Row {
 	}
 	return nums
 }
-
-// ToNumbers reads a csv or xlsx file and returns array of Row with Destination and Params map
-func ToNumbers(f *File, processExcel ProcessExcelFunc, reader io.Reader) ([]Row, error) {
-	var numbers []Row
-	numberMap := make(map[string]Row) // used for unique numbers
-	if f.Type == CSV || f.Type == TXT {
-		b, err := ioutil.ReadAll(reader)
-		if err != nil {
-			return numbers, err
-		}
-		for i, num := range strings.Split(stringutils.ByteToString(b), ",") {
-			num = strings.Trim(num, "\t\n\v\f\r \u0085\u00a0")
-			if len(num) > 15 || len(num) < 5 {
-				return numbers, fmt.Errorf("entry number %d in file %s is invalid; number must be greater than 5 characters and lesser than 16; please fix it and retry", i+1, f.Name)
-			}
-			numberMap[num] = Row{Destination: num}
-		}
-	} else if f.Type == XLSX {
-		var err error
-		numberMap, err = processExcel(reader)
-		if err != nil {
-			return numbers, err
-		}
-	} else {
-		return numbers, fmt.Errorf("this file type isn't supported yet")
-	}
-	if len(numberMap) < 1 {
-		return numbers, fmt.Errorf("no numbers given in file")
-	}
-	for _, v := range numberMap {
-		numbers = append(numbers, v)
-	}
-	return numbers, nil
-}
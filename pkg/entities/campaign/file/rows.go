@@ -0,0 +1,138 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/haisum/smpp-app/pkg/e164"
+)
+
+// Rows is an iterator over rows of a file. Next returns io.EOF when there are no more rows.
+type Rows interface {
+	Next() (Row, error)
+}
+
+// trimSet are characters trimmed from numbers
+const trimSet = "\t\n\v\f\r \u0085\u00a0"
+
+// NewRows returns rows of a csv or xlsx file read from reader. Rows are read as they're asked for, in order of file.
+// Destinations are normalized to E.164 format with countryCode as default country code and a destination which has
+// already appeared in file is skipped.
+func NewRows(f *File, processExcel ProcessExcelFunc, reader io.Reader, countryCode string) (Rows, error) {
+	var (
+		rows Rows
+		err  error
+	)
+	switch f.Type {
+	case CSV, TXT:
+		rows = newCSVRows(f.Name, reader)
+	case XLSX:
+		rows, err = processExcel(reader)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("this file type isn't supported yet")
+	}
+	return Unique(Normalize(rows, f.Name, countryCode)), nil
+}
+
+// StringRows returns rows of comma separated numbers normalized to E.164 format, duplicate numbers are skipped
+func StringRows(numbers string, countryCode string) Rows {
+	return Unique(Normalize(&sliceRows{rows: RowsFromString(numbers)}, "", countryCode))
+}
+
+// Normalize returns rows whose destinations are converted to E.164 format with countryCode as default country code.
+// Destination as it was read is kept in Original. name is used in errors if rows are read from a file.
+func Normalize(rows Rows, name, countryCode string) Rows {
+	return &normalizedRows{rows: rows, name: name, countryCode: countryCode}
+}
+
+type normalizedRows struct {
+	rows        Rows
+	name        string
+	countryCode string
+}
+
+func (n *normalizedRows) Next() (Row, error) {
+	r, err := n.rows.Next()
+	if err != nil {
+		return r, err
+	}
+	r.Original = r.Destination
+	r.Destination, err = e164.Normalize(r.Original, n.countryCode)
+	if err != nil {
+		if n.name != "" && r.Line > 0 {
+			return r, fmt.Errorf("number %s on line %d in file %s is invalid; %s", r.Original, r.Line, n.name, err)
+		}
+		if n.name != "" {
+			return r, fmt.Errorf("number %s in file %s is invalid; %s", r.Original, n.name, err)
+		}
+		return r, fmt.Errorf("number %s is invalid; %s", r.Original, err)
+	}
+	return r, nil
+}
+
+// Each calls fn for every row until rows are exhausted. It stops at first error returned by rows or fn.
+func Each(rows Rows, fn func(r Row) error) error {
+	for {
+		r, err := rows.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(r); err != nil {
+			return err
+		}
+	}
+}
+
+type sliceRows struct {
+	rows []Row
+	i    int
+}
+
+func (s *sliceRows) Next() (Row, error) {
+	if s.i >= len(s.rows) {
+		return Row{}, io.EOF
+	}
+	s.i++
+	return s.rows[s.i-1], nil
+}
+
+// ErrNoNumbers is returned by rows of a file which doesn't have any number
+var ErrNoNumbers = errors.New("no numbers given in file")
+
+// Unique returns rows which skip destinations returned before. Every distinct destination is kept in memory, so
+// memory used grows with number of distinct destinations, it's bounded by MaxFileSize for rows of a file.
+// Params of rows aren't kept. Unique returns ErrNoNumbers if rows are empty.
+func Unique(rows Rows) Rows {
+	return &uniqueRows{rows: rows, seen: make(map[string]struct{})}
+}
+
+type uniqueRows struct {
+	rows Rows
+	seen map[string]struct{}
+	n    int
+}
+
+func (u *uniqueRows) Next() (Row, error) {
+	for {
+		r, err := u.rows.Next()
+		if err == io.EOF && u.n == 0 {
+			return r, ErrNoNumbers
+		}
+		if err != nil {
+			return r, err
+		}
+		if _, ok := u.seen[r.Destination]; ok {
+			continue
+		}
+		u.seen[r.Destination] = struct{}{}
+		u.n++
+		return r, nil
+	}
+}
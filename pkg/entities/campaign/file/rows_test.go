@@ -0,0 +1,69 @@
+package file
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func readAll(rows Rows) ([]Row, error) {
+	var got []Row
+	err := Each(rows, func(r Row) error {
+		got = append(got, r)
+		return nil
+	})
+	return got, err
+}
+
+func TestNewRows(t *testing.T) {
+	assert := assert.New(t)
+	rows, err := NewRows(&File{Name: "numbers.csv", Type: CSV}, nil, strings.NewReader("971500000003, 971500000001,\n971500000003,0500000002,+971500000001"), "971")
+	assert.Nil(err)
+	got, err := readAll(rows)
+	assert.Nil(err)
+	assert.Equal([]Row{
+		{Destination: "+971500000003", Original: "971500000003", Line: 1},
+		{Destination: "+971500000001", Original: "971500000001", Line: 1},
+		{Destination: "+971500000002", Original: "0500000002", Line: 2},
+	}, got)
+
+	rows, _ = NewRows(&File{Name: "numbers.txt", Type: TXT}, nil, strings.NewReader("971500000003,123"), "")
+	_, err = readAll(rows)
+	assert.EqualError(err, "number 123 on line 1 in file numbers.txt is invalid; number 123 must have 7 to 15 digits including country code")
+
+	rows, _ = NewRows(&File{Name: "numbers.txt", Type: TXT}, nil, strings.NewReader(""), "")
+	_, err = readAll(rows)
+	assert.Equal(ErrNoNumbers, err)
+}
+
+func TestNewRows_CSV(t *testing.T) {
+	assert := assert.New(t)
+	// newline separated list with a header
+	rows, _ := NewRows(&File{Name: "numbers.csv", Type: CSV}, nil, strings.NewReader("Number\r\n971500000001\r\n\r\n+971500000002\r\n"), "")
+	got, err := readAll(rows)
+	assert.Nil(err)
+	assert.Equal([]Row{{Destination: "+971500000001", Original: "971500000001", Line: 2}, {Destination: "+971500000002", Original: "+971500000002", Line: 4}}, got)
+
+	// destination and param columns
+	rows, _ = NewRows(&File{Name: "numbers.csv", Type: CSV}, nil, strings.NewReader("\ufeffName,Destination,City\n\"Doe, John\",971500000001,Dubai\nAlice,971500000002,Paris\n"), "")
+	got, err = readAll(rows)
+	assert.Nil(err)
+	assert.Equal([]Row{
+		{Destination: "+971500000001", Original: "971500000001", Params: map[string]string{"Name": "Doe, John", "City": "Dubai"}, Line: 2},
+		{Destination: "+971500000002", Original: "971500000002", Params: map[string]string{"Name": "Alice", "City": "Paris"}, Line: 3},
+	}, got)
+
+	for in, msg := range map[string]string{
+		"Destination,Name\n971500000001,Bob\n971500000002\n":         "line 3 in file numbers.csv has blank values for some parameters",
+		"Destination,Name\n971500000001,Bob\n971500000002,\n":        "line 3 in file numbers.csv contains no value at column Name",
+		"Destination,Name\n971500000001,Bob\n\n\n123,Alice\n":        "number 123 on line 5 in file numbers.csv is invalid; number 123 must have 7 to 15 digits including country code",
+		"Destination,Name\n971500000001,Bob\n971500000002,\"Al\"x\n": "couldn't parse file numbers.csv: parse error on line 3, column 17: extraneous or missing \" in quoted-field",
+		"Number,Name\n971500000001,Bob\n":                            "header on line 1 in file numbers.csv must have a Destination column",
+		"Destination\n0501234567\n":                                  "number 0501234567 on line 2 in file numbers.csv is invalid; number is in national format and no default country code is set",
+	} {
+		rows, _ = NewRows(&File{Name: "numbers.csv", Type: CSV}, nil, strings.NewReader(in), "")
+		_, err = readAll(rows)
+		assert.EqualError(err, msg)
+	}
+}
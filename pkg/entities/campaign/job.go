@@ -0,0 +1,109 @@
+package campaign
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+)
+
+// JobStore is interface for campaign job store implementations
+type JobStore interface {
+	Add(j *Job) (int64, error)
+	// Update saves j only if its Version is same as in store and increments Version. It returns false if job was
+	// updated by another process since j was read.
+	Update(j *Job) (bool, error)
+	// Pause sets Paused of job of a campaign without changing its Version, so generator keeps generating messages
+	// but inserts them as paused
+	Pause(campaignID int64, paused bool) error
+	List(c *JobCriteria) ([]Job, error)
+}
+
+// JobStatus is state of a campaign job
+type JobStatus string
+
+// Scan implements scanner interface for JobStatus
+func (s *JobStatus) Scan(src interface{}) error {
+	*s = JobStatus(fmt.Sprintf("%s", src))
+	return nil
+}
+
+const (
+	// JobPending is a job which is saved but no message has been generated for it yet
+	JobPending JobStatus = "Pending"
+	// JobGenerating is a job whose messages are being inserted
+	JobGenerating JobStatus = "Generating"
+	// JobReady is a job whose messages are all inserted and are being sent
+	JobReady JobStatus = "Ready"
+	// JobCompleted is a job whose campaign has no pending messages left
+	JobCompleted JobStatus = "Completed"
+	// JobFailed is a job whose messages couldn't be generated, Error has reason
+	JobFailed JobStatus = "Failed"
+	// JobStopping is a job whose campaign was stopped while its messages were being generated. Generator stops
+	// inserting its messages and refunds segments of messages it hasn't inserted.
+	JobStopping JobStatus = "Stopping"
+	// JobStopped is a job whose campaign was stopped
+	JobStopped JobStatus = "Stopped"
+)
+
+// Job is persisted state of generating messages of a campaign. Messages are inserted in batches and Checkpoint
+// is saved after every batch so an interrupted job can be resumed from where it stopped.
+type Job struct {
+	ID         int64     `db:"id" goqu:"skipinsert"`
+	CampaignID int64     `db:"campaignid"`
+	Status     JobStatus `db:"status"`
+	// Checkpoint is number of recipients whose messages have been inserted
+	Checkpoint int `db:"checkpoint"`
+	// Total is number of recipients of campaign
+	Total int `db:"total"`
+	// Segments is number of segments charged when campaign was started
+	Segments int64 `db:"segments"`
+	// Paused is true if campaign was paused, generator inserts messages of a paused campaign as Paused
+	Paused bool `db:"paused"`
+	// Params are request values needed to generate messages again, they aren't exposed because Msg is unmasked
+	Params    JobParams `db:"params" json:"-"`
+	Error     string    `db:"error"`
+	Version   int       `db:"version"`
+	UpdatedAt int64     `db:"updatedat"`
+}
+
+// JobParams are values of a start request which aren't saved in campaign
+type JobParams struct {
+	// Msg is unmasked text of campaign
+	Msg string
+	// Numbers is comma separated list of recipients if campaign doesn't have a file
+	Numbers         string
+	ConnectionGroup string
+	IsFlash         bool
+	AllowMissing    bool
+	Defaults        map[string]string
+	// CountryCode is default country code of user's group when campaign was started, numbers are normalized with
+	// same code when job is resumed
+	CountryCode string
+}
+
+// Scan implements scanner interface for JobParams
+func (p *JobParams) Scan(src interface{}) error {
+	b, ok := src.([]byte)
+	if !ok {
+		b = []byte(fmt.Sprintf("%s", src))
+	}
+	return json.Unmarshal(b, p)
+}
+
+// Value implements driver.Valuer interface
+func (p JobParams) Value() (driver.Value, error) {
+	b, err := json.Marshal(p)
+	return string(b), err
+}
+
+// JobCriteria represents filters we can give to JobStore.List
+type JobCriteria struct {
+	CampaignID    int64
+	Statuses      []JobStatus
+	UpdatedBefore int64
+}
+
+// Done returns true if job won't change anymore
+func (j *Job) Done() bool {
+	return j.Status == JobCompleted || j.Status == JobFailed
+}
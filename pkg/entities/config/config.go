@@ -0,0 +1,133 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/haisum/smpp-app/pkg/e164"
+	"github.com/haisum/smpp-app/pkg/errs"
+)
+
+// Store is interface for config store implementations
+type Store interface {
+	Get() (*Config, error)
+	Save(c *Config) error
+}
+
+// pfxRegex matches a valid number prefix such as +97105
+var pfxRegex = regexp.MustCompile(`^\+?[0-9]{1,15}$`)
+
+// Config is application wide configuration stored in settings table
+type Config struct {
+	ConnGroups []ConnGroup
+}
+
+// ConnGroup is a named group of SMPP connections. Users are assigned to a group by User.ConnectionGroup
+// and their messages are sent through connections of that group only.
+type ConnGroup struct {
+	Name       string
+	Conns      []Conn
+	DefaultPfx string
+	// CountryCode is prepended to numbers in national format, such as 0501234567, sent by users of group
+	CountryCode string
+}
+
+// Conn is configuration of a single SMPP connection
+type Conn struct {
+	ID   string
+	URL  string
+	User string
+	// Passwd is password for SMPP bind
+	Passwd string
+	// Receiver is address of a separate receiver bind. If empty, a transceiver session is bound on URL.
+	Receiver string
+	Pfxs     []string
+	// Size is number of messages allowed per Time seconds
+	Size   int32
+	Time   int
+	Fields Fields
+}
+
+// Fields are default submit_sm fields for a connection
+type Fields struct {
+	ServiceType          string
+	SourceAddrTON        uint8
+	SourceAddrNPI        uint8
+	DestAddrTON          uint8
+	DestAddrNPI          uint8
+	ESMClass             uint8
+	ProtocolID           uint8
+	PriorityFlag         uint8
+	ScheduleDeliveryTime string
+	ReplaceIfPresentFlag uint8
+	SMDefaultMsgID       uint8
+}
+
+// Group returns connection group with given name
+func (c *Config) Group(name string) (ConnGroup, bool) {
+	for _, g := range c.ConnGroups {
+		if g.Name == name {
+			return g, true
+		}
+	}
+	return ConnGroup{}, false
+}
+
+// CountryCode returns default country code of group with given name. It's empty if group doesn't exist or has none.
+func (c *Config) CountryCode(group string) string {
+	g, _ := c.Group(group)
+	return g.CountryCode
+}
+
+// Validate performs sanity checks on config. Errors are keyed by path of invalid field such as "ConnGroups[0].Conns[1].ID".
+func (c *Config) Validate() error {
+	errMap := make(map[string]string)
+	groups := make(map[string]bool)
+	for i, g := range c.ConnGroups {
+		gKey := fmt.Sprintf("ConnGroups[%d]", i)
+		if g.Name == "" {
+			errMap[gKey+".Name"] = "group name can't be empty"
+		} else if groups[g.Name] {
+			errMap[gKey+".Name"] = fmt.Sprintf("group name %s is used more than once", g.Name)
+		}
+		groups[g.Name] = true
+		ids := make(map[string]bool)
+		pfxs := make(map[string]bool)
+		for j, conn := range g.Conns {
+			cKey := fmt.Sprintf("%s.Conns[%d]", gKey, j)
+			if conn.ID == "" {
+				errMap[cKey+".ID"] = "connection id can't be empty"
+			} else if ids[conn.ID] {
+				errMap[cKey+".ID"] = fmt.Sprintf("connection id %s is used more than once in group %s", conn.ID, g.Name)
+			}
+			ids[conn.ID] = true
+			if conn.URL == "" {
+				errMap[cKey+".URL"] = "connection url can't be empty"
+			}
+			if conn.Size < 1 || conn.Time < 1 {
+				errMap[cKey+".Size"] = "size and time must be greater than zero"
+			}
+			for k, pfx := range conn.Pfxs {
+				if !pfxRegex.MatchString(pfx) {
+					errMap[fmt.Sprintf("%s.Pfxs[%d]", cKey, k)] = fmt.Sprintf("prefix %s must be digits optionally starting with +", pfx)
+				}
+				pfxs[pfx] = true
+			}
+		}
+		if g.CountryCode != "" && !e164.ValidCountryCode(g.CountryCode) {
+			errMap[gKey+".CountryCode"] = fmt.Sprintf("country code %s must be one to three digits optionally starting with +", g.CountryCode)
+		}
+		if g.DefaultPfx == "" {
+			errMap[gKey+".DefaultPfx"] = "default prefix can't be empty"
+		} else if !pfxs[g.DefaultPfx] {
+			errMap[gKey+".DefaultPfx"] = fmt.Sprintf("default prefix %s isn't a prefix of any connection in group %s", g.DefaultPfx, g.Name)
+		}
+	}
+	if len(errMap) > 0 {
+		return &errs.ValidationError{
+			Message: "validation failed",
+			Errors:  errMap,
+		}
+	}
+	return nil
+}
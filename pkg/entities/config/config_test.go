@@ -0,0 +1,37 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/haisum/smpp-app/pkg/errs"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestConfig_Validate(t *testing.T) {
+	assert := assert.New(t)
+	conn := Conn{ID: "du-1", URL: "localhost:2775", Pfxs: []string{"+97105", "+97106"}, Size: 5, Time: 1}
+	c := Config{
+		ConnGroups: []ConnGroup{
+			{Name: "Default", Conns: []Conn{conn}, DefaultPfx: "+97105"},
+			{Name: "AADC", Conns: []Conn{conn}, DefaultPfx: "+97106"},
+		},
+	}
+	assert.Nil(c.Validate())
+
+	bad := conn
+	bad.Pfxs = []string{"97a"}
+	c = Config{
+		ConnGroups: []ConnGroup{
+			{Name: "Default", Conns: []Conn{conn, conn}, DefaultPfx: "+97107"},
+			{Name: "Default", Conns: []Conn{bad}, DefaultPfx: "97a"},
+		},
+	}
+	err := c.Validate()
+	assert.NotNil(err)
+	verrs := err.(*errs.ValidationError).Errors
+	assert.Contains(verrs, "ConnGroups[0].Conns[1].ID")
+	assert.Contains(verrs, "ConnGroups[0].DefaultPfx")
+	assert.Contains(verrs, "ConnGroups[1].Name")
+	assert.Contains(verrs, "ConnGroups[1].Conns[0].Pfxs[0]")
+	assert.Len(verrs, 4)
+}
@@ -0,0 +1,124 @@
+package credit
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/errs"
+)
+
+// Store is interface for credit ledger implementations
+type Store interface {
+	// Balance returns credits left with username, it's zero for a user who has never been topped up
+	Balance(username string) (int64, error)
+	// Add changes balance of e.Username by e.Amount and records e in ledger in a single transaction. A debit which
+	// would make balance negative isn't recorded and ErrInsufficientBalance is returned. Balance and ID of e are set
+	// after it's saved.
+	Add(e *Entry) error
+	Ledger(c *Criteria) ([]Entry, error)
+}
+
+// ErrInsufficientBalance is returned when user doesn't have enough credits for a debit
+var ErrInsufficientBalance = errors.New("insufficient balance")
+
+// BalanceError returns error response of a request which needs more credits than balance of its user
+func BalanceError(needed, balance int64) errs.ErrorResponse {
+	return errs.ErrorResponse{
+		Errors: []errs.ResponseError{
+			{
+				Type:    errs.ErrorTypeRequest,
+				Message: fmt.Sprintf("Insufficient balance. %d credits are needed but only %d are left.", needed, balance),
+			},
+		},
+	}
+}
+
+// Charge debits segments of messages of campaignID, or of a single message if it's zero, from balance of username.
+// Error returned by BalanceError is returned if balance isn't enough.
+func Charge(store Store, username string, segments int64, campaignID int64, note string) error {
+	e := Entry{
+		Username:   username,
+		Kind:       Debit,
+		Amount:     -segments,
+		CampaignID: campaignID,
+		Note:       note,
+		CreatedAt:  time.Now().UTC().Unix(),
+	}
+	err := store.Add(&e)
+	if err == ErrInsufficientBalance {
+		balance, _ := store.Balance(username)
+		return BalanceError(segments, balance)
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't charge %d segments: %s", segments, err)
+	}
+	return nil
+}
+
+// RefundSegments returns segments of messages of campaignID, or of a single message if it's zero, which won't be sent to
+// balance of username. Nothing is recorded if segments is zero.
+func RefundSegments(store Store, username string, segments int64, campaignID int64, note string) error {
+	if segments == 0 {
+		return nil
+	}
+	e := Entry{
+		Username:   username,
+		Kind:       Refund,
+		Amount:     segments,
+		CampaignID: campaignID,
+		Note:       note,
+		CreatedAt:  time.Now().UTC().Unix(),
+	}
+	return store.Add(&e)
+}
+
+// Kind is reason of a ledger entry
+type Kind string
+
+// Scan implements scanner interface for Kind
+func (k *Kind) Scan(src interface{}) error {
+	*k = Kind(fmt.Sprintf("%s", src))
+	return nil
+}
+
+const (
+	// TopUp is credit added by an admin
+	TopUp Kind = "Top up"
+	// Debit is charge for segments of messages when they're queued
+	Debit Kind = "Debit"
+	// Refund is credit returned for segments of messages which ended in Error or Stopped, or were suppressed
+	Refund Kind = "Refund"
+)
+
+// Entry is a change in balance of a user. One credit is charged for every segment of a message.
+type Entry struct {
+	ID       int64  `db:"id" goqu:"skipinsert"`
+	Username string `db:"username"`
+	Kind     Kind   `db:"kind"`
+	// Amount is positive for top ups and refunds and negative for debits
+	Amount int64 `db:"amount"`
+	// Balance is balance of user after this entry
+	Balance    int64  `db:"balance"`
+	MessageID  int64  `db:"messageid"`
+	CampaignID int64  `db:"campaignid"`
+	Note       string `db:"note"`
+	// AddedBy is username of admin for top ups
+	AddedBy   string `db:"addedby"`
+	CreatedAt int64  `db:"createdat"`
+}
+
+// Criteria represents filters we can give to Ledger method.
+type Criteria struct {
+	ID            int64
+	Username      string
+	Kind          Kind
+	MessageID     int64
+	CampaignID    int64
+	CreatedAfter  int64
+	CreatedBefore int64
+	OrderByKey    string
+	OrderByDir    string
+	From          string
+	PerPage       uint
+}
@@ -0,0 +1,41 @@
+package inbound
+
+// Store is interface for inbound message store implementations
+type Store interface {
+	Save(m *Message) (int64, error)
+	List(c *Criteria) ([]Message, error)
+}
+
+// EncBinary is encoding of a message whose data coding isn't text, its Msg is hex encoded
+const EncBinary = "binary"
+
+// Message is a mobile originated message received from an SMSC in a deliver_sm which isn't a delivery receipt
+type Message struct {
+	ID  int64  `db:"id" goqu:"skipinsert"`
+	Src string `db:"src"`
+	// Dst is short code or long number message was sent to
+	Dst string `db:"dst"`
+	Msg string `db:"msg"`
+	Enc string `db:"enc"`
+	// Connection is id of connection message was received on
+	Connection string `db:"connection"`
+	// Username is user who owns Dst, it's empty if Dst doesn't belong to any user
+	Username   string `db:"username"`
+	ReceivedAt int64  `db:"receivedat"`
+}
+
+// Criteria represents filters we can give to List method.
+type Criteria struct {
+	ID             int64
+	Username       string
+	Src            string
+	Dst            string
+	Enc            string
+	Connection     string
+	ReceivedAfter  int64
+	ReceivedBefore int64
+	OrderByKey     string
+	OrderByDir     string
+	From           string
+	PerPage        uint
+}
@@ -1,11 +1,15 @@
 package message
 
 import (
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
 
 	"github.com/fiorix/go-smpp/smpp/pdu/pdutext"
+	"github.com/haisum/smpp-app/pkg/gsm7"
+	"github.com/haisum/smpp-app/pkg/segment"
+	"github.com/haisum/smpp-app/pkg/stringutils"
 )
 
 // Store is interface for message store implementations
@@ -13,13 +17,31 @@ type Store interface {
 	Save(m *Message) (int64, error)
 	SaveBulk(m []Message) ([]int64, error)
 	Update(m *Message) error
+	// UpdateFrom updates m only if its status in store is still from. It returns false if status has been changed,
+	// for example because campaign of message was stopped or paused.
+	UpdateFrom(m *Message, from Status) (bool, error)
 	Get(id int64) (*Message, error)
 	List(c *Criteria) ([]Message, error)
 	Stats(c *Criteria) (*Stats, error)
-	StopPending(campID int64) (int64, error)
+	// StopPending stops pending messages of a campaign and returns number of stopped messages and their segments
+	StopPending(campID int64) (stopped int64, segments int64, err error)
+	PausePending(campID int64) (int64, error)
+	ResumePaused(campID int64, now int64) (int64, error)
+	ReleaseHeld(connectionGroup string, now int64) (int64, error)
+	// ReleaseSending queues messages of a connection group which were claimed for sending by a dispatcher which
+	// stopped before it could update them
+	ReleaseSending(connectionGroup string) (int64, error)
+	PromoteScheduled(now int64, limit uint) (int64, error)
+	Retry(c RetryCriteria, now int64) (retried int64, exhausted int64, err error)
+	// SaveDelivery saves receipt of message with respID which was sent on connection conn. Message is matched by
+	// respID only if conn is empty, since SMSCs can give same id to messages of different connections.
+	SaveDelivery(conn, respID string, status Status, deliveredAt int64, deliverySM map[string]string) error
 	MaxInsertCount() int
 }
 
+// ErrNotFound is returned when a message couldn't be found in store
+var ErrNotFound = errors.New("message not found")
+
 // Message represents a pkg message inside db
 type Message struct {
 	ID              int64  `db:"id" goqu:"skipinsert"`
@@ -30,9 +52,11 @@ type Message struct {
 	Username        string `db:"username"`
 	Msg             string `db:"msg"`
 	// RealMsg is unmasked version of msg, this shouldn't be exposed to user
-	RealMsg     string `json:"-" db:"realmsg"`
-	Enc         string `db:"enc"`
-	Dst         string `db:"dst"`
+	RealMsg string `json:"-" db:"realmsg"`
+	Enc     string `db:"enc"`
+	Dst     string `db:"dst"`
+	// OriginalDst is destination as it was given by user, before it was normalized to E.164 format in Dst
+	OriginalDst string `db:"originaldst"`
 	Src         string `db:"src"`
 	Priority    int    `db:"priority"`
 	QueuedAt    int64  `db:"queuedat"`
@@ -44,8 +68,14 @@ type Message struct {
 	Error       string `db:"error"`
 	SendBefore  string `db:"sendbefore"`
 	SendAfter   string `db:"sendafter"`
+	// TimeZone is IANA name of time zone of SendAfter and SendBefore, UTC if empty
+	TimeZone    string `db:"timezone"`
 	ScheduledAt int64  `db:"scheduledat"`
-	IsFlash     bool   `db:"isflash"`
+	// HeldUntil is time at which send window of a Held message opens
+	HeldUntil int64 `db:"helduntil"`
+	IsFlash   bool  `db:"isflash"`
+	// Retries is number of times message was requeued after failing
+	Retries int `db:"retries"`
 }
 
 // Validate validates a message and returns error messages if any
@@ -60,12 +90,17 @@ func (m *Message) Validate() []string {
 	if m.Src == "" {
 		errs = append(errs, "Source address can't be empty.")
 	}
-	if m.Enc != "ucs" && m.Enc != "latin" {
-		errs = append(errs, "Encoding can either be latin or UCS")
+	if m.Enc != EncUCS && m.Enc != EncLatin && m.Enc != EncGSM {
+		errs = append(errs, "Encoding can either be gsm, latin or UCS")
+	} else if Total(m.Msg, m.Enc) > segment.MaxParts {
+		errs = append(errs, TooLongMessage)
 	}
 	if (m.SendAfter == "" && m.SendBefore != "") || (m.SendBefore == "" && m.SendAfter != "") {
 		errs = append(errs, "Send before time and Send after time, both should be provided at a time.")
 	}
+	if _, err := LoadLocation(m.TimeZone); err != nil {
+		errs = append(errs, "Time zone must be a valid IANA time zone such as \"Asia/Dubai\".")
+	}
 	parts := strings.Split(m.SendAfter, ":")
 	if m.SendAfter != "" {
 		if len(parts) != 2 {
@@ -127,16 +162,38 @@ type Criteria struct {
 	DisableOrder    bool
 }
 
+// RetryCriteria selects failed messages of a campaign which should be queued again
+type RetryCriteria struct {
+	CampaignID int64
+	// Statuses to retry, only Error and NotDelivered make sense
+	Statuses []Status
+	// ErrorCodes if not empty limits retry to messages whose Error or delivery receipt err field is one of these
+	ErrorCodes []string
+	// MaxRetries is number of retries after which a message isn't retried anymore
+	MaxRetries int
+	// Charge if not nil is called with number of segments of messages which will be retried before they're queued,
+	// messages aren't retried if it returns an error
+	Charge func(segments int64) error
+}
+
 // Stats records number of messages in different statuses.
 type Stats struct {
 	Queued       int64
+	Sending      int64
 	Sent         int64
 	Error        int64
 	Delivered    int64
 	NotDelivered int64
 	Scheduled    int64
+	// ScheduledDue is number of scheduled messages whose time has come but which haven't been queued by scheduler yet
+	ScheduledDue int64
 	Stopped      int64
+	Paused       int64
+	Held         int64
+	Suppressed   int64
 	Total        int64
+	// Segments is sum of segments of all messages
+	Segments int64
 }
 
 // Status represents current state of message in
@@ -152,6 +209,8 @@ func (st *Status) Scan(src interface{}) error {
 const (
 	// Queued shows that have been put in rabbitmq
 	Queued Status = "Queued"
+	// Sending shows message has been claimed by dispatcher and is being submitted, it can't be stopped or paused
+	Sending Status = "Sending"
 	// Error shows that message was sent to operator but returned error
 	Error Status = "Error"
 	// Sent shows that message was accepted by operator for delivery
@@ -164,6 +223,12 @@ const (
 	Scheduled Status = "Scheduled"
 	// Stopped shows message was stopped by user intervention
 	Stopped Status = "Stopped"
+	// Paused shows message was paused by user and won't be sent until its campaign is resumed
+	Paused Status = "Paused"
+	// Held shows message is outside its send window and will be queued again when window opens
+	Held Status = "Held"
+	// Suppressed shows message wasn't sent because its destination has opted out
+	Suppressed Status = "Suppressed"
 )
 
 const (
@@ -171,17 +236,67 @@ const (
 	EncUCS = "ucs"
 	// EncLatin is string representation of latin encoding
 	EncLatin = "latin"
+	// EncGSM is string representation of GSM 03.38 7 bit default alphabet encoding
+	EncGSM = "gsm"
 )
 
-// Total counts number of messages in one text string
-func Total(msg, enc string) int {
+const (
+	// flashClass is data coding bits for message class 0 (flash) in general data coding group
+	flashClass uint8 = 0x10
+)
+
+// DetectEnc returns encoding which fits msg in least number of short messages. GSM 7 bit is used when all
+// characters are in GSM alphabet, latin when msg is ASCII and UCS otherwise.
+func DetectEnc(msg string) string {
+	if gsm7.Valid(msg) {
+		return EncGSM
+	}
+	if stringutils.IsASCII(msg) {
+		return EncLatin
+	}
+	return EncUCS
+}
+
+// Encode encodes msg text according to enc and returns encoded bytes with data_coding value for submit_sm.
+// Flash messages are sent with message class 0. Since latin1 data coding can't carry a message class, flash latin
+// messages are sent as SMSC default alphabet.
+func Encode(msg, enc string, isFlash bool) ([]byte, uint8) {
 	var text pdutext.Codec
-	if enc == EncUCS {
+	switch enc {
+	case EncUCS:
 		text = pdutext.UCS2(msg)
-	} else {
-		text = pdutext.Raw(msg)
+	case EncGSM:
+		text = gsm7.Text(msg)
+	default:
+		text = pdutext.Latin1(msg)
+	}
+	if !isFlash {
+		return text.Encode(), uint8(text.Type())
+	}
+	switch enc {
+	case EncUCS:
+		return text.Encode(), flashClass | uint8(pdutext.UCS2Type)
+	case EncGSM:
+		return text.Encode(), flashClass
+	}
+	return pdutext.Raw(msg).Encode(), flashClass
+}
+
+// Coding returns segment coding used for messages with encoding enc
+func Coding(enc string) segment.Coding {
+	switch enc {
+	case EncUCS:
+		return segment.UCS2
+	case EncGSM:
+		return segment.GSM7
 	}
-	maxLen := 134 // 140-6 (UDH)
-	rawMsg := text.Encode()
-	return int(len(rawMsg)/maxLen) + 1
+	return segment.Latin1
+}
+
+// TooLongMessage is validation error for a message which needs more than segment.MaxParts short messages
+var TooLongMessage = fmt.Sprintf("Message can't be longer than %d parts.", segment.MaxParts)
+
+// Total counts number of short messages text is sent in
+func Total(msg, enc string) int {
+	return segment.Count(msg, Coding(enc))
 }
@@ -0,0 +1,19 @@
+package message
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/haisum/smpp-app/pkg/segment"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestMessage_Validate(t *testing.T) {
+	assert := assert.New(t)
+	m := Message{Dst: "+971500000001", Src: "Sender", Enc: EncLatin}
+	// 255 parts of 134 characters is longest message concatenation header can number
+	m.Msg = strings.Repeat("a", segment.MaxParts*134)
+	assert.Empty(m.Validate())
+	m.Msg += "a"
+	assert.Equal([]string{TooLongMessage}, m.Validate())
+}
@@ -0,0 +1,72 @@
+package message
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadLocation returns time zone with given IANA name such as "Asia/Dubai". Empty name is UTC.
+func LoadLocation(tz string) (*time.Location, error) {
+	if tz == "" {
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(tz)
+	if err != nil {
+		return nil, fmt.Errorf("unknown time zone %s", tz)
+	}
+	return loc, nil
+}
+
+// parseClock parses 24 hour time such as "09:00" and returns hour and minute
+func parseClock(clock string) (int, int, error) {
+	parts := strings.Split(clock, ":")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid time %s", clock)
+	}
+	hour, errH := strconv.Atoi(parts[0])
+	minute, errM := strconv.Atoi(parts[1])
+	if errH != nil || errM != nil || hour < 0 || hour > 24 || minute < 0 || minute > 59 || (hour == 24 && minute != 0) {
+		return 0, 0, fmt.Errorf("invalid time %s", clock)
+	}
+	return hour, minute, nil
+}
+
+// NextSendTime returns time at or after now when a message with given send window can be sent.
+// Window is sendAfter to sendBefore in time zone tz, such as "09:00" to "18:00". A window whose sendAfter is later than
+// sendBefore, such as "22:00" to "06:00", crosses midnight. Now is returned if window is empty or open.
+func NextSendTime(sendAfter, sendBefore, tz string, now time.Time) (time.Time, error) {
+	if sendAfter == "" || sendBefore == "" {
+		return now, nil
+	}
+	loc, err := LoadLocation(tz)
+	if err != nil {
+		return now, err
+	}
+	aH, aM, err := parseClock(sendAfter)
+	if err != nil {
+		return now, err
+	}
+	bH, bM, err := parseClock(sendBefore)
+	if err != nil {
+		return now, err
+	}
+	after, before := aH*60+aM, bH*60+bM
+	if after == before {
+		return now, nil
+	}
+	local := now.In(loc)
+	cur := local.Hour()*60 + local.Minute()
+	if after < before && cur >= after && cur < before {
+		return now, nil
+	}
+	if after > before && (cur >= after || cur < before) {
+		return now, nil
+	}
+	opens := time.Date(local.Year(), local.Month(), local.Day(), aH, aM, 0, 0, loc)
+	if !opens.After(local) {
+		opens = time.Date(local.Year(), local.Month(), local.Day()+1, aH, aM, 0, 0, loc)
+	}
+	return opens, nil
+}
@@ -0,0 +1,38 @@
+package message
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestNextSendTime(t *testing.T) {
+	assert := assert.New(t)
+	dubai, _ := time.LoadLocation("Asia/Dubai")
+	at := func(day, hour, minute int) time.Time {
+		return time.Date(2018, 3, day, hour, minute, 0, 0, dubai)
+	}
+	cases := []struct {
+		after, before string
+		now, want     time.Time
+	}{
+		{"", "", at(1, 3, 0), at(1, 3, 0)},
+		{"09:00", "18:00", at(1, 10, 0), at(1, 10, 0)},
+		{"09:00", "18:00", at(1, 8, 59), at(1, 9, 0)},
+		{"09:00", "18:00", at(1, 18, 0), at(2, 9, 0)},
+		{"22:00", "06:00", at(1, 23, 0), at(1, 23, 0)},
+		{"22:00", "06:00", at(1, 5, 59), at(1, 5, 59)},
+		{"22:00", "06:00", at(1, 6, 0), at(1, 22, 0)},
+		{"22:00", "24:00", at(1, 21, 0), at(1, 22, 0)},
+	}
+	for _, c := range cases {
+		got, err := NextSendTime(c.after, c.before, "Asia/Dubai", c.now.UTC())
+		assert.Nil(err)
+		assert.True(c.want.Equal(got), "%s-%s at %s: want %s got %s", c.after, c.before, c.now, c.want, got)
+	}
+	_, err := NextSendTime("09:00", "18:00", "Mars/Olympus", time.Now())
+	assert.NotNil(err)
+	_, err = NextSendTime("9", "18:00", "", time.Now())
+	assert.NotNil(err)
+}
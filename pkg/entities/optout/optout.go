@@ -0,0 +1,45 @@
+package optout
+
+// Store is interface for opt out store implementations
+type Store interface {
+	// Add saves opt outs, a number which is already opted out in same scope is skipped. It returns number of saved opt outs.
+	Add(o []OptOut) (int64, error)
+	// Remove deletes opt outs of numbers made by username, or global opt outs if username is empty.
+	// It returns number of deleted opt outs.
+	Remove(username string, numbers []string) (int64, error)
+	List(c *Criteria) ([]OptOut, error)
+	// Suppressed returns those of numbers which are opted out globally or for username
+	Suppressed(username string, numbers []string) (map[string]bool, error)
+}
+
+// MaxAddCount is maximum number of opt outs which can be given to Store.Add at once
+const MaxAddCount = 1000
+
+// OptOut is a number which doesn't want to receive messages. A global opt out applies to messages of all users,
+// otherwise it only applies to messages of Username.
+type OptOut struct {
+	ID     int64  `db:"id" goqu:"skipinsert"`
+	Number string `db:"number"`
+	// Username is user whose messages aren't sent to Number, it's empty for a global opt out
+	Username  string `db:"username"`
+	Reason    string `db:"reason"`
+	AddedBy   string `db:"addedby"`
+	CreatedAt int64  `db:"createdat"`
+}
+
+// Global returns true if o applies to messages of all users
+func (o *OptOut) Global() bool {
+	return o.Username == ""
+}
+
+// Criteria represents filters we can give to List method.
+type Criteria struct {
+	Number string
+	// Username filters opt outs of a user, Global filters global opt outs. Both kinds are listed if neither is set.
+	Username   string
+	Global     bool
+	OrderByKey string
+	OrderByDir string
+	From       string
+	PerPage    uint
+}
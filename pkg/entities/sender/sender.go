@@ -0,0 +1,219 @@
+package sender
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/errs"
+)
+
+// Store is interface for sender id registry implementations
+type Store interface {
+	// Save inserts s if its ID is zero, otherwise it updates status and review of existing sender. Audit entry a is
+	// recorded for s in same transaction.
+	Save(s *Sender, a *Audit) (int64, error)
+	List(c *Criteria) ([]Sender, error)
+	Audits(c *AuditCriteria) ([]Audit, error)
+}
+
+// ErrNotFound is returned when a sender id couldn't be found in store
+var ErrNotFound = errors.New("sender id not found")
+
+// ErrNotApproved is returned when a source address isn't matched by any approved sender id of a user
+var ErrNotApproved = errors.New("sender id isn't approved")
+
+// Status is state of a sender id request
+type Status string
+
+// Scan implements scanner interface for Status
+func (s *Status) Scan(src interface{}) error {
+	*s = Status(fmt.Sprintf("%s", src))
+	return nil
+}
+
+const (
+	// Pending is a sender id which is waiting for review
+	Pending Status = "Pending"
+	// Approved is a sender id which user can send messages from
+	Approved Status = "Approved"
+	// Rejected is a sender id which was rejected, or approved and revoked later
+	Rejected Status = "Rejected"
+)
+
+const (
+	// maxAlphanumericLen is maximum length of an alphanumeric source address
+	maxAlphanumericLen = 11
+	// maxNumericLen is maximum number of digits in a numeric source address
+	maxNumericLen = 15
+	// minPrefixLen is minimum number of digits before wildcard of a range, so a range can't allow all numbers
+	minPrefixLen = 3
+)
+
+var (
+	numericRe      = regexp.MustCompile(`^\+?[0-9]+$`)
+	alphanumericRe = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9 ._&-]*$`)
+)
+
+// Sender is a source address a user can send messages from once it's approved.
+type Sender struct {
+	ID       int64  `db:"id" goqu:"skipinsert"`
+	Username string `db:"username"`
+	// Src is an alphanumeric sender id, a number or a numeric range. A range is a prefix of digits followed by *,
+	// e.g. 92300123* allows every number which starts with 92300123.
+	Src    string `db:"src"`
+	Status Status `db:"status"`
+	// Note is reason given by user for requesting sender id
+	Note string `db:"note"`
+	// ReviewedBy and ReviewNote are set by last user who approved or rejected sender id
+	ReviewedBy string `db:"reviewedby"`
+	ReviewNote string `db:"reviewnote"`
+	CreatedAt  int64  `db:"createdat"`
+	UpdatedAt  int64  `db:"updatedat"`
+}
+
+// Criteria represents filters we can give to List method.
+type Criteria struct {
+	ID         int64
+	Username   string
+	Src        string
+	Status     Status
+	OrderByKey string
+	OrderByDir string
+	From       string
+	PerPage    uint
+}
+
+// Action is a change recorded in audit trail of a sender id
+type Action string
+
+// Scan implements scanner interface for Action
+func (a *Action) Scan(src interface{}) error {
+	*a = Action(fmt.Sprintf("%s", src))
+	return nil
+}
+
+const (
+	// ActionRequested is recorded when a user requests a sender id
+	ActionRequested Action = "Requested"
+	// ActionApproved is recorded when a sender id is approved
+	ActionApproved Action = "Approved"
+	// ActionRejected is recorded when a sender id is rejected or revoked
+	ActionRejected Action = "Rejected"
+)
+
+// Audit is an entry in audit trail of a sender id
+type Audit struct {
+	ID       int64  `db:"id" goqu:"skipinsert"`
+	SenderID int64  `db:"senderid"`
+	Username string `db:"username"`
+	Src      string `db:"src"`
+	Action   Action `db:"action"`
+	// ChangedBy is username of user who made the change
+	ChangedBy string `db:"changedby"`
+	Note      string `db:"note"`
+	CreatedAt int64  `db:"createdat"`
+}
+
+// AuditCriteria represents filters we can give to Store.Audits
+type AuditCriteria struct {
+	ID            int64
+	SenderID      int64
+	Username      string
+	Action        Action
+	ChangedBy     string
+	CreatedAfter  int64
+	CreatedBefore int64
+	OrderByKey    string
+	OrderByDir    string
+	From          string
+	PerPage       uint
+}
+
+// Range returns true if s allows every number starting with a prefix
+func (s *Sender) Range() bool {
+	return strings.HasSuffix(s.Src, "*")
+}
+
+// Numeric returns true if s is a number or a numeric range
+func (s *Sender) Numeric() bool {
+	return numericRe.MatchString(strings.TrimSuffix(s.Src, "*"))
+}
+
+// Matches returns true if src can be sent from s. Alphanumeric sender ids are matched ignoring case, numbers and
+// ranges are matched ignoring a leading +.
+func (s *Sender) Matches(src string) bool {
+	if !s.Numeric() {
+		return strings.EqualFold(s.Src, src)
+	}
+	if !numericRe.MatchString(src) {
+		return false
+	}
+	src = strings.TrimPrefix(src, "+")
+	if s.Range() {
+		return strings.HasPrefix(src, strings.TrimPrefix(strings.TrimSuffix(s.Src, "*"), "+"))
+	}
+	return src == strings.TrimPrefix(s.Src, "+")
+}
+
+// Validate performs sanity checks on sender id
+func (s *Sender) Validate() error {
+	errMap := make(map[string]string)
+	digits := strings.TrimPrefix(strings.TrimSuffix(s.Src, "*"), "+")
+	switch {
+	case s.Src == "":
+		errMap["Src"] = "sender id is required"
+	case s.Range():
+		if !s.Numeric() || len(digits) < minPrefixLen || len(digits) >= maxNumericLen {
+			errMap["Src"] = fmt.Sprintf("range must be %d to %d digits followed by *", minPrefixLen, maxNumericLen-1)
+		}
+	case s.Numeric():
+		if len(digits) > maxNumericLen {
+			errMap["Src"] = fmt.Sprintf("number can't be longer than %d digits", maxNumericLen)
+		}
+	case len(s.Src) > maxAlphanumericLen || !alphanumericRe.MatchString(s.Src):
+		errMap["Src"] = fmt.Sprintf("alphanumeric sender id must be 1 to %d letters, digits, spaces or . _ & -", maxAlphanumericLen)
+	}
+	if len(errMap) > 0 {
+		return &errs.ValidationError{
+			Message: "validation failed",
+			Errors:  errMap,
+		}
+	}
+	return nil
+}
+
+// Allowed returns ErrNotApproved unless src matches one of approved sender ids of username in store
+func Allowed(store Store, username, src string) error {
+	c := Criteria{Username: username, Status: Approved, OrderByKey: "ID", OrderByDir: "ASC", PerPage: 500}
+	for {
+		ss, err := store.List(&c)
+		if err != nil {
+			return err
+		}
+		for _, s := range ss {
+			if s.Matches(src) {
+				return nil
+			}
+		}
+		if len(ss) < int(c.PerPage) {
+			return ErrNotApproved
+		}
+		c.From = strconv.FormatInt(ss[len(ss)-1].ID, 10)
+	}
+}
+
+// SrcError returns error response of a message or campaign whose source address isn't approved for its user
+func SrcError(src string) errs.ErrorResponse {
+	return errs.ErrorResponse{
+		Errors: []errs.ResponseError{
+			{
+				Type:    errs.ErrorTypeForm,
+				Message: fmt.Sprintf("Sender ID %s isn't approved. Request it and send messages once it's approved.", src),
+				Field:   "Src",
+			},
+		},
+	}
+}
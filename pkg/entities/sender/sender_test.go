@@ -0,0 +1,63 @@
+package sender
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+type memStore struct {
+	Store
+	senders []Sender
+}
+
+func (s *memStore) List(c *Criteria) ([]Sender, error) {
+	var ss []Sender
+	for _, v := range s.senders {
+		if v.Username == c.Username && v.Status == c.Status {
+			ss = append(ss, v)
+		}
+	}
+	return ss, nil
+}
+
+func TestSender_Matches(t *testing.T) {
+	assert := assert.New(t)
+	s := Sender{Src: "Acme"}
+	assert.True(s.Matches("ACME"))
+	assert.False(s.Matches("Acme1"))
+	s = Sender{Src: "+923001234567"}
+	assert.True(s.Matches("923001234567"))
+	assert.False(s.Matches("92300123456"))
+	s = Sender{Src: "9230012*"}
+	assert.True(s.Matches("+923001299999"))
+	assert.True(s.Matches("9230012"))
+	assert.False(s.Matches("923001312345"))
+	assert.False(s.Matches("9230012AB"))
+}
+
+func TestSender_Validate(t *testing.T) {
+	assert := assert.New(t)
+	for _, src := range []string{"Acme", "My Shop.pk", "8001", "+923001234567", "92300*"} {
+		s := Sender{Src: src}
+		assert.Nil(s.Validate(), src)
+	}
+	for _, src := range []string{"", "*", "92*", "Acme*", "TooLongSenderID", "Acme!", "1234567890123456"} {
+		s := Sender{Src: src}
+		assert.NotNil(s.Validate(), src)
+	}
+}
+
+func TestAllowed(t *testing.T) {
+	assert := assert.New(t)
+	store := &memStore{senders: []Sender{
+		{ID: 1, Username: "alice", Src: "Acme", Status: Approved},
+		{ID: 2, Username: "alice", Src: "Spoof", Status: Pending},
+		{ID: 3, Username: "alice", Src: "9230012*", Status: Approved},
+		{ID: 4, Username: "bob", Src: "Bob", Status: Approved},
+	}}
+	assert.Nil(Allowed(store, "alice", "acme"))
+	assert.Nil(Allowed(store, "alice", "923001200000"))
+	assert.Equal(ErrNotApproved, Allowed(store, "alice", "Spoof"))
+	assert.Equal(ErrNotApproved, Allowed(store, "alice", "Bob"))
+}
@@ -0,0 +1,139 @@
+package template
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/pkg/errors"
+)
+
+// Store is interface for template store implementations
+type Store interface {
+	// Save inserts a template if its ID is zero, otherwise it updates existing template
+	Save(t *Template) (int64, error)
+	List(c *Criteria) ([]Template, error)
+	Delete(id int64) error
+}
+
+// ErrNotFound is returned when a template couldn't be found in store
+var ErrNotFound = errors.New("template not found")
+
+// Template is a reusable message text. Msg may have named placeholders such as {{Name}} which are replaced
+// by values of same named columns in campaign file.
+type Template struct {
+	ID          int64  `db:"id" goqu:"skipinsert"`
+	Name        string `db:"name"`
+	Description string `db:"description"`
+	Msg         string `db:"msg"`
+	Username    string `db:"username"`
+	CreatedAt   int64  `db:"createdat"`
+	UpdatedAt   int64  `db:"updatedat"`
+}
+
+// Criteria represents filters we can give to List method.
+type Criteria struct {
+	ID         int64
+	Username   string
+	Name       string
+	OrderByKey string
+	OrderByDir string
+	From       string
+	PerPage    uint
+}
+
+// placeholderRe matches a {{Param}} placeholder and captures its name
+var placeholderRe = regexp.MustCompile(`\{\{([^{}]+)\}\}`)
+
+// Placeholders returns names of placeholders in msg in order of their first appearance
+func Placeholders(msg string) []string {
+	var names []string
+	seen := make(map[string]bool)
+	for _, m := range placeholderRe.FindAllStringSubmatch(msg, -1) {
+		if !seen[m[1]] {
+			seen[m[1]] = true
+			names = append(names, m[1])
+		}
+	}
+	return names
+}
+
+// Missing returns placeholders of msg which don't have a value in params
+func Missing(msg string, params map[string]string) []string {
+	var missing []string
+	for _, name := range Placeholders(msg) {
+		if _, ok := params[name]; !ok {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// Unused returns names in params which don't have a placeholder in msg, sorted by name
+func Unused(msg string, params map[string]string) []string {
+	used := make(map[string]bool)
+	for _, name := range Placeholders(msg) {
+		used[name] = true
+	}
+	var unused []string
+	for name := range params {
+		if !used[name] {
+			unused = append(unused, name)
+		}
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+// Render replaces placeholders in msg with values in params
+func Render(msg string, params map[string]string) string {
+	for name, value := range params {
+		msg = strings.Replace(msg, "{{"+name+"}}", value, -1)
+	}
+	return msg
+}
+
+// Validate performs sanity checks on template
+func (t *Template) Validate() error {
+	errMap := make(map[string]string)
+	if t.Name == "" {
+		errMap["Name"] = "name can't be empty"
+	}
+	if t.Msg == "" {
+		errMap["Msg"] = "message can't be empty"
+	}
+	if len(errMap) > 0 {
+		return &errs.ValidationError{
+			Message: "validation failed",
+			Errors:  errMap,
+		}
+	}
+	return nil
+}
+
+// Get returns template with id from store if it belongs to u or u has perm. field is request field which has id, form
+// error of that field is returned if template isn't found.
+func Get(store Store, u *user.User, id int64, perm, field string) (Template, error) {
+	ts, err := store.List(&Criteria{ID: id})
+	if err != nil || len(ts) == 0 {
+		resp := errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "Couldn't get template.",
+					Field:   field,
+				},
+			},
+		}
+		if err == nil {
+			err = ErrNotFound
+		}
+		return Template{}, errors.Wrap(resp, err.Error())
+	}
+	if ts[0].Username != u.Username && !u.Can(perm) {
+		return Template{}, errs.ForbiddenError{"user doesn't have permission to access templates of other users"}
+	}
+	return ts[0], nil
+}
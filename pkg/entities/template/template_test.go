@@ -0,0 +1,62 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/pkg/errors"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+type memStore struct {
+	Store
+	templates []Template
+}
+
+func (s *memStore) List(c *Criteria) ([]Template, error) {
+	var ts []Template
+	for _, t := range s.templates {
+		if t.ID == c.ID {
+			ts = append(ts, t)
+		}
+	}
+	return ts, nil
+}
+
+func TestPlaceholders(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"Name", "Amount"}, Placeholders("Dear {{Name}}, pay {{Amount}} by {{Name}}"))
+	assert.Nil(Placeholders("no params { here }"))
+}
+
+func TestMissing(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"Amount"}, Missing("Dear {{Name}}, pay {{Amount}}", map[string]string{"Name": "Ali", "Other": "x"}))
+	assert.Nil(Missing("Dear {{Name}}", map[string]string{"Name": ""}))
+}
+
+func TestUnused(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]string{"City", "Other"}, Unused("Dear {{Name}}", map[string]string{"Other": "x", "Name": "Ali", "City": "Dubai"}))
+	assert.Nil(Unused("Dear {{Name}}", map[string]string{"Name": "Ali"}))
+}
+
+func TestGet(t *testing.T) {
+	assert := assert.New(t)
+	store := &memStore{templates: []Template{{ID: 1, Username: "alice", Msg: "hello"}}}
+	tpl, err := Get(store, &user.User{Username: "alice"}, 1, permission.ListTemplates, "TemplateID")
+	assert.Nil(err)
+	assert.Equal("hello", tpl.Msg)
+
+	_, err = Get(store, &user.User{Username: "bob"}, 1, permission.ListTemplates, "TemplateID")
+	assert.IsType(errs.ForbiddenError{}, err)
+	_, err = Get(store, &user.User{Username: "bob", Permissions: permission.List{permission.ListTemplates}}, 1, permission.ListTemplates, "TemplateID")
+	assert.Nil(err)
+
+	_, err = Get(store, &user.User{Username: "alice"}, 2, permission.ListTemplates, "TemplateID")
+	if resp, ok := errors.Cause(err).(errs.ErrorResponse); assert.True(ok) {
+		assert.Equal("TemplateID", resp.Errors[0].Field)
+	}
+}
@@ -0,0 +1,26 @@
+package throttle
+
+// Store is interface for storing token levels of connections. Dispatcher saves levels and http service reads them.
+type Store interface {
+	Get() (*Levels, error)
+	Save(l *Levels) error
+}
+
+// Levels is a snapshot of rate limiter of every running connection
+type Levels struct {
+	Conns []Level
+	// UpdatedAt is unix time of snapshot, a stale value means dispatcher isn't running
+	UpdatedAt int64
+}
+
+// Level is token level of a single connection. Connection is saturated when Tokens is below 1.
+type Level struct {
+	Group      string
+	Connection string
+	// Tokens is number of message segments which can be sent right now, negative when a multipart
+	// message took more than was available
+	Tokens float64
+	// Size is number of message segments allowed per Time seconds
+	Size int32
+	Time int
+}
@@ -45,6 +45,22 @@ const (
 	GetStatus = "Get status of services"
 	// Mask is permission to mask messages
 	Mask = "Mask Messages"
+	// ListTemplates is permission to list and use message templates of other users
+	ListTemplates = "List templates"
+	// EditTemplates is permission to edit and delete message templates of other users
+	EditTemplates = "Edit templates"
+	// EditOptOuts is permission to manage global opt out list and opt out lists of other users
+	EditOptOuts = "Edit opt-outs"
+	// ListInbound is permission to list inbound messages of other users
+	ListInbound = "List inbound messages"
+	// EditWebhooks is permission to see and manage webhooks of other users and their delivery log
+	EditWebhooks = "Edit webhooks"
+	// AddCredit is permission to top up balance of users
+	AddCredit = "Add credit"
+	// ApproveSenderIDs is permission to approve or reject sender ids and see sender ids of other users
+	ApproveSenderIDs = "Approve sender IDs"
+	// ManageCampaigns is permission to stop, pause, resume and retry campaigns of other users
+	ManageCampaigns = "Manage campaigns"
 )
 
 // GetList returns all valid permissions for a user
@@ -65,6 +81,14 @@ func GetList() List {
 		RetryCampaign,
 		GetStatus,
 		Mask,
+		ListTemplates,
+		EditTemplates,
+		EditOptOuts,
+		ListInbound,
+		EditWebhooks,
+		AddCredit,
+		ApproveSenderIDs,
+		ManageCampaigns,
 	}
 }
 
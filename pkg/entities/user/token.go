@@ -0,0 +1,47 @@
+package user
+
+import "github.com/pkg/errors"
+
+const (
+	// DefaultTokenValidity is seconds a token stays valid after its last use, if login doesn't specify validity
+	DefaultTokenValidity = 24 * 60 * 60
+	// MaxTokenValidity is maximum validity a token can be issued with
+	MaxTokenValidity = 30 * 24 * 60 * 60
+)
+
+// ErrTokenNotFound is returned by TokenStore when a token doesn't exist or was revoked
+var ErrTokenNotFound = errors.New("token not found")
+
+// Token is an auth token issued to a user on login. A token expires when it isn't used for Validity seconds.
+type Token struct {
+	ID           int64  `db:"ID" goqu:"skipinsert"`
+	Token        string `db:"Token"`
+	Username     string `db:"Username"`
+	Validity     int64  `db:"Validity"`
+	LastAccessed int64  `db:"LastAccessed"`
+}
+
+// Expired returns true if token wasn't used for more than its validity before now
+func (t *Token) Expired(now int64) bool {
+	return now-t.LastAccessed > t.Validity
+}
+
+// TokenStore is interface for auth token store
+type TokenStore interface {
+	// Add issues a new token for user and returns token string that should be sent in Authorization: Bearer header
+	Add(username string, validity int64) (string, error)
+	// Get returns token by token string
+	Get(token string) (*Token, error)
+	// Touch updates LastAccessed of token
+	Touch(token string, lastAccessed int64) error
+	// Delete revokes a single token
+	Delete(token string) error
+	// DeleteAll revokes all tokens of a user and returns number of tokens revoked
+	DeleteAll(username string) (int64, error)
+}
+
+// TokenAuthenticator validates a bearer token and returns its user. It's implemented by Authenticators which
+// support token authentication.
+type TokenAuthenticator interface {
+	AuthenticateToken(token string) (*User, error)
+}
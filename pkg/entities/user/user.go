@@ -2,10 +2,14 @@ package user
 
 import (
 	"context"
+	"fmt"
 	"net/mail"
+	"regexp"
+	"time"
 
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/stringutils"
 	"github.com/pkg/errors"
 )
 
@@ -20,6 +24,11 @@ type User struct {
 	Permissions     permission.List `db:"permissions"`
 	RegisteredAt    int64           `db:"registeredat"`
 	Suspended       bool            `db:"suspended"`
+	// TimeZone is IANA name of time zone used for send windows of user's messages when none is given
+	TimeZone string `db:"timezone"`
+	// Numbers are short codes and long numbers owned by user, messages received on them are shown in user's inbox.
+	// They're saved in UserNumber table by store, without leading +.
+	Numbers stringutils.StringList `db:"-"`
 }
 
 // Store is interface for user store
@@ -35,6 +44,16 @@ type Authenticator interface {
 	Authenticate(username, password string) (*User, error)
 }
 
+// NumberTakenError is returned when a user is given a number which is owned by another user
+type NumberTakenError struct {
+	Number string
+}
+
+// Error implements error interface
+func (e NumberTakenError) Error() string {
+	return fmt.Sprintf("number %s is owned by another user", e.Number)
+}
+
 // Criteria is used to filter users
 type Criteria struct {
 	Username         string
@@ -46,8 +65,10 @@ type Criteria struct {
 	OrderByDir       string
 	RegisteredBefore int64
 	ConnectionGroup  string
-	From             string
-	PerPage          uint
+	// Number finds user who owns a short code or long number, with or without leading +
+	Number  string
+	From    string
+	PerPage uint
 }
 
 // Can checks if user has permission to perform given actions
@@ -85,6 +106,16 @@ func (u *User) Validate() error {
 	if err != nil {
 		errMap["Email"] = "invalid email address"
 	}
+	if u.TimeZone != "" {
+		if _, err := time.LoadLocation(u.TimeZone); err != nil {
+			errMap["TimeZone"] = "time zone must be a valid IANA time zone such as \"Asia/Dubai\""
+		}
+	}
+	for _, n := range u.Numbers {
+		if !numberRe.MatchString(n) {
+			errMap["Numbers"] = fmt.Sprintf("number %s must be a short code or long number of 3 to 15 digits optionally starting with +", n)
+		}
+	}
 	err = u.Permissions.Validate()
 	if err != nil {
 		errMap["Permissions"] = err.Error()
@@ -98,6 +129,9 @@ func (u *User) Validate() error {
 	return nil
 }
 
+// numberRe matches a short code or long number
+var numberRe = regexp.MustCompile(`^\+?[0-9]{3,15}$`)
+
 type key int
 
 const (
@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/stringutils"
+)
+
+// Store is interface for webhook store implementations
+type Store interface {
+	// Save inserts a webhook if its ID is zero, otherwise it updates existing webhook
+	Save(w *Webhook) (int64, error)
+	List(c *Criteria) ([]Webhook, error)
+	Delete(id int64) error
+}
+
+// OutboxStore is interface for store of pending webhook deliveries and their attempts
+type OutboxStore interface {
+	Add(ds []Delivery) error
+	// Due returns Pending deliveries whose NextAttemptAt has passed, oldest first
+	Due(now int64, limit uint) ([]Delivery, error)
+	// Claim moves NextAttemptAt of d to until if it hasn't been changed since d was read. It returns false if
+	// another process has claimed d.
+	Claim(d *Delivery, until int64) (bool, error)
+	// Update saves status, attempts and next attempt time of d and records attempt a
+	Update(d *Delivery, a *Attempt) error
+	Attempts(c *AttemptCriteria) ([]Attempt, error)
+}
+
+// Notifier queues p for webhooks of username which are subscribed to its event
+type Notifier interface {
+	Notify(username string, p Payload)
+}
+
+// ErrNotFound is returned when a webhook couldn't be found in store
+var ErrNotFound = errors.New("webhook not found")
+
+// Event is a change in state of a message which a webhook can subscribe to
+type Event string
+
+// Scan implements scanner interface for Event
+func (e *Event) Scan(src interface{}) error {
+	*e = Event(fmt.Sprintf("%s", src))
+	return nil
+}
+
+const (
+	// EventSent is sent when SMSC accepts a message
+	EventSent Event = "sent"
+	// EventDelivered is sent when delivery receipt of a message says it was delivered
+	EventDelivered Event = "delivered"
+	// EventNotDelivered is sent when delivery receipt of a message says it couldn't be delivered
+	EventNotDelivered Event = "not delivered"
+	// EventError is sent when a message couldn't be submitted to SMSC
+	EventError Event = "error"
+	// EventInbound is sent when a message is received on a number of user
+	EventInbound Event = "inbound"
+)
+
+// Events returns all events a webhook can subscribe to
+func Events() []Event {
+	return []Event{EventSent, EventDelivered, EventNotDelivered, EventError, EventInbound}
+}
+
+// Webhook is an URL of a user which is called with a signed POST when one of its Events happens
+type Webhook struct {
+	ID       int64  `db:"id" goqu:"skipinsert"`
+	Username string `db:"username"`
+	URL      string `db:"url"`
+	// Secret is key of HMAC-SHA256 signature of payloads, it's never returned
+	Secret    string                 `db:"secret" json:"-"`
+	Events    stringutils.StringList `db:"events"`
+	CreatedAt int64                  `db:"createdat"`
+	UpdatedAt int64                  `db:"updatedat"`
+}
+
+// Criteria represents filters we can give to List method.
+type Criteria struct {
+	ID         int64
+	Username   string
+	OrderByKey string
+	OrderByDir string
+	From       string
+	PerPage    uint
+}
+
+// Subscribed returns true if w is called for event e
+func (w *Webhook) Subscribed(e Event) bool {
+	for _, v := range w.Events {
+		if Event(v) == e {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate performs sanity checks on webhook
+func (w *Webhook) Validate() error {
+	errMap := make(map[string]string)
+	if u, err := url.Parse(w.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errMap["URL"] = "url must be an absolute http or https url"
+	}
+	if len(w.Secret) < 16 {
+		errMap["Secret"] = "secret must be at least 16 characters"
+	}
+	if len(w.Events) == 0 {
+		errMap["Events"] = "at least one event is required"
+	}
+	for _, v := range w.Events {
+		valid := false
+		for _, e := range Events() {
+			if Event(v) == e {
+				valid = true
+			}
+		}
+		if !valid {
+			errMap["Events"] = fmt.Sprintf("%s isn't a valid event, valid events are %v", v, Events())
+		}
+	}
+	if len(errMap) > 0 {
+		return &errs.ValidationError{
+			Message: "validation failed",
+			Errors:  errMap,
+		}
+	}
+	return nil
+}
+
+// Payload is JSON body posted to a webhook. Message fields are empty for inbound events and InboundID is empty
+// for others.
+type Payload struct {
+	Event      Event
+	MessageID  int64  `json:",omitempty"`
+	RespID     string `json:",omitempty"`
+	CampaignID int64  `json:",omitempty"`
+	InboundID  int64  `json:",omitempty"`
+	Src        string
+	Dst        string
+	// Msg is text of inbound message
+	Msg   string `json:",omitempty"`
+	Error string `json:",omitempty"`
+	// Time is unix time at which event happened
+	Time int64
+}
+
+// MessagePayload returns payload of event e of message m
+func MessagePayload(e Event, m *message.Message) Payload {
+	return Payload{
+		Event:      e,
+		MessageID:  m.ID,
+		RespID:     m.RespID,
+		CampaignID: m.CampaignID,
+		Src:        m.Src,
+		Dst:        m.Dst,
+		Error:      m.Error,
+	}
+}
+
+// DeliveryStatus is state of a delivery in outbox
+type DeliveryStatus string
+
+// Scan implements scanner interface for DeliveryStatus
+func (s *DeliveryStatus) Scan(src interface{}) error {
+	*s = DeliveryStatus(fmt.Sprintf("%s", src))
+	return nil
+}
+
+const (
+	// DeliveryPending is a delivery which hasn't succeeded yet and will be attempted at NextAttemptAt
+	DeliveryPending DeliveryStatus = "Pending"
+	// DeliveryDelivered is a delivery whose webhook responded with a 2xx status
+	DeliveryDelivered DeliveryStatus = "Delivered"
+	// DeliveryFailed is a delivery which failed MaxAttempts times and won't be attempted again
+	DeliveryFailed DeliveryStatus = "Failed"
+)
+
+// Delivery is a payload waiting in outbox to be posted to a webhook
+type Delivery struct {
+	ID        int64          `db:"id" goqu:"skipinsert"`
+	WebhookID int64          `db:"webhookid"`
+	Username  string         `db:"username"`
+	Event     Event          `db:"event"`
+	Payload   string         `db:"payload"`
+	Status    DeliveryStatus `db:"status"`
+	// Attempts is number of times delivery has been attempted
+	Attempts      int   `db:"attempts"`
+	NextAttemptAt int64 `db:"nextattemptat"`
+	CreatedAt     int64 `db:"createdat"`
+}
+
+// Attempt is a log entry of a try to post a delivery to its webhook
+type Attempt struct {
+	ID         int64  `db:"id" goqu:"skipinsert"`
+	DeliveryID int64  `db:"deliveryid"`
+	WebhookID  int64  `db:"webhookid"`
+	Username   string `db:"username"`
+	Event      Event  `db:"event"`
+	URL        string `db:"url"`
+	// Number is count of this attempt for its delivery, starting from 1
+	Number int `db:"number"`
+	// ResponseCode is http status returned by webhook, it's zero if request couldn't be made
+	ResponseCode int    `db:"responsecode"`
+	Error        string `db:"error"`
+	// Duration is time taken by request in milliseconds
+	Duration    int64 `db:"duration"`
+	AttemptedAt int64 `db:"attemptedat"`
+}
+
+// AttemptCriteria represents filters we can give to OutboxStore.Attempts
+type AttemptCriteria struct {
+	ID              int64
+	DeliveryID      int64
+	WebhookID       int64
+	Username        string
+	Event           Event
+	ResponseCode    int
+	AttemptedAfter  int64
+	AttemptedBefore int64
+	OrderByKey      string
+	OrderByDir      string
+	From            string
+	PerPage         uint
+}
@@ -22,6 +22,19 @@ func (v *ValidationError) Error() string {
 	return v.Message
 }
 
+// FormErrors returns errors of v as form errors of a response, keyed by same fields
+func (v *ValidationError) FormErrors() ErrorResponse {
+	resp := ErrorResponse{}
+	for k, msg := range v.Errors {
+		resp.Errors = append(resp.Errors, ResponseError{
+			Type:    ErrorTypeForm,
+			Message: msg,
+			Field:   k,
+		})
+	}
+	return resp
+}
+
 // BadRequestError is sent when user sends invalid request
 type BadRequestError error
 
@@ -1,76 +1,321 @@
 package excel
 
 import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
 	"errors"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"path"
+	"strconv"
 	"strings"
 
 	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
-	"github.com/tealeg/xlsx"
 )
 
 // ToNumbers reads bytes from reader as excel file then
-// returns a map of file.Row records if valid records are found
+// returns file.Rows which read records from first sheet as they're asked for.
+// Sheet xml is decoded as a stream, only shared strings table of workbook is kept in memory.
 // excel file must have following pattern:
 // destination [ param1 param2 param3 ... ]
 // 439099009   [ val1   val2   val3  ... ]
-func ToNumbers(reader io.Reader) (map[string]file.Row, error) {
-	numbers := make(map[string]file.Row)
-	b, err := ioutil.ReadAll(reader)
+func ToNumbers(reader io.Reader) (file.Rows, error) {
+	r, size, err := readerAt(reader)
 	if err != nil {
 		return nil, err
 	}
-	xlFile, err := xlsx.OpenBinary(b)
+	z, err := zip.NewReader(r, size)
 	if err != nil {
-		return numbers, err
+		return nil, err
+	}
+	files := make(map[string]*zip.File, len(z.File))
+	for _, f := range z.File {
+		files[f.Name] = f
 	}
-	if err = validateFile(xlFile); err != nil {
-		return numbers, err
+	sheet, err := firstSheet(files)
+	if err != nil {
+		return nil, err
 	}
-	var keys []string
-	for _, cell := range xlFile.Sheets[0].Rows[0].Cells {
-		keys = append(keys, cell.Value)
+	shared, err := sharedStrings(files)
+	if err != nil {
+		return nil, err
 	}
-	for i := 1; i < len(xlFile.Sheets[0].Rows); i++ {
-		if len(xlFile.Sheets[0].Rows[i].Cells) < 1 {
-			return numbers, fmt.Errorf("row number %d doesn't have any value", i+1)
+	rc, err := sheet.Open()
+	if err != nil {
+		return nil, err
+	}
+	rows := &rows{
+		dec:    xml.NewDecoder(rc),
+		closer: rc,
+		shared: shared,
+	}
+	if err := rows.readHeader(); err != nil {
+		rc.Close()
+		return nil, err
+	}
+	return rows, nil
+}
+
+// readerAt returns reader as io.ReaderAt with its size. Readers which can't seek are read in memory, they can't be
+// larger than file.MaxFileSize.
+func readerAt(reader io.Reader) (io.ReaderAt, int64, error) {
+	if rs, ok := reader.(interface {
+		io.ReaderAt
+		io.Seeker
+	}); ok {
+		size, err := rs.Seek(0, io.SeekEnd)
+		if err != nil {
+			return nil, 0, err
 		}
-		num := xlFile.Sheets[0].Rows[i].Cells[0].Value
-		num = strings.Trim(num, "\t\n\v\f\r \u0085\u00a0")
-		if len(num) > 15 || len(num) < 5 {
-			return numbers, fmt.Errorf("row number %d in file is invalid; number must be greater than 5 characters and lesser than 16; please fix it and retry", i+1)
+		if _, err := rs.Seek(0, io.SeekStart); err != nil {
+			return nil, 0, err
 		}
-		if len(xlFile.Sheets[0].Rows[i].Cells) < len(keys) {
-			return numbers, fmt.Errorf("row number %d has blank values for some parameters", i)
+		return rs, size, nil
+	}
+	b, err := ioutil.ReadAll(io.LimitReader(reader, file.MaxFileSize+1))
+	if err != nil {
+		return nil, 0, err
+	}
+	if int64(len(b)) > file.MaxFileSize {
+		return nil, 0, fmt.Errorf("file size can't be larger than %d", file.MaxFileSize)
+	}
+	return bytes.NewReader(b), int64(len(b)), nil
+}
+
+// firstSheet returns worksheet part of only sheet in workbook
+func firstSheet(files map[string]*zip.File) (*zip.File, error) {
+	var wb struct {
+		Sheets []struct {
+			ID string `xml:"http://schemas.openxmlformats.org/officeDocument/2006/relationships id,attr"`
+		} `xml:"sheets>sheet"`
+	}
+	if err := decodePart(files, "xl/workbook.xml", &wb); err != nil {
+		return nil, err
+	}
+	if len(wb.Sheets) != 1 {
+		return nil, errors.New("xslx file should contain exactly one sheet")
+	}
+	var rels struct {
+		Relationships []struct {
+			ID     string `xml:"Id,attr"`
+			Target string `xml:"Target,attr"`
+		} `xml:"Relationship"`
+	}
+	if err := decodePart(files, "xl/_rels/workbook.xml.rels", &rels); err != nil {
+		return nil, err
+	}
+	for _, rel := range rels.Relationships {
+		if rel.ID != wb.Sheets[0].ID {
+			continue
 		}
-		row := file.Row{
-			Destination: num,
-			Params:      map[string]string{},
+		name := strings.TrimPrefix(rel.Target, "/")
+		if !strings.HasPrefix(name, "xl/") {
+			name = path.Join("xl", name)
 		}
-		for j := 1; j < len(keys) && j < len(xlFile.Sheets[0].Rows[i].Cells); j++ {
-			val := xlFile.Sheets[0].Rows[i].Cells[j].Value
-			val = strings.Trim(val, "\t\n\v\f\r \u0085\u00a0")
-			if val == "" {
-				return numbers, fmt.Errorf("row number %d contains no value at cell number %d", i, j)
-			}
-			row.Params[keys[j]] = val
+		if f, ok := files[name]; ok {
+			return f, nil
+		}
+	}
+	return nil, errors.New("couldn't find sheet in xlsx file")
+}
+
+// sharedStrings returns shared strings table of workbook, it's empty if workbook doesn't have one
+func sharedStrings(files map[string]*zip.File) ([]string, error) {
+	if _, ok := files["xl/sharedStrings.xml"]; !ok {
+		return nil, nil
+	}
+	var sst struct {
+		Items []struct {
+			T string `xml:"t"`
+			R []struct {
+				T string `xml:"t"`
+			} `xml:"r"`
+		} `xml:"si"`
+	}
+	if err := decodePart(files, "xl/sharedStrings.xml", &sst); err != nil {
+		return nil, err
+	}
+	shared := make([]string, len(sst.Items))
+	for i, si := range sst.Items {
+		shared[i] = si.T
+		// rich text is split in runs
+		for _, r := range si.R {
+			shared[i] += r.T
 		}
-		numbers[row.Destination] = row
 	}
-	return numbers, nil
+	return shared, nil
 }
 
-func validateFile(xlFile *xlsx.File) error {
-	if len(xlFile.Sheets) != 1 {
-		return errors.New("xslx file should contain exactly one sheet")
+func decodePart(files map[string]*zip.File, name string, v interface{}) error {
+	f, ok := files[name]
+	if !ok {
+		return fmt.Errorf("xlsx file doesn't have %s", name)
 	}
-	if len(xlFile.Sheets[0].Rows) < 2 {
+	rc, err := f.Open()
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+	return xml.NewDecoder(rc).Decode(v)
+}
+
+// cell is a c element of sheet xml
+type cell struct {
+	Ref    string `xml:"r,attr"`
+	Type   string `xml:"t,attr"`
+	Value  string `xml:"v"`
+	Inline string `xml:"is>t"`
+}
+
+// rows reads rows of a sheet one at a time
+type rows struct {
+	dec    *xml.Decoder
+	closer io.Closer
+	shared []string
+	keys   []string
+	// n is number of current row in sheet
+	n    int
+	read int
+}
+
+// readHeader reads first row of sheet, its cells are names of params
+func (r *rows) readHeader() error {
+	cells, err := r.next()
+	if err == io.EOF {
 		return errors.New("xslx file is empty")
 	}
-	if len(xlFile.Sheets[0].Rows[0].Cells) == 0 || xlFile.Sheets[0].Rows[0].Cells[0].Value != "Destination" {
+	if err != nil {
+		return err
+	}
+	if len(cells) == 0 || cells[0] != "Destination" {
 		return errors.New("first cell of excel sheet must be Destination header")
 	}
+	r.keys = cells
 	return nil
 }
+
+// Next returns next record of sheet
+func (r *rows) Next() (file.Row, error) {
+	cells, err := r.next()
+	if err == io.EOF {
+		r.closer.Close()
+		if r.read == 0 {
+			return file.Row{}, errors.New("xslx file is empty")
+		}
+		return file.Row{}, io.EOF
+	}
+	if err != nil {
+		r.closer.Close()
+		return file.Row{}, err
+	}
+	r.read++
+	if len(cells) < 1 {
+		return file.Row{}, fmt.Errorf("row number %d doesn't have any value", r.n)
+	}
+	num := strings.Trim(cells[0], "\t\n\v\f\r \u0085\u00a0")
+	if len(cells) < len(r.keys) {
+		return file.Row{}, fmt.Errorf("row number %d has blank values for some parameters", r.n)
+	}
+	row := file.Row{
+		Destination: num,
+		Params:      map[string]string{},
+		Line:        r.n,
+	}
+	for j := 1; j < len(r.keys); j++ {
+		val := strings.Trim(cells[j], "\t\n\v\f\r \u0085\u00a0")
+		if val == "" {
+			return row, fmt.Errorf("row number %d contains no value at cell number %d", r.n, j+1)
+		}
+		row.Params[r.keys[j]] = val
+	}
+	return row, nil
+}
+
+// next returns values of cells of next row, placed at their column index
+func (r *rows) next() ([]string, error) {
+	for {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		start, ok := tok.(xml.StartElement)
+		if !ok || start.Name.Local != "row" {
+			continue
+		}
+		r.n++
+		for _, a := range start.Attr {
+			if a.Name.Local == "r" {
+				if n, err := strconv.Atoi(a.Value); err == nil {
+					r.n = n
+				}
+			}
+		}
+		return r.cells()
+	}
+}
+
+// cells reads c elements until end of current row
+func (r *rows) cells() ([]string, error) {
+	var values []string
+	for {
+		tok, err := r.dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Local != "c" {
+				continue
+			}
+			var c cell
+			if err := r.dec.DecodeElement(&c, &t); err != nil {
+				return nil, err
+			}
+			// empty cells aren't written in sheet, so column is taken from cell reference
+			col := len(values)
+			if c.Ref != "" {
+				col = column(c.Ref)
+			}
+			for len(values) < col {
+				values = append(values, "")
+			}
+			values = append(values, r.value(c))
+		case xml.EndElement:
+			if t.Name.Local == "row" {
+				// trailing empty cells don't count as values
+				for len(values) > 0 && values[len(values)-1] == "" {
+					values = values[:len(values)-1]
+				}
+				return values, nil
+			}
+		}
+	}
+}
+
+func (r *rows) value(c cell) string {
+	switch c.Type {
+	case "s":
+		i, err := strconv.Atoi(c.Value)
+		if err != nil || i < 0 || i >= len(r.shared) {
+			return ""
+		}
+		return r.shared[i]
+	case "inlineStr":
+		return c.Inline
+	}
+	return c.Value
+}
+
+// column returns zero based column index of a cell reference such as "AB12"
+func column(ref string) int {
+	col := 0
+	for _, ch := range ref {
+		if ch < 'A' || ch > 'Z' {
+			break
+		}
+		col = col*26 + int(ch-'A'+1)
+	}
+	return col - 1
+}
@@ -0,0 +1,68 @@
+package excel
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
+	"github.com/tealeg/xlsx"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func xlsxFile(t *testing.T, rows [][]string) *bytes.Reader {
+	f := xlsx.NewFile()
+	sheet, err := f.AddSheet("Sheet1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cells := range rows {
+		row := sheet.AddRow()
+		for _, v := range cells {
+			row.AddCell().SetString(v)
+		}
+	}
+	var b bytes.Buffer
+	if err := f.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return bytes.NewReader(b.Bytes())
+}
+
+func TestToNumbers(t *testing.T) {
+	assert := assert.New(t)
+	rows, err := ToNumbers(xlsxFile(t, [][]string{
+		{"Destination", "Name"},
+		{"971500000002", "Bob"},
+		{"971500000001", "Alice"},
+	}))
+	assert.Nil(err)
+	var got []file.Row
+	assert.Nil(file.Each(rows, func(r file.Row) error {
+		got = append(got, r)
+		return nil
+	}))
+	assert.Equal([]file.Row{
+		{Destination: "971500000002", Params: map[string]string{"Name": "Bob"}, Line: 2},
+		{Destination: "971500000001", Params: map[string]string{"Name": "Alice"}, Line: 3},
+	}, got)
+
+	rows, err = ToNumbers(xlsxFile(t, [][]string{
+		{"Destination", "Name"},
+		{"971500000002", "Bob"},
+		{"123", "Alice"},
+	}))
+	assert.Nil(err)
+	// numbers are validated when they're normalized, error has row of invalid number
+	rows = file.Normalize(rows, "numbers.xlsx", "")
+	_, err = rows.Next()
+	assert.Nil(err)
+	_, err = rows.Next()
+	assert.EqualError(err, "number 123 on line 3 in file numbers.xlsx is invalid; number 123 must have 7 to 15 digits including country code")
+
+	_, err = ToNumbers(xlsxFile(t, [][]string{{"Number"}}))
+	assert.NotNil(err)
+	rows, err = ToNumbers(xlsxFile(t, [][]string{{"Destination"}}))
+	assert.Nil(err)
+	_, err = rows.Next()
+	assert.EqualError(err, "xslx file is empty")
+}
@@ -0,0 +1,434 @@
+// Package generator generates messages of campaigns.
+// Every campaign has a job in job store which moves from Pending to Generating while its messages are inserted in
+// batches, to Ready once all messages are inserted and to Completed when campaign has no pending messages left.
+// Messages to numbers which have opted out are inserted as Suppressed, so they're counted in campaign but never sent.
+// Campaign is charged for all its segments when it's started, segments of suppressed messages are refunded after
+// their batch is inserted.
+// Messages are inserted as Paused while campaign is paused. Job is marked Stopping when campaign is stopped, generator
+// stops inserting its messages, refunds segments of messages it hasn't inserted and marks it Stopped.
+// Job is Failed if messages can't be inserted, segments of messages which weren't inserted are refunded. Checkpoint
+// of job is saved after every batch.
+// Jobs are updated with optimistic locking, so if a process dies while generating, another process can take its job
+// over after Lease has passed and continue from number of messages found in message store, without duplicating any.
+package generator
+
+import (
+	"context"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/campaign"
+	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/optout"
+	"github.com/haisum/smpp-app/pkg/entities/template"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultInterval is time to wait between checks for interrupted and ready jobs
+	DefaultInterval = 10 * time.Second
+	// DefaultLease is time after which a Pending or Generating job which hasn't been updated is considered interrupted
+	DefaultLease = 2 * time.Minute
+)
+
+// errTakenOver stops generating messages of a job which has been updated by another process
+var errTakenOver = errors.New("job was taken over by another process")
+
+// Generator inserts messages of campaign jobs and resumes interrupted jobs
+type Generator struct {
+	jobStore         campaign.JobStore
+	campaignStore    campaign.Store
+	msgStore         message.Store
+	optOutStore      optout.Store
+	creditStore      credit.Store
+	fileStore        file.Store
+	fileManager      file.OpenReadWriteCloser
+	processExcelFunc file.ProcessExcelFunc
+	log              logger.Logger
+	Interval         time.Duration
+	Lease            time.Duration
+}
+
+// New returns a new generator
+func New(jobStore campaign.JobStore, campaignStore campaign.Store, msgStore message.Store, optOutStore optout.Store, creditStore credit.Store, fileStore file.Store, fileManager file.OpenReadWriteCloser, processExcelFunc file.ProcessExcelFunc, log logger.Logger) *Generator {
+	return &Generator{
+		jobStore:         jobStore,
+		campaignStore:    campaignStore,
+		msgStore:         msgStore,
+		optOutStore:      optOutStore,
+		creditStore:      creditStore,
+		fileStore:        fileStore,
+		fileManager:      fileManager,
+		processExcelFunc: processExcelFunc,
+		log:              log,
+		Interval:         DefaultInterval,
+		Lease:            DefaultLease,
+	}
+}
+
+// Run resumes interrupted jobs and completes ready jobs until ctx is done
+func (g *Generator) Run(ctx context.Context) {
+	for {
+		g.resume()
+		g.complete()
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(g.Interval):
+		}
+	}
+}
+
+// Generate inserts messages of c for job j. Recipients are read from campaign's file or numbers of job, in batches
+// of MaxInsertCount. Generate returns when job is Ready or Failed, or another process has taken job over.
+func (g *Generator) Generate(j campaign.Job, c *campaign.Campaign) {
+	log := g.log.(logger.WithLogger).With("campaign", c.ID, "job", j.ID)
+	rows, closeRows, err := g.Rows(c, j.Params)
+	if err != nil {
+		g.fail(&j, c, errors.Wrap(err, "couldn't read numbers"), log)
+		return
+	}
+	defer closeRows()
+	// a crash may have happened after a batch was inserted but before checkpoint was saved, so checkpoint is
+	// taken from store. Rows are read in same order every time and a batch is inserted in one statement.
+	stats, err := g.msgStore.Stats(&message.Criteria{CampaignID: c.ID})
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't count inserted messages")
+		return
+	}
+	j.Checkpoint = int(stats.Total)
+	j.Status = campaign.JobGenerating
+	if !g.update(&j, log) {
+		g.takenOver(c, log)
+		return
+	}
+	if j.Checkpoint > 0 {
+		log.Info("msg", "resuming job", "checkpoint", j.Checkpoint, "total", j.Total)
+	}
+	var (
+		ms []message.Message
+		n  int
+	)
+	// save inserts messages in ms and saves checkpoint. Job is read again before every batch, so batches aren't
+	// inserted once campaign is stopped and are inserted as paused while it's paused.
+	save := func() error {
+		cur, err := g.job(c.ID)
+		if err != nil {
+			return err
+		}
+		if cur.Version != j.Version {
+			return errTakenOver
+		}
+		if err := g.suppress(c.Username, ms); err != nil {
+			return err
+		}
+		if cur.Paused {
+			pause(ms)
+		}
+		if _, err := g.msgStore.SaveBulk(ms); err != nil {
+			return errors.Wrap(err, "couldn't save messages")
+		}
+		g.refund(c, ms, log)
+		g.syncPause(c, cur.Paused, log)
+		j.Checkpoint += len(ms)
+		ms = ms[:0]
+		if !g.update(&j, log) {
+			return errTakenOver
+		}
+		return nil
+	}
+	err = file.Each(rows, func(r file.Row) error {
+		n++
+		if n <= j.Checkpoint {
+			return nil
+		}
+		ms = append(ms, Render(c, j.Params, r))
+		if len(ms) == g.msgStore.MaxInsertCount() {
+			return save()
+		}
+		return nil
+	})
+	if err == nil && len(ms) > 0 {
+		err = save()
+	}
+	if err == errTakenOver {
+		g.takenOver(c, log)
+		return
+	}
+	if err != nil {
+		g.fail(&j, c, err, log)
+		return
+	}
+	j.Total = n
+	j.Status = campaign.JobReady
+	if !g.update(&j, log) {
+		g.takenOver(c, log)
+	}
+}
+
+// Rows returns recipients of campaign c read from its file, or from comma separated numbers in p if it doesn't have
+// a file. closeRows must be called once rows aren't needed anymore.
+func (g *Generator) Rows(c *campaign.Campaign, p campaign.JobParams) (rows file.Rows, closeRows func(), err error) {
+	if c.FileID == 0 {
+		return file.StringRows(p.Numbers, p.CountryCode), func() {}, nil
+	}
+	files, err := g.fileStore.List(&file.Criteria{ID: c.FileID})
+	if err != nil {
+		return nil, nil, err
+	}
+	if len(files) == 0 {
+		return nil, nil, errors.New("couldn't find file")
+	}
+	reader, err := g.fileManager.Open(files[0].Name)
+	if err != nil {
+		return nil, nil, err
+	}
+	rows, err = file.NewRows(&files[0], g.processExcelFunc, reader, p.CountryCode)
+	if err != nil {
+		reader.Close()
+		return nil, nil, err
+	}
+	return rows, func() { reader.Close() }, nil
+}
+
+// Render makes message of campaign c for recipient r. c.Msg is masked text of campaign and p.Msg is its unmasked version.
+func Render(c *campaign.Campaign, p campaign.JobParams, r file.Row) message.Message {
+	status := message.Queued
+	if c.ScheduledAt > 0 {
+		status = message.Scheduled
+	}
+	maskedMsg := template.Render(c.Msg, r.Params)
+	realMsg := template.Render(p.Msg, r.Params)
+	if p.AllowMissing {
+		realMsg = template.Render(realMsg, p.Defaults)
+		maskedMsg = template.Render(maskedMsg, p.Defaults)
+	}
+	// params may have characters which need a different encoding than template, so encoding is detected for
+	// every message
+	enc := message.DetectEnc(realMsg)
+	return message.Message{
+		ConnectionGroup: p.ConnectionGroup,
+		Username:        c.Username,
+		Msg:             maskedMsg,
+		RealMsg:         realMsg,
+		Enc:             enc,
+		Dst:             r.Destination,
+		OriginalDst:     r.Original,
+		Src:             c.Src,
+		Priority:        c.Priority,
+		QueuedAt:        time.Now().UTC().Unix(),
+		Status:          status,
+		CampaignID:      c.ID,
+		SendBefore:      c.SendBefore,
+		SendAfter:       c.SendAfter,
+		TimeZone:        c.TimeZone,
+		ScheduledAt:     c.ScheduledAt,
+		Total:           message.Total(realMsg, enc),
+		Campaign:        c.Description,
+		IsFlash:         p.IsFlash,
+	}
+}
+
+// suppress marks messages whose destinations have opted out globally or from messages of username as Suppressed
+func (g *Generator) suppress(username string, ms []message.Message) error {
+	numbers := make([]string, len(ms))
+	for i, m := range ms {
+		numbers[i] = m.Dst
+	}
+	suppressed, err := g.optOutStore.Suppressed(username, numbers)
+	if err != nil {
+		return errors.Wrap(err, "couldn't get opt outs")
+	}
+	for i := range ms {
+		if suppressed[ms[i].Dst] {
+			ms[i].Status = message.Suppressed
+		}
+	}
+	return nil
+}
+
+// refund returns segments of suppressed messages in ms to owner of campaign c
+func (g *Generator) refund(c *campaign.Campaign, ms []message.Message, log logger.Logger) {
+	var segments int64
+	for _, m := range ms {
+		if m.Status == message.Suppressed {
+			segments += int64(m.Total)
+		}
+	}
+	if err := credit.RefundSegments(g.creditStore, c.Username, segments, c.ID, "suppressed messages"); err != nil {
+		log.Error("error", err, "msg", "couldn't refund suppressed messages", "segments", segments)
+	}
+}
+
+// pause marks messages in ms which aren't suppressed as paused
+func pause(ms []message.Message) {
+	for i := range ms {
+		if ms[i].Status != message.Suppressed {
+			ms[i].Status = message.Paused
+		}
+	}
+}
+
+// syncPause pauses or resumes messages of c if campaign was paused or resumed after job was read for a batch which
+// was inserted with paused as its state, so messages of that batch aren't left in wrong state
+func (g *Generator) syncPause(c *campaign.Campaign, paused bool, log logger.Logger) {
+	cur, err := g.job(c.ID)
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't read job after inserting messages")
+		return
+	}
+	if cur.Paused == paused {
+		return
+	}
+	if cur.Paused {
+		_, err = g.msgStore.PausePending(c.ID)
+	} else {
+		_, err = g.msgStore.ResumePaused(c.ID, time.Now().UTC().Unix())
+	}
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't update messages of campaign which was paused or resumed", "paused", cur.Paused)
+	}
+}
+
+// job returns job of campaign campID
+func (g *Generator) job(campID int64) (campaign.Job, error) {
+	jobs, err := g.jobStore.List(&campaign.JobCriteria{CampaignID: campID})
+	if err != nil {
+		return campaign.Job{}, errors.Wrap(err, "couldn't read job")
+	}
+	if len(jobs) == 0 {
+		return campaign.Job{}, errors.New("couldn't find job")
+	}
+	return jobs[0], nil
+}
+
+// takenOver is called when job of c has been updated by another process. If campaign was stopped, messages of job
+// are stopped.
+func (g *Generator) takenOver(c *campaign.Campaign, log logger.Logger) {
+	j, err := g.job(c.ID)
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't read job which was taken over")
+		return
+	}
+	if j.Status == campaign.JobStopping {
+		g.stop(&j, c, log)
+	}
+}
+
+// stop stops messages of a Stopping job which were inserted after its campaign was stopped and marks it Stopped.
+// Segments of stopped messages and of messages which weren't inserted are refunded, latter only by process which
+// could save job, so they aren't refunded twice.
+func (g *Generator) stop(j *campaign.Job, c *campaign.Campaign, log logger.Logger) {
+	_, segments, err := g.msgStore.StopPending(c.ID)
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't stop messages of stopped campaign")
+		return
+	}
+	if err := credit.RefundSegments(g.creditStore, c.Username, segments, c.ID, "stopped messages"); err != nil {
+		log.Error("error", err, "msg", "couldn't refund stopped messages", "segments", segments)
+	}
+	j.Status = campaign.JobStopped
+	if !g.update(j, log) {
+		return
+	}
+	stats, err := g.msgStore.Stats(&message.Criteria{CampaignID: c.ID})
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't count inserted segments, stopped job isn't refunded", "segments", j.Segments)
+		return
+	}
+	segments = j.Segments - stats.Segments
+	if segments <= 0 {
+		return
+	}
+	if err := credit.RefundSegments(g.creditStore, c.Username, segments, c.ID, "campaign stopped"); err != nil {
+		log.Error("error", err, "msg", "couldn't refund messages which weren't generated", "segments", segments)
+	}
+}
+
+// resume generates messages of jobs which haven't been updated for Lease and stops jobs which were stopped while
+// they were being generated
+func (g *Generator) resume() {
+	jobs, err := g.jobStore.List(&campaign.JobCriteria{
+		Statuses:      []campaign.JobStatus{campaign.JobPending, campaign.JobGenerating, campaign.JobStopping},
+		UpdatedBefore: time.Now().Add(-g.Lease).UTC().Unix(),
+	})
+	if err != nil {
+		g.log.Error("error", err, "msg", "couldn't list interrupted jobs")
+		return
+	}
+	for _, j := range jobs {
+		cs, err := g.campaignStore.List(&campaign.Criteria{ID: j.CampaignID})
+		if err != nil || len(cs) == 0 {
+			g.log.Error("error", err, "msg", "couldn't get campaign of job", "job", j.ID, "campaign", j.CampaignID)
+			continue
+		}
+		if j.Status == campaign.JobStopping {
+			g.stop(&j, &cs[0], g.log)
+			continue
+		}
+		g.Generate(j, &cs[0])
+	}
+}
+
+// complete marks ready jobs whose campaigns have no pending messages as completed
+func (g *Generator) complete() {
+	jobs, err := g.jobStore.List(&campaign.JobCriteria{
+		Statuses: []campaign.JobStatus{campaign.JobReady},
+	})
+	if err != nil {
+		g.log.Error("error", err, "msg", "couldn't list ready jobs")
+		return
+	}
+	for _, j := range jobs {
+		stats, err := g.msgStore.Stats(&message.Criteria{CampaignID: j.CampaignID})
+		if err != nil {
+			g.log.Error("error", err, "msg", "couldn't get campaign stats", "campaign", j.CampaignID)
+			continue
+		}
+		if stats.Queued+stats.Sending+stats.Scheduled+stats.Held+stats.Paused > 0 {
+			continue
+		}
+		j.Status = campaign.JobCompleted
+		g.update(&j, g.log)
+	}
+}
+
+// update saves j and returns false if it couldn't be saved or another process has updated it
+func (g *Generator) update(j *campaign.Job, log logger.Logger) bool {
+	j.UpdatedAt = time.Now().UTC().Unix()
+	ok, err := g.jobStore.Update(j)
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't update job", "status", j.Status)
+		return false
+	}
+	if !ok {
+		log.Info("msg", "job was taken over by another process", "status", j.Status)
+	}
+	return ok
+}
+
+// fail marks j as Failed and refunds segments charged for messages of c which weren't inserted. Refund is only made
+// by process which could save job, so it isn't made twice.
+func (g *Generator) fail(j *campaign.Job, c *campaign.Campaign, err error, log logger.Logger) {
+	log.Error("error", err, "msg", "job failed")
+	j.Status = campaign.JobFailed
+	j.Error = err.Error()
+	if !g.update(j, log) {
+		g.takenOver(c, log)
+		return
+	}
+	stats, err := g.msgStore.Stats(&message.Criteria{CampaignID: c.ID})
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't count inserted segments, failed job isn't refunded", "segments", j.Segments)
+		return
+	}
+	segments := j.Segments - stats.Segments
+	if segments <= 0 {
+		return
+	}
+	if err := credit.RefundSegments(g.creditStore, c.Username, segments, c.ID, "campaign failed"); err != nil {
+		log.Error("error", err, "msg", "couldn't refund failed job", "segments", segments)
+	}
+}
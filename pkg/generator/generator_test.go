@@ -0,0 +1,288 @@
+package generator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/campaign"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/optout"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// memMsgStore is an in memory message.Store which only implements SaveBulk, Stats, StopPending, PausePending and
+// MaxInsertCount. SaveBulk fails after failAfter successful calls if failAfter is more than zero. beforeSave is
+// called with number of call before messages are saved.
+type memMsgStore struct {
+	message.Store
+	msgs       []message.Message
+	calls      int
+	failAfter  int
+	beforeSave func(call int)
+}
+
+func (s *memMsgStore) SaveBulk(ms []message.Message) ([]int64, error) {
+	s.calls++
+	if s.failAfter > 0 && s.calls > s.failAfter {
+		return nil, errors.New("connection lost")
+	}
+	if s.beforeSave != nil {
+		s.beforeSave(s.calls)
+	}
+	s.msgs = append(s.msgs, ms...)
+	return nil, nil
+}
+
+func (s *memMsgStore) StopPending(campID int64) (int64, int64, error) {
+	var stopped, segments int64
+	for i, m := range s.msgs {
+		if m.CampaignID == campID && (m.Status == message.Queued || m.Status == message.Paused) {
+			s.msgs[i].Status = message.Stopped
+			stopped++
+			segments += int64(m.Total)
+		}
+	}
+	return stopped, segments, nil
+}
+
+func (s *memMsgStore) PausePending(campID int64) (int64, error) {
+	var paused int64
+	for i, m := range s.msgs {
+		if m.CampaignID == campID && m.Status == message.Queued {
+			s.msgs[i].Status = message.Paused
+			paused++
+		}
+	}
+	return paused, nil
+}
+
+func (s *memMsgStore) Stats(c *message.Criteria) (*message.Stats, error) {
+	st := &message.Stats{}
+	for _, m := range s.msgs {
+		if m.CampaignID == c.CampaignID {
+			st.Total++
+			st.Segments += int64(m.Total)
+			if m.Status == message.Queued {
+				st.Queued++
+			}
+		}
+	}
+	return st, nil
+}
+
+func (s *memMsgStore) MaxInsertCount() int {
+	return 3
+}
+
+type memOptOutStore struct {
+	optout.Store
+	numbers map[string]bool
+}
+
+func (s *memOptOutStore) Suppressed(username string, numbers []string) (map[string]bool, error) {
+	suppressed := make(map[string]bool)
+	for _, n := range numbers {
+		suppressed[n] = s.numbers[n]
+	}
+	return suppressed, nil
+}
+
+type memCreditStore struct {
+	credit.Store
+	entries []credit.Entry
+}
+
+func (s *memCreditStore) Add(e *credit.Entry) error {
+	s.entries = append(s.entries, *e)
+	return nil
+}
+
+type memJobStore struct {
+	jobs map[int64]campaign.Job
+}
+
+func (s *memJobStore) Add(j *campaign.Job) (int64, error) {
+	j.ID = int64(len(s.jobs) + 1)
+	s.jobs[j.ID] = *j
+	return j.ID, nil
+}
+
+func (s *memJobStore) Update(j *campaign.Job) (bool, error) {
+	if s.jobs[j.ID].Version != j.Version {
+		return false, nil
+	}
+	j.Version++
+	s.jobs[j.ID] = *j
+	return true, nil
+}
+
+func (s *memJobStore) Pause(campaignID int64, paused bool) error {
+	for id, j := range s.jobs {
+		if j.CampaignID == campaignID {
+			j.Paused = paused
+			s.jobs[id] = j
+		}
+	}
+	return nil
+}
+
+func (s *memJobStore) List(c *campaign.JobCriteria) ([]campaign.Job, error) {
+	var jobs []campaign.Job
+	for _, j := range s.jobs {
+		if c.UpdatedBefore != 0 && j.UpdatedAt >= c.UpdatedBefore {
+			continue
+		}
+		if c.CampaignID != 0 && j.CampaignID != c.CampaignID {
+			continue
+		}
+		if len(c.Statuses) == 0 {
+			jobs = append(jobs, j)
+		}
+		for _, st := range c.Statuses {
+			if j.Status == st {
+				jobs = append(jobs, j)
+			}
+		}
+	}
+	return jobs, nil
+}
+
+type memCampaignStore struct {
+	campaign.Store
+	c campaign.Campaign
+}
+
+func (s *memCampaignStore) List(c *campaign.Criteria) ([]campaign.Campaign, error) {
+	return []campaign.Campaign{s.c}, nil
+}
+
+func TestGenerator_Resume(t *testing.T) {
+	assert := assert.New(t)
+	var numbers []string
+	for i := 0; i < 10; i++ {
+		numbers = append(numbers, fmt.Sprintf("97150000000%d", i))
+	}
+	c := campaign.Campaign{ID: 7, Msg: "hello", Src: "Src", Username: "user"}
+	// duplicate numbers are skipped, even if they're in national format
+	p := campaign.JobParams{Msg: "hello", Numbers: strings.Join(append(numbers, "0500000003"), ","), ConnectionGroup: "Default", CountryCode: "971"}
+	msgStore := &memMsgStore{failAfter: 2}
+	jobStore := &memJobStore{jobs: make(map[int64]campaign.Job)}
+	optOutStore := &memOptOutStore{numbers: map[string]bool{"+" + numbers[4]: true}}
+	creditStore := &memCreditStore{}
+	g := New(jobStore, &memCampaignStore{c: c}, msgStore, optOutStore, creditStore, nil, nil, nil, logger.Get())
+	j := campaign.Job{CampaignID: c.ID, Status: campaign.JobPending, Params: p, Segments: 10}
+	jobStore.Add(&j)
+
+	// first run dies after two batches, segments of messages which weren't inserted are refunded
+	g.Generate(j, &c)
+	assert.Len(msgStore.msgs, 6)
+	assert.Equal(campaign.JobFailed, jobStore.jobs[j.ID].Status)
+	if assert.Len(creditStore.entries, 2) {
+		assert.Equal(credit.Refund, creditStore.entries[1].Kind)
+		assert.Equal(int64(4), creditStore.entries[1].Amount)
+		assert.Equal(c.ID, creditStore.entries[1].CampaignID)
+	}
+
+	// simulate a crash between insert and checkpoint: job is still generating with an old checkpoint
+	j = jobStore.jobs[j.ID]
+	j.Status = campaign.JobGenerating
+	j.Checkpoint = 3
+	j.Error = ""
+	j.UpdatedAt = time.Now().Add(-time.Hour).Unix()
+	jobStore.jobs[j.ID] = j
+	msgStore.failAfter = 0
+	g.resume()
+	j = jobStore.jobs[j.ID]
+	assert.Equal(campaign.JobReady, j.Status)
+	assert.Equal(10, j.Checkpoint)
+	assert.Equal(10, j.Total)
+	assert.Len(msgStore.msgs, 10)
+	seen := make(map[string]bool)
+	for i, m := range msgStore.msgs {
+		assert.False(seen[m.Dst], "duplicate destination %s", m.Dst)
+		seen[m.Dst] = true
+		assert.Equal("+"+numbers[i], m.Dst)
+		assert.Equal(numbers[i], m.OriginalDst)
+		assert.Equal("Default", m.ConnectionGroup)
+		if i == 4 {
+			assert.Equal(message.Suppressed, m.Status)
+		} else {
+			assert.Equal(message.Queued, m.Status)
+		}
+	}
+
+	// suppressed message is refunded once
+	if assert.Len(creditStore.entries, 2) {
+		assert.Equal(credit.Refund, creditStore.entries[0].Kind)
+		assert.Equal(int64(1), creditStore.entries[0].Amount)
+		assert.Equal(c.ID, creditStore.entries[0].CampaignID)
+	}
+
+	// job is completed once nothing is pending
+	g.complete()
+	assert.Equal(campaign.JobReady, jobStore.jobs[j.ID].Status)
+	for i := range msgStore.msgs {
+		msgStore.msgs[i].Status = message.Delivered
+	}
+	g.complete()
+	assert.Equal(campaign.JobCompleted, jobStore.jobs[j.ID].Status)
+}
+
+func TestGenerator_StopAndPause(t *testing.T) {
+	assert := assert.New(t)
+	var numbers []string
+	for i := 0; i < 10; i++ {
+		numbers = append(numbers, fmt.Sprintf("97150000000%d", i))
+	}
+	c := campaign.Campaign{ID: 7, Msg: "hello", Src: "Src", Username: "user"}
+	p := campaign.JobParams{Msg: "hello", Numbers: strings.Join(numbers, ","), ConnectionGroup: "Default", CountryCode: "971"}
+	msgStore := &memMsgStore{}
+	jobStore := &memJobStore{jobs: make(map[int64]campaign.Job)}
+	creditStore := &memCreditStore{}
+	g := New(jobStore, &memCampaignStore{c: c}, msgStore, &memOptOutStore{}, creditStore, nil, nil, nil, logger.Get())
+	j := campaign.Job{CampaignID: c.ID, Status: campaign.JobPending, Params: p, Segments: 10}
+	jobStore.Add(&j)
+
+	var paused []message.Status
+	msgStore.beforeSave = func(call int) {
+		switch call {
+		case 1:
+			// campaign is paused after generator has read job for first batch
+			jobStore.Pause(c.ID, true)
+			msgStore.PausePending(c.ID)
+		case 2:
+			// second batch is inserted as paused, campaign is stopped after generator has read job for it
+			for _, m := range msgStore.msgs {
+				paused = append(paused, m.Status)
+			}
+			cur := jobStore.jobs[j.ID]
+			cur.Status = campaign.JobStopping
+			jobStore.Update(&cur)
+			_, segments, _ := msgStore.StopPending(c.ID)
+			credit.RefundSegments(creditStore, c.Username, segments, c.ID, "stopped messages")
+		}
+	}
+	g.Generate(j, &c)
+
+	// first batch was paused once generator found campaign was paused after inserting it
+	assert.Equal([]message.Status{message.Paused, message.Paused, message.Paused}, paused)
+	// second batch was stopped by generator and third batch was never inserted
+	assert.Equal(campaign.JobStopped, jobStore.jobs[j.ID].Status)
+	if assert.Len(msgStore.msgs, 6) {
+		for _, m := range msgStore.msgs {
+			assert.Equal(message.Stopped, m.Status)
+		}
+	}
+	// every charged segment is refunded once
+	var refunded int64
+	for _, e := range creditStore.entries {
+		assert.Equal(credit.Refund, e.Kind)
+		refunded += e.Amount
+	}
+	assert.Equal(int64(10), refunded)
+}
@@ -0,0 +1,182 @@
+// Package gsm7 encodes text in GSM 03.38 7 bit default alphabet.
+// Characters of basic table take one septet, characters of extension table are escaped and take two.
+// Text codecs in this package implement pdutext.Codec so they can be used in place of go-smpp codecs.
+package gsm7
+
+import (
+	"strings"
+
+	"github.com/fiorix/go-smpp/smpp/pdu/pdutext"
+)
+
+// DefaultType is data_coding value for SMSC default alphabet
+const DefaultType pdutext.DataCoding = 0x00
+
+const (
+	// esc is escape septet which precedes characters of extension table
+	esc byte = 0x1B
+	// unknown is septet used for characters which aren't in alphabet, it's a question mark
+	unknown byte = 0x3F
+)
+
+// basic is GSM 03.38 basic character table, index of a character is its septet. Escape is at 0x1B.
+const basic = "@£$¥èéùìòÇ\nØø\rÅåΔ_ΦΓΛΩΠΨΣΘΞ\x1bÆæßÉ !\"#¤%&'()*+,-./0123456789:;<=>?" +
+	"¡ABCDEFGHIJKLMNOPQRSTUVWXYZÄÖÑÜ§¿abcdefghijklmnopqrstuvwxyzäöñüà"
+
+// extension is GSM 03.38 extension table, septets are sent after esc
+var extension = map[rune]byte{
+	'\f': 0x0A, '^': 0x14, '{': 0x28, '}': 0x29, '\\': 0x2F, '[': 0x3C, '~': 0x3D, ']': 0x3E, '|': 0x40, '€': 0x65,
+}
+
+var (
+	basicSeptets  = map[rune]byte{}
+	basicRunes    [128]rune
+	extensionRune = map[byte]rune{}
+)
+
+func init() {
+	i := 0
+	for _, r := range basic {
+		basicRunes[i] = r
+		if byte(i) != esc {
+			basicSeptets[r] = byte(i)
+		}
+		i++
+	}
+	for r, s := range extension {
+		extensionRune[s] = r
+	}
+}
+
+// Valid returns true if all characters of s are in basic or extension table
+func Valid(s string) bool {
+	for _, r := range s {
+		if _, ok := basicSeptets[r]; ok {
+			continue
+		}
+		if _, ok := extension[r]; !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// IsExtension returns true if r is in extension table and takes two septets
+func IsExtension(r rune) bool {
+	_, ok := extension[r]
+	return ok
+}
+
+// Encode returns septets of s, one per byte. Characters which aren't in alphabet are replaced with question mark.
+func Encode(s string) []byte {
+	septets := make([]byte, 0, len(s))
+	for _, r := range s {
+		if b, ok := basicSeptets[r]; ok {
+			septets = append(septets, b)
+		} else if b, ok := extension[r]; ok {
+			septets = append(septets, esc, b)
+		} else {
+			septets = append(septets, unknown)
+		}
+	}
+	return septets
+}
+
+// Decode returns text of septets. An escape followed by a septet not in extension table is decoded as basic character.
+func Decode(septets []byte) string {
+	var b strings.Builder
+	for i := 0; i < len(septets); i++ {
+		s := septets[i] & 0x7F
+		if s == esc && i+1 < len(septets) {
+			i++
+			if r, ok := extensionRune[septets[i]&0x7F]; ok {
+				b.WriteRune(r)
+				continue
+			}
+			s = septets[i] & 0x7F
+		}
+		b.WriteRune(basicRunes[s])
+	}
+	return b.String()
+}
+
+// Pack packs septets in octets, eight septets take seven octets
+func Pack(septets []byte) []byte {
+	packed := make([]byte, 0, (len(septets)*7+7)/8)
+	var (
+		acc  uint
+		bits uint
+	)
+	for _, s := range septets {
+		acc |= uint(s&0x7F) << bits
+		bits += 7
+		for bits >= 8 {
+			packed = append(packed, byte(acc))
+			acc >>= 8
+			bits -= 8
+		}
+	}
+	if bits > 0 {
+		packed = append(packed, byte(acc))
+	}
+	return packed
+}
+
+// Unpack unpacks octets packed with Pack. When seven octets carry only seven septets, last bits are padding and
+// the zero septet they unpack to is dropped.
+func Unpack(packed []byte) []byte {
+	septets := make([]byte, 0, len(packed)*8/7)
+	var (
+		acc  uint
+		bits uint
+	)
+	for _, o := range packed {
+		acc |= uint(o) << bits
+		bits += 8
+		for bits >= 7 {
+			septets = append(septets, byte(acc&0x7F))
+			acc >>= 7
+			bits -= 7
+		}
+	}
+	if len(packed)%7 == 0 && len(septets) > 0 && septets[len(septets)-1] == 0 {
+		septets = septets[:len(septets)-1]
+	}
+	return septets
+}
+
+// Text is GSM 7 bit codec which sends one septet per octet, this is what SMSCs expect for default alphabet over SMPP
+type Text []byte
+
+// Type implements the pdutext.Codec interface.
+func (t Text) Type() pdutext.DataCoding {
+	return DefaultType
+}
+
+// Encode to unpacked septets.
+func (t Text) Encode() []byte {
+	return Encode(string(t))
+}
+
+// Decode from unpacked septets.
+func (t Text) Decode() []byte {
+	return []byte(Decode(t))
+}
+
+// Packed is GSM 7 bit codec which packs eight septets in seven octets
+type Packed []byte
+
+// Type implements the pdutext.Codec interface.
+func (p Packed) Type() pdutext.DataCoding {
+	return DefaultType
+}
+
+// Encode to packed septets.
+func (p Packed) Encode() []byte {
+	return Pack(Encode(string(p)))
+}
+
+// Decode from packed septets.
+func (p Packed) Decode() []byte {
+	return []byte(Decode(Unpack(p)))
+}
@@ -0,0 +1,38 @@
+package gsm7
+
+import (
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestBasicTable(t *testing.T) {
+	assert.Len(t, []rune(basic), 128)
+}
+
+func TestValid(t *testing.T) {
+	assert := assert.New(t)
+	assert.True(Valid("Hello @ £5, café Ñandù €[]"))
+	assert.False(Valid("سلام"))
+	assert.False(Valid("naïve"))
+	assert.False(Valid("`"))
+}
+
+func TestEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]byte{0x00, 0x01, 0x05, 0x1B, 0x65, 0x41}, Encode("@£é€A"))
+	assert.Equal([]byte{0x3F}, Encode("ï"))
+	for _, s := range []string{"Hello world", "café €{x}", "ÄÖÑÜ§¿äöñüà"} {
+		assert.Equal(s, Decode(Encode(s)))
+		assert.Equal(s, string(Text(Text(s).Encode()).Decode()))
+	}
+}
+
+func TestPack(t *testing.T) {
+	assert := assert.New(t)
+	assert.Equal([]byte{0xE8, 0x32, 0x9B, 0xFD, 0x06}, Pack(Encode("hello")))
+	assert.Equal([]byte{0xE8, 0x32, 0x9B, 0xFD, 0x46, 0x97, 0xD9, 0xEC, 0x37}, Pack(Encode("hellohello")))
+	for _, s := range []string{"hello", "1234567", "12345678", "hellohello", "€"} {
+		assert.Equal(s, string(Packed(Packed(s).Encode()).Decode()))
+	}
+}
@@ -0,0 +1,88 @@
+package receiver
+
+import (
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/fiorix/go-smpp/smpp/pdu/pdutext"
+	"github.com/haisum/smpp-app/pkg/entities/inbound"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"github.com/haisum/smpp-app/pkg/gsm7"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+)
+
+const (
+	// esmClassUDHI is bit of esm_class which is set if short_message starts with user data header
+	esmClassUDHI = 0x40
+	// ia5Type is data_coding of IA5/ASCII text
+	ia5Type = 0x01
+)
+
+// saveInbound saves a mobile originated message received on connection conn in inbox of user who owns its destination
+func (r *Receiver) saveInbound(conn string, p *pdu.PDU) pdu.Status {
+	m := inbound.Message{
+		Src:        p.Fields.String(pdu.SourceAddr),
+		Dst:        p.Fields.String(pdu.DestinationAddr),
+		Connection: conn,
+		ReceivedAt: time.Now().UTC().Unix(),
+	}
+	m.Msg, m.Enc = decode(p)
+	username, err := r.owner(m.Dst)
+	if err != nil {
+		r.log.Error("error", err, "msg", "couldn't find owner of inbound message", "dst", m.Dst)
+	}
+	m.Username = username
+	m.ID, err = r.inboundStore.Save(&m)
+	if err != nil {
+		r.log.Error("error", err, "msg", "couldn't save inbound message", "src", m.Src, "dst", m.Dst)
+		// SMSC delivers message again if it isn't acknowledged
+		return pdu.StatusSysErr
+	}
+	if r.notifier != nil {
+		r.notifier.Notify(m.Username, webhook.Payload{
+			Event:     webhook.EventInbound,
+			InboundID: m.ID,
+			Src:       m.Src,
+			Dst:       m.Dst,
+			Msg:       m.Msg,
+			Time:      m.ReceivedAt,
+		})
+	}
+	return pdu.StatusOK
+}
+
+// owner returns username of user who owns short code or long number dst, it's empty if no user owns it.
+// Store matches long numbers with and without leading +.
+func (r *Receiver) owner(dst string) (string, error) {
+	users, err := r.userStore.List(user.Criteria{Number: strings.TrimSpace(dst), PerPage: 1})
+	if err != nil || len(users) == 0 {
+		return "", err
+	}
+	return users[0].Username, nil
+}
+
+// decode returns text of short_message or message_payload of p and its encoding.
+// User data header of a message part is skipped, parts aren't joined.
+func decode(p *pdu.PDU) (string, string) {
+	b := p.Fields.Bytes(pdu.ShortMessage)
+	if payload, ok := p.TLVs[pdu.MessagePayload]; ok {
+		b = payload
+	}
+	if p.Fields.Uint8(pdu.ESMClass)&esmClassUDHI != 0 && len(b) > 0 && int(b[0]) < len(b) {
+		b = b[b[0]+1:]
+	}
+	switch pdutext.DataCoding(p.Fields.Uint8(pdu.DataCoding)) {
+	case gsm7.DefaultType:
+		return gsm7.Decode(b), message.EncGSM
+	case ia5Type:
+		return string(b), message.EncLatin
+	case pdutext.Latin1Type:
+		return string(pdutext.Latin1(b).Decode()), message.EncLatin
+	case pdutext.UCS2Type:
+		return string(pdutext.UCS2(b).Decode()), message.EncUCS
+	}
+	return hex.EncodeToString(b), inbound.EncBinary
+}
@@ -0,0 +1,50 @@
+package receiver
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/pkg/errors"
+)
+
+// receiptKeys matches keys of a delivery receipt as given in appendix B of SMPP v3.4 specification
+var receiptKeys = regexp.MustCompile(`(?i)\b(id|sub|dlvrd|submit date|done date|stat|err|text):`)
+
+// ParseReceipt parses delivery receipt text such as
+// "id:123 sub:001 dlvrd:001 submit date:1801011200 done date:1801011201 stat:DELIVRD err:000 text:hello"
+// and returns a map of its keys and values. Keys are lower cased, text is everything after "text:".
+func ParseReceipt(text string) (map[string]string, error) {
+	fields := make(map[string]string)
+	locs := receiptKeys.FindAllStringSubmatchIndex(text, -1)
+	for i, loc := range locs {
+		key := strings.ToLower(text[loc[2]:loc[3]])
+		end := len(text)
+		if i+1 < len(locs) && key != "text" {
+			end = locs[i+1][0]
+		}
+		fields[key] = strings.TrimSpace(text[loc[1]:end])
+		if key == "text" {
+			break
+		}
+	}
+	if fields["id"] == "" {
+		return fields, errors.Errorf("receipt doesn't have id: %q", text)
+	}
+	if fields["stat"] == "" {
+		return fields, errors.Errorf("receipt doesn't have stat: %q", text)
+	}
+	return fields, nil
+}
+
+// StatusFromStat maps stat value of a delivery receipt to message status.
+// Second return value is false for intermediate states such as ENROUTE and ACCEPTD, which don't change message status.
+func StatusFromStat(stat string) (message.Status, bool) {
+	switch strings.ToUpper(stat) {
+	case "DELIVRD":
+		return message.Delivered, true
+	case "UNDELIV", "EXPIRED", "REJECTD", "DELETED", "UNKNOWN":
+		return message.NotDelivered, true
+	}
+	return "", false
+}
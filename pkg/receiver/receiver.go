@@ -0,0 +1,195 @@
+// Package receiver handles deliver_sm PDUs received from SMSCs.
+// Delivery receipts update status of messages in message store. Receipts for messages whose submit response
+// hasn't been saved yet are held in memory and retried until they match a message or expire.
+// Other deliver_sm are mobile originated messages, they're saved in inbox of user who owns their destination.
+package receiver
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/inbound"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/smpp"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+)
+
+const (
+	// DefaultRetryInterval is interval between attempts to save held receipts
+	DefaultRetryInterval = 5 * time.Second
+	// DefaultMaxHold is how long a receipt is held before it's dropped
+	DefaultMaxHold = 10 * time.Minute
+	// esmClassReceipt is bit of esm_class which is set for a deliver_sm carrying delivery receipt
+	esmClassReceipt = 0x04
+)
+
+type receipt struct {
+	// conn is id of connection receipt was received on, empty if it isn't known
+	conn        string
+	respID      string
+	status      message.Status
+	deliveredAt int64
+	fields      map[string]string
+	heldAt      time.Time
+}
+
+// Receiver handles deliver_sm PDUs
+type Receiver struct {
+	msgStore      message.Store
+	inboundStore  inbound.Store
+	userStore     user.Store
+	notifier      webhook.Notifier
+	log           logger.Logger
+	RetryInterval time.Duration
+	MaxHold       time.Duration
+
+	mu   sync.Mutex
+	held []receipt
+}
+
+// New returns a new receiver which saves delivery receipts in msgStore and mobile originated messages in inboundStore.
+// Owners of short codes and long numbers are looked up in userStore. notifier may be nil if webhooks aren't called.
+func New(msgStore message.Store, inboundStore inbound.Store, userStore user.Store, notifier webhook.Notifier, log logger.Logger) *Receiver {
+	return &Receiver{
+		msgStore:      msgStore,
+		inboundStore:  inboundStore,
+		userStore:     userStore,
+		notifier:      notifier,
+		log:           log,
+		RetryInterval: DefaultRetryInterval,
+		MaxHold:       DefaultMaxHold,
+	}
+}
+
+// Handler returns an smpp.HandlerFunc for deliver_sm PDUs received on connection with id conn
+func (r *Receiver) Handler(conn string) smpp.HandlerFunc {
+	return func(p *pdu.PDU) pdu.Status {
+		return r.handle(conn, p)
+	}
+}
+
+// Handle is an smpp.HandlerFunc for deliver_sm PDUs whose connection isn't known
+func (r *Receiver) Handle(p *pdu.PDU) pdu.Status {
+	return r.handle("", p)
+}
+
+func (r *Receiver) handle(conn string, p *pdu.PDU) pdu.Status {
+	if p.Fields.Uint8(pdu.ESMClass)&esmClassReceipt == 0 {
+		return r.saveInbound(conn, p)
+	}
+	text := string(p.Fields.Bytes(pdu.ShortMessage))
+	if payload, ok := p.TLVs[pdu.MessagePayload]; ok {
+		text = string(payload)
+	}
+	fields, err := ParseReceipt(text)
+	if err != nil {
+		r.log.Error("error", err, "msg", "couldn't parse delivery receipt")
+		return pdu.StatusOK
+	}
+	// receipted_message_id is more reliable than id in text, if SMSC sends it
+	if id, ok := p.TLVs[pdu.ReceiptedMessageID]; ok && len(id) > 1 {
+		fields["id"] = string(id[:len(id)-1])
+	}
+	status, final := StatusFromStat(fields["stat"])
+	if !final {
+		return pdu.StatusOK
+	}
+	rc := receipt{
+		conn:        conn,
+		respID:      fields["id"],
+		status:      status,
+		deliveredAt: time.Now().UTC().Unix(),
+		fields:      fields,
+	}
+	if !r.save(rc) {
+		rc.heldAt = time.Now()
+		r.mu.Lock()
+		r.held = append(r.held, rc)
+		r.mu.Unlock()
+	}
+	return pdu.StatusOK
+}
+
+// Run retries held receipts every RetryInterval until ctx is done
+func (r *Receiver) Run(ctx context.Context) {
+	t := time.NewTicker(r.RetryInterval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			r.retry()
+		}
+	}
+}
+
+// Held returns number of receipts currently held for retry
+func (r *Receiver) Held() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.held)
+}
+
+func (r *Receiver) retry() {
+	r.mu.Lock()
+	held := r.held
+	r.held = nil
+	r.mu.Unlock()
+	var keep []receipt
+	for _, rc := range held {
+		if r.save(rc) {
+			continue
+		}
+		if time.Since(rc.heldAt) > r.MaxHold {
+			r.log.Error("msg", "dropping delivery receipt, no message found", "respID", rc.respID, "connection", rc.conn, "heldFor", time.Since(rc.heldAt))
+			continue
+		}
+		keep = append(keep, rc)
+	}
+	r.mu.Lock()
+	r.held = append(r.held, keep...)
+	r.mu.Unlock()
+}
+
+// save saves receipt in store and returns false if receipt should be held for retry
+func (r *Receiver) save(rc receipt) bool {
+	err := r.msgStore.SaveDelivery(rc.conn, rc.respID, rc.status, rc.deliveredAt, rc.fields)
+	if err == message.ErrNotFound {
+		return false
+	}
+	if err != nil {
+		r.log.Error("error", err, "msg", "couldn't save delivery receipt", "respID", rc.respID)
+		return false
+	}
+	r.notify(rc)
+	return true
+}
+
+// notify calls webhooks of user of message whose receipt is rc if it was delivered or couldn't be delivered
+func (r *Receiver) notify(rc receipt) {
+	if r.notifier == nil {
+		return
+	}
+	var e webhook.Event
+	switch rc.status {
+	case message.Delivered:
+		e = webhook.EventDelivered
+	case message.NotDelivered:
+		e = webhook.EventNotDelivered
+	default:
+		return
+	}
+	ms, err := r.msgStore.List(&message.Criteria{RespID: rc.respID, Connection: rc.conn, PerPage: 1})
+	if err != nil || len(ms) == 0 {
+		r.log.Error("error", err, "msg", "couldn't get message of delivery receipt", "respID", rc.respID)
+		return
+	}
+	p := webhook.MessagePayload(e, &ms[0])
+	p.Time = rc.deliveredAt
+	r.notifier.Notify(ms[0].Username, p)
+}
@@ -0,0 +1,178 @@
+package receiver
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/haisum/smpp-app/pkg/entities/inbound"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// deliveryStore keeps statuses of messages by respID, conns has connection of a message if it's known
+type deliveryStore struct {
+	message.Store
+	mu      sync.Mutex
+	respIDs map[string]message.Status
+	conns   map[string]string
+}
+
+func (s *deliveryStore) SaveDelivery(conn, respID string, status message.Status, deliveredAt int64, fields map[string]string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.respIDs[respID]; !ok {
+		return message.ErrNotFound
+	}
+	if conn != "" && s.conns[respID] != conn {
+		return message.ErrNotFound
+	}
+	s.respIDs[respID] = status
+	return nil
+}
+
+func TestParseReceipt(t *testing.T) {
+	assert := assert.New(t)
+	fields, err := ParseReceipt("id:0123456789 sub:001 dlvrd:001 submit date:1801011200 done date:1801011201 stat:DELIVRD err:000 text:hello stat:x")
+	assert.Nil(err)
+	assert.Equal("0123456789", fields["id"])
+	assert.Equal("1801011200", fields["submit date"])
+	assert.Equal("1801011201", fields["done date"])
+	assert.Equal("DELIVRD", fields["stat"])
+	assert.Equal("000", fields["err"])
+	assert.Equal("hello stat:x", fields["text"])
+
+	_, err = ParseReceipt("hello world")
+	assert.NotNil(err)
+	_, err = ParseReceipt("id:1 err:000")
+	assert.NotNil(err)
+}
+
+func TestStatusFromStat(t *testing.T) {
+	assert := assert.New(t)
+	st, final := StatusFromStat("DELIVRD")
+	assert.True(final)
+	assert.Equal(message.Delivered, st)
+	st, final = StatusFromStat("expired")
+	assert.True(final)
+	assert.Equal(message.NotDelivered, st)
+	_, final = StatusFromStat("ENROUTE")
+	assert.False(final)
+}
+
+func receiptPDU(text string) *pdu.PDU {
+	p := pdu.New(pdu.DeliverSMID)
+	p.Fields[pdu.ESMClass] = uint8(esmClassReceipt)
+	p.Fields[pdu.ShortMessage] = []byte(text)
+	return p
+}
+
+func TestReceiver_Handle(t *testing.T) {
+	assert := assert.New(t)
+	store := &deliveryStore{respIDs: map[string]message.Status{"a1": message.Sent}}
+	r := New(store, nil, nil, nil, logger.Get())
+	assert.Equal(pdu.StatusOK, r.Handle(receiptPDU("id:a1 stat:UNDELIV err:001 text:")))
+	assert.Equal(message.NotDelivered, store.respIDs["a1"])
+	assert.Equal(0, r.Held())
+}
+
+func TestReceiver_HandlerConnection(t *testing.T) {
+	assert := assert.New(t)
+	store := &deliveryStore{respIDs: map[string]message.Status{"a1": message.Sent}, conns: map[string]string{"a1": "conn1"}}
+	r := New(store, nil, nil, nil, logger.Get())
+	// receipt of another connection with same id doesn't update message
+	r.Handler("conn2")(receiptPDU("id:a1 stat:DELIVRD err:000 text:"))
+	assert.Equal(message.Sent, store.respIDs["a1"])
+	assert.Equal(1, r.Held())
+	r.Handler("conn1")(receiptPDU("id:a1 stat:DELIVRD err:000 text:"))
+	assert.Equal(message.Delivered, store.respIDs["a1"])
+}
+
+func TestReceiver_HoldAndRetry(t *testing.T) {
+	assert := assert.New(t)
+	store := &deliveryStore{respIDs: map[string]message.Status{}}
+	r := New(store, nil, nil, nil, logger.Get())
+	p := receiptPDU("id:wrong stat:DELIVRD err:000 text:")
+	p.TLVs[pdu.ReceiptedMessageID] = []byte("b2\x00")
+	r.Handle(p)
+	assert.Equal(1, r.Held())
+	// submit response gets saved after receipt arrived
+	store.respIDs["b2"] = message.Sent
+	r.retry()
+	assert.Equal(0, r.Held())
+	assert.Equal(message.Delivered, store.respIDs["b2"])
+}
+
+func TestReceiver_Drop(t *testing.T) {
+	store := &deliveryStore{respIDs: map[string]message.Status{}}
+	r := New(store, nil, nil, nil, logger.Get())
+	r.MaxHold = 0
+	r.Handle(receiptPDU("id:c3 stat:DELIVRD err:000 text:"))
+	assert.Equal(t, 1, r.Held())
+	r.retry()
+	assert.Equal(t, 0, r.Held())
+}
+
+type inboundStore struct {
+	inbound.Store
+	msgs []inbound.Message
+}
+
+func (s *inboundStore) Save(m *inbound.Message) (int64, error) {
+	s.msgs = append(s.msgs, *m)
+	return int64(len(s.msgs)), nil
+}
+
+type numberStore struct {
+	user.Store
+	owners map[string]string
+}
+
+// List finds owner of number, owners are keyed by numbers without leading + as in user store
+func (s *numberStore) List(c user.Criteria) ([]user.User, error) {
+	if u, ok := s.owners[strings.TrimPrefix(c.Number, "+")]; ok {
+		return []user.User{{Username: u}}, nil
+	}
+	return nil, nil
+}
+
+func TestReceiver_Inbound(t *testing.T) {
+	assert := assert.New(t)
+	store := &inboundStore{}
+	r := New(nil, store, &numberStore{owners: map[string]string{"971500000001": "alice", "7777": "bob"}}, nil, logger.Get())
+	p := pdu.New(pdu.DeliverSMID)
+	p.Fields[pdu.SourceAddr] = "971500000009"
+	p.Fields[pdu.DestinationAddr] = "971500000001"
+	p.Fields[pdu.DataCoding] = uint8(0x08)
+	p.Fields[pdu.ShortMessage] = []byte{0x06, 0x27}
+	assert.Equal(pdu.StatusOK, r.Handler("conn1")(p))
+
+	// user data header is skipped
+	p = pdu.New(pdu.DeliverSMID)
+	p.Fields[pdu.DestinationAddr] = "7777"
+	p.Fields[pdu.ESMClass] = uint8(esmClassUDHI)
+	p.Fields[pdu.ShortMessage] = []byte{0x05, 0x00, 0x03, 0x01, 0x02, 0x01, 'S', 'T', 'O', 'P'}
+	assert.Equal(pdu.StatusOK, r.Handle(p))
+
+	p = pdu.New(pdu.DeliverSMID)
+	p.Fields[pdu.DestinationAddr] = "8888"
+	p.Fields[pdu.DataCoding] = uint8(0x04)
+	p.Fields[pdu.ShortMessage] = []byte{0xca, 0xfe}
+	r.Handle(p)
+
+	if assert.Len(store.msgs, 3) {
+		assert.Equal("alice", store.msgs[0].Username)
+		assert.Equal("\u0627", store.msgs[0].Msg)
+		assert.Equal(message.EncUCS, store.msgs[0].Enc)
+		assert.Equal("conn1", store.msgs[0].Connection)
+		assert.Equal("bob", store.msgs[1].Username)
+		assert.Equal("STOP", store.msgs[1].Msg)
+		assert.Equal(message.EncGSM, store.msgs[1].Enc)
+		assert.Equal("", store.msgs[2].Username)
+		assert.Equal("cafe", store.msgs[2].Msg)
+		assert.Equal(inbound.EncBinary, store.msgs[2].Enc)
+	}
+}
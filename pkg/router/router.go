@@ -0,0 +1,80 @@
+// Package router decides which connection of a connection group a message is sent through.
+// Connection is picked by longest prefix of destination number among prefixes of connections in group.
+// If no prefix matches, connections having group's DefaultPfx are used.
+package router
+
+import (
+	"strings"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/pkg/errors"
+)
+
+// ErrNoRoute is returned when neither a prefix nor default prefix of group matches any connection
+var ErrNoRoute = errors.New("no route to destination")
+
+// Route is result of routing a destination in a group
+type Route struct {
+	// Pfx is prefix which matched destination, or default prefix of group
+	Pfx string
+	// Default is true if no prefix matched and default prefix was used
+	Default bool
+	// Conns are ids of all connections which have Pfx, messages should be spread between them
+	Conns []string
+}
+
+// Find finds route for dst in group g
+func Find(g config.ConnGroup, dst string) (Route, error) {
+	r := Route{}
+	num := trim(dst)
+	for _, c := range g.Conns {
+		for _, pfx := range c.Pfxs {
+			p := trim(pfx)
+			if p == "" || !strings.HasPrefix(num, p) || len(p) < len(trim(r.Pfx)) {
+				continue
+			}
+			if len(p) > len(trim(r.Pfx)) {
+				r.Pfx = pfx
+				r.Conns = nil
+			}
+			r.Conns = appendUnique(r.Conns, c.ID)
+		}
+	}
+	if len(r.Conns) > 0 {
+		return r, nil
+	}
+	r.Pfx = g.DefaultPfx
+	r.Default = true
+	for _, c := range g.Conns {
+		for _, pfx := range c.Pfxs {
+			if g.DefaultPfx != "" && trim(pfx) == trim(g.DefaultPfx) {
+				r.Conns = appendUnique(r.Conns, c.ID)
+			}
+		}
+	}
+	if len(r.Conns) == 0 {
+		return r, ErrNoRoute
+	}
+	return r, nil
+}
+
+// trim removes international prefix from a number or number prefix so that +97105, 0097105 and 97105 are same
+func trim(num string) string {
+	num = strings.TrimSpace(num)
+	if strings.HasPrefix(num, "+") {
+		return num[1:]
+	}
+	if strings.HasPrefix(num, "00") {
+		return num[2:]
+	}
+	return num
+}
+
+func appendUnique(ids []string, id string) []string {
+	for _, v := range ids {
+		if v == id {
+			return ids
+		}
+	}
+	return append(ids, id)
+}
@@ -0,0 +1,33 @@
+package router
+
+import (
+	"testing"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestFind(t *testing.T) {
+	assert := assert.New(t)
+	g := config.ConnGroup{
+		Name:       "Default",
+		DefaultPfx: "+971",
+		Conns: []config.Conn{
+			{ID: "c1", Pfxs: []string{"+971", "+97150"}},
+			{ID: "c2", Pfxs: []string{"+97150", "+97155"}},
+			{ID: "c3", Pfxs: []string{"+971"}},
+		},
+	}
+	r, err := Find(g, "+971501234567")
+	assert.Nil(err)
+	assert.Equal(Route{Pfx: "+97150", Conns: []string{"c1", "c2"}}, r)
+	r, err = Find(g, "00971551234567")
+	assert.Nil(err)
+	assert.Equal(Route{Pfx: "+97155", Conns: []string{"c2"}}, r)
+	r, err = Find(g, "923001234567")
+	assert.Nil(err)
+	assert.Equal(Route{Pfx: "+971", Default: true, Conns: []string{"c1", "c3"}}, r)
+	g.DefaultPfx = "+92"
+	_, err = Find(g, "923001234567")
+	assert.Equal(ErrNoRoute, err)
+}
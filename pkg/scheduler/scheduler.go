@@ -0,0 +1,62 @@
+// Package scheduler queues scheduled messages when their time comes.
+// Promotion is done by message store in a single statement per batch, so any number of schedulers can run at once,
+// for example one with every dispatcher. After downtime scheduler promotes all overdue messages in consecutive
+// batches, oldest first, before it starts waiting between polls again.
+package scheduler
+
+import (
+	"context"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/logger"
+)
+
+const (
+	// DefaultInterval is time to wait between polls when there are no due messages
+	DefaultInterval = 5 * time.Second
+	// DefaultBatchSize is maximum number of messages promoted at once
+	DefaultBatchSize = 1000
+)
+
+// Scheduler moves Scheduled messages to Queued when their ScheduledAt has passed
+type Scheduler struct {
+	msgStore  message.Store
+	log       logger.Logger
+	Interval  time.Duration
+	BatchSize uint
+}
+
+// New returns a new scheduler for messages in msgStore
+func New(msgStore message.Store, log logger.Logger) *Scheduler {
+	return &Scheduler{
+		msgStore:  msgStore,
+		log:       log,
+		Interval:  DefaultInterval,
+		BatchSize: DefaultBatchSize,
+	}
+}
+
+// Run promotes due messages until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	for {
+		n, err := s.msgStore.PromoteScheduled(time.Now().UTC().Unix(), s.BatchSize)
+		if err != nil {
+			s.log.Error("error", err, "msg", "couldn't promote scheduled messages")
+		} else if n > 0 {
+			s.log.Info("msg", "queued scheduled messages", "count", n)
+		}
+		// a full batch means there may be more due messages, keep going without waiting
+		if err == nil && n >= int64(s.BatchSize) {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.Interval):
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+// memStore is an in memory message.Store which only implements PromoteScheduled
+type memStore struct {
+	message.Store
+	mu       sync.Mutex
+	msgs     []message.Message
+	promoted []int64
+}
+
+func (s *memStore) PromoteScheduled(now int64, limit uint) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sort.Slice(s.msgs, func(i, j int) bool { return s.msgs[i].ScheduledAt < s.msgs[j].ScheduledAt })
+	var n int64
+	for i := range s.msgs {
+		if n == int64(limit) {
+			break
+		}
+		if s.msgs[i].Status == message.Scheduled && s.msgs[i].ScheduledAt <= now {
+			s.msgs[i].Status = message.Queued
+			s.promoted = append(s.promoted, s.msgs[i].ID)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *memStore) status(id int64) message.Status {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, m := range s.msgs {
+		if m.ID == id {
+			return m.Status
+		}
+	}
+	return ""
+}
+
+func TestScheduler_Run(t *testing.T) {
+	assert := assert.New(t)
+	now := time.Now().UTC().Unix()
+	store := &memStore{}
+	// overdue messages from a downtime, more than a batch
+	for i := int64(1); i <= 25; i++ {
+		store.msgs = append(store.msgs, message.Message{ID: i, Status: message.Scheduled, ScheduledAt: now - 3600 + i})
+	}
+	store.msgs = append(store.msgs, message.Message{ID: 100, Status: message.Scheduled, ScheduledAt: now + 1})
+	store.msgs = append(store.msgs, message.Message{ID: 101, Status: message.Scheduled, ScheduledAt: now + 3600})
+	s := New(store, logger.Get())
+	s.BatchSize = 10
+	s.Interval = time.Millisecond * 50
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	go s.Run(ctx)
+	for store.status(100) != message.Queued && ctx.Err() == nil {
+		time.Sleep(time.Millisecond * 10)
+	}
+	assert.Equal(message.Queued, store.status(100))
+	assert.Equal(message.Scheduled, store.status(101))
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	assert.Len(store.promoted, 26)
+	// oldest first
+	for i := int64(1); i <= 25; i++ {
+		assert.Equal(i, store.promoted[i-1])
+	}
+}
@@ -0,0 +1,100 @@
+// Package segment splits message text into parts that fit in a single short message.
+// Limits are 160 septets (153 in a multipart message) for GSM 7-bit, 140 octets (134) for 8 bit codings such as
+// Latin-1 and 70 UTF-16 units (67) for UCS-2. Multipart messages carry a 6 octet concatenation user data header.
+package segment
+
+import "github.com/haisum/smpp-app/pkg/gsm7"
+
+// Coding is alphabet a message is encoded in
+type Coding int
+
+const (
+	// GSM7 is GSM 03.38 default alphabet, characters from extension table take two septets
+	GSM7 Coding = iota
+	// Latin1 is an 8 bit alphabet, one octet per character
+	Latin1
+	// UCS2 is UCS-2 (UTF-16), characters outside basic multilingual plane take two units
+	UCS2
+)
+
+const (
+	// udhLen is length of concatenation user data header in octets
+	udhLen = 6
+	// MaxParts is most parts a multipart message can have, concatenation user data header numbers them in an octet
+	MaxParts = 255
+)
+
+// limits returns units allowed in a single message and in each part of a multipart message
+func (c Coding) limits() (single, part int) {
+	switch c {
+	case GSM7:
+		return 160, 153
+	case UCS2:
+		return 70, 67
+	default:
+		return 140, 134
+	}
+}
+
+// width returns number of units character r takes in coding c
+func (c Coding) width(r rune) int {
+	switch c {
+	case GSM7:
+		if gsm7.IsExtension(r) {
+			return 2
+		}
+		return 1
+	case UCS2:
+		// characters outside basic multilingual plane are encoded as surrogate pairs
+		if r > 0xFFFF {
+			return 2
+		}
+		return 1
+	default:
+		return 1
+	}
+}
+
+// Length returns length of msg in units of coding: septets for GSM7, octets for Latin1 and UTF-16 units for UCS2
+func Length(msg string, c Coding) int {
+	n := 0
+	for _, r := range msg {
+		n += c.width(r)
+	}
+	return n
+}
+
+// Split splits msg into parts which fit in a short message each. A message which fits in a single short message is
+// returned as is, otherwise each part leaves room for UDH. Characters taking two units are never split between parts.
+func Split(msg string, c Coding) []string {
+	single, part := c.limits()
+	if Length(msg, c) <= single {
+		return []string{msg}
+	}
+	var (
+		parts []string
+		start int
+		n     int
+	)
+	for i, r := range msg {
+		w := c.width(r)
+		if n+w > part {
+			parts = append(parts, msg[start:i])
+			start, n = i, 0
+		}
+		n += w
+	}
+	return append(parts, msg[start:])
+}
+
+// Count returns number of short messages needed to send msg in coding c
+func Count(msg string, c Coding) int {
+	return len(Split(msg, c))
+}
+
+// UDH returns concatenated short message user data header for part seq (starting from 1) of total parts.
+// ref must be same for all parts of a message and should differ between messages sent to same destination.
+// total can't be more than MaxParts, messages needing more parts must be rejected before they're sent.
+func UDH(ref uint8, total, seq int) []byte {
+	return []byte{udhLen - 1, 0x00, 0x03, ref, uint8(total), uint8(seq)}
+}
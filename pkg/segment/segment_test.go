@@ -0,0 +1,56 @@
+package segment
+
+import (
+	"strings"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestCount(t *testing.T) {
+	assert := assert.New(t)
+	cases := []struct {
+		msg    string
+		coding Coding
+		want   int
+	}{
+		{"", GSM7, 1},
+		{strings.Repeat("a", 160), GSM7, 1},
+		{strings.Repeat("a", 161), GSM7, 2},
+		{strings.Repeat("a", 306), GSM7, 2},
+		{strings.Repeat("a", 307), GSM7, 3},
+		{strings.Repeat("€", 80), GSM7, 1},
+		{strings.Repeat("€", 81), GSM7, 2},
+		{strings.Repeat("€", 153), GSM7, 3},
+		{strings.Repeat("a", 140), Latin1, 1},
+		{strings.Repeat("a", 141), Latin1, 2},
+		{strings.Repeat("a", 268), Latin1, 2},
+		{strings.Repeat("a", 269), Latin1, 3},
+		{strings.Repeat("س", 70), UCS2, 1},
+		{strings.Repeat("س", 71), UCS2, 2},
+		{strings.Repeat("س", 134), UCS2, 2},
+		{strings.Repeat("😀", 35), UCS2, 1},
+		{strings.Repeat("😀", 36), UCS2, 2},
+	}
+	for _, c := range cases {
+		assert.Equal(c.want, Count(c.msg, c.coding), "%d runes in coding %d", len([]rune(c.msg)), c.coding)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	assert := assert.New(t)
+	// escape character pair isn't split, first part is one septet short
+	msg := strings.Repeat("a", 152) + "€" + strings.Repeat("b", 10)
+	parts := Split(msg, GSM7)
+	assert.Equal([]string{strings.Repeat("a", 152), "€" + strings.Repeat("b", 10)}, parts)
+	assert.Equal(msg, strings.Join(parts, ""))
+
+	// surrogate pair isn't split, each part is 66 units
+	parts = Split(strings.Repeat("😀", 67), UCS2)
+	assert.Len(parts, 3)
+	assert.Equal(33, len([]rune(parts[0])))
+	for _, p := range parts {
+		assert.True(Length(p, UCS2) <= 67)
+	}
+	assert.Equal([]byte{0x05, 0x00, 0x03, 0x2a, 0x03, 0x01}, UDH(42, 3, 1))
+}
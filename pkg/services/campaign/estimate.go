@@ -0,0 +1,62 @@
+package campaign
+
+import (
+	"math"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/router"
+)
+
+// estimator estimates time needed to send messages through connections of a group. Messages are routed same as
+// dispatcher does, by prefix of destination and round robin between connections of a route. Every connection
+// sends Size segments per Time seconds.
+type estimator struct {
+	group      config.ConnGroup
+	next       map[string]int
+	segments   map[string]int
+	unroutable int
+}
+
+func newEstimator(g config.ConnGroup) *estimator {
+	return &estimator{
+		group:    g,
+		next:     make(map[string]int),
+		segments: make(map[string]int),
+	}
+}
+
+// add routes m and adds its segments to connection it would be sent through
+func (e *estimator) add(m message.Message) {
+	r, err := router.Find(e.group, m.Dst)
+	if err != nil {
+		e.unroutable++
+		return
+	}
+	id := r.Conns[e.next[r.Pfx]%len(r.Conns)]
+	e.next[r.Pfx]++
+	e.segments[id] += m.Total
+}
+
+// duration returns estimated seconds to send added messages. Connections send in parallel so it's time taken by
+// busiest connection.
+func (e *estimator) duration() int64 {
+	var max float64
+	for _, c := range e.group.Conns {
+		n := e.segments[c.ID]
+		if n == 0 {
+			continue
+		}
+		size, period := c.Size, c.Time
+		if size < 1 {
+			size = 1
+		}
+		if period < 1 {
+			period = 1
+		}
+		if d := float64(n) * float64(period) / float64(size); d > max {
+			max = d
+		}
+	}
+	return int64(math.Ceil(max))
+}
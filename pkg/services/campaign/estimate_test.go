@@ -0,0 +1,37 @@
+package campaign
+
+import (
+	"testing"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestEstimator(t *testing.T) {
+	assert := assert.New(t)
+	g := config.ConnGroup{
+		Name:       "Default",
+		DefaultPfx: "+97150",
+		Conns: []config.Conn{
+			{ID: "a", Pfxs: []string{"+97150"}, Size: 10, Time: 1},
+			{ID: "b", Pfxs: []string{"+97150"}, Size: 5, Time: 1},
+			{ID: "c", Pfxs: []string{"+97155"}, Size: 1, Time: 2},
+		},
+	}
+	e := newEstimator(g)
+	for i := 0; i < 20; i++ {
+		e.add(message.Message{Dst: "+971501234567", Total: 2})
+	}
+	// 20 segments on each of a and b, b is slower and takes 4 seconds
+	assert.Equal(int64(4), e.duration())
+	e.add(message.Message{Dst: "971551234567", Total: 3})
+	// 3 segments on c at 1 per 2 seconds
+	assert.Equal(int64(6), e.duration())
+	assert.Equal(0, e.unroutable)
+
+	e = newEstimator(config.ConnGroup{})
+	e.add(message.Message{Dst: "123", Total: 1})
+	assert.Equal(1, e.unroutable)
+	assert.Equal(int64(0), e.duration())
+}
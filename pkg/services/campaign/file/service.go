@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
+	"github.com/haisum/smpp-app/pkg/entities/config"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
@@ -27,6 +28,7 @@ type Service interface {
 type service struct {
 	logger           logger.Logger
 	fileStore        file.Store
+	configStore      config.Store
 	fileManager      file.OpenReadWriteCloser
 	processExcelFunc file.ProcessExcelFunc
 	randFunc         func() string
@@ -34,10 +36,10 @@ type service struct {
 }
 
 // NewService returns a new user service
-func NewService(logger logger.Logger, fileStore file.Store, fileManager file.OpenReadWriteCloser, processExcelFunc file.ProcessExcelFunc, randFunc func() string, auth user.Authenticator) Service {
+func NewService(logger logger.Logger, fileStore file.Store, configStore config.Store, fileManager file.OpenReadWriteCloser, processExcelFunc file.ProcessExcelFunc, randFunc func() string, auth user.Authenticator) Service {
 	return &service{
 		logger,
-		fileStore, fileManager,
+		fileStore, configStore, fileManager,
 		processExcelFunc, randFunc,
 		auth,
 	}
@@ -116,9 +118,15 @@ func (svc *service) Upload(ctx context.Context, request uploadRequest) (uploadRe
 		SubmittedAt: time.Now().UTC().Unix(),
 		Name:        request.FileName,
 	}
+	conf, err := svc.configStore.Get()
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't get config")
+	}
 	f.LocalName = f.Name + svc.randFunc()
 	writer, err := svc.fileManager.Open(filepath.Join(u.Username, f.LocalName))
-	id, err := svc.fileStore.Save(&f, svc.processExcelFunc, request.ReadCloser, writer)
-	response.ID = id
-	return response, nil
+	if err != nil {
+		return response, err
+	}
+	response.ID, err = svc.fileStore.Save(&f, svc.processExcelFunc, conf.CountryCode(u.ConnectionGroup), request.ReadCloser, writer)
+	return response, err
 }
@@ -2,6 +2,7 @@ package campaign
 
 import (
 	"context"
+	"fmt"
 
 	"regexp"
 	"strings"
@@ -9,21 +10,39 @@ import (
 
 	"github.com/haisum/smpp-app/pkg/entities/campaign"
 	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
 	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/sender"
+	"github.com/haisum/smpp-app/pkg/entities/template"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/generator"
 	"github.com/haisum/smpp-app/pkg/logger"
-	"github.com/haisum/smpp-app/pkg/stringutils"
+	"github.com/haisum/smpp-app/pkg/segment"
 	"github.com/pkg/errors"
 )
 
+const (
+	// defaultPreviewCount is number of rendered messages returned by preview if count isn't given
+	defaultPreviewCount = 5
+	// maxPreviewCount is maximum number of rendered messages returned by preview
+	maxPreviewCount = 100
+	// maxJobUpdates is number of times stop tries to update a job which generator keeps updating
+	maxJobUpdates = 5
+)
+
 // Service is interface for campaign service
 type Service interface {
 	List(ctx context.Context, request listRequest) (listResponse, error)
 	Start(ctx context.Context, request startRequest) (startResponse, error)
 	Progress(ctx context.Context, request progressRequest) (progressResponse, error)
 	Stop(ctx context.Context, request stopRequest) (stopResponse, error)
+	Pause(ctx context.Context, request pauseRequest) (pauseResponse, error)
+	Resume(ctx context.Context, request resumeRequest) (resumeResponse, error)
+	Retry(ctx context.Context, request retryRequest) (retryResponse, error)
+	Preview(ctx context.Context, request previewRequest) (previewResponse, error)
 	Report(ctx context.Context, request reportRequest) (reportResponse, error)
 }
 
@@ -32,17 +51,25 @@ type service struct {
 	campaignStore    campaign.Store
 	messageStore     message.Store
 	fileStore        file.Store
+	templateStore    template.Store
+	configStore      config.Store
+	creditStore      credit.Store
+	senderStore      sender.Store
+	jobStore         campaign.JobStore
+	generator        *generator.Generator
 	processExcelFunc file.ProcessExcelFunc
 	fileManager      file.OpenReadWriteCloser
 	authenticator    user.Authenticator
+	maxRetries       int
 }
 
-// NewService returns a new user service
-func NewService(logger logger.Logger, campaignStore campaign.Store, messageStore message.Store, fileStore file.Store, fileManager file.OpenReadWriteCloser, processExcelFunc file.ProcessExcelFunc, auth user.Authenticator) Service {
+// NewService returns a new user service. maxRetries is number of times a failed message can be retried.
+func NewService(logger logger.Logger, campaignStore campaign.Store, messageStore message.Store, fileStore file.Store, templateStore template.Store, configStore config.Store, creditStore credit.Store, senderStore sender.Store, jobStore campaign.JobStore, gen *generator.Generator, fileManager file.OpenReadWriteCloser, processExcelFunc file.ProcessExcelFunc, auth user.Authenticator, maxRetries int) Service {
 	return &service{
 		logger, campaignStore, messageStore,
-		fileStore, processExcelFunc, fileManager,
-		auth,
+		fileStore, templateStore, configStore, creditStore, senderStore, jobStore, gen,
+		processExcelFunc, fileManager,
+		auth, maxRetries,
 	}
 }
 
@@ -60,67 +87,157 @@ func (svc *service) List(ctx context.Context, request listRequest) (listResponse
 	return response, err
 }
 
+// Start saves a campaign and starts generating its messages. Segments of all messages are charged once campaign
+// is saved, generator refunds segments of messages to numbers which have opted out.
 func (svc *service) Start(ctx context.Context, request startRequest) (startResponse, error) {
 	response := startResponse{}
-	u, err := user.FromContext(ctx)
+	c, params, rows, closeRows, err := svc.prepare(ctx, &request)
 	if err != nil {
 		return response, err
 	}
-	if request.Mask {
-		if !u.Can(permission.Mask) {
-			return response, errs.ForbiddenError{"user doesn't have mask permissions"}
-		}
-	}
-	var numbers []file.Row
-	if request.FileID == 0 {
-		if request.Numbers != "" {
-			numbers = file.RowsFromString(request.Numbers)
-		} else {
-			resp := errs.ErrorResponse{}
-			resp.Errors = []errs.ResponseError{
-				{
-					Type:    errs.ErrorTypeRequest,
-					Message: "No numbers provided. You should either select a file or send comma separated list of numbers",
+	// rows are read once here to count, validate and price them, generator reads them again while inserting messages
+	var segments int64
+	err = file.Each(rows, func(r file.Row) error {
+		c.Total++
+		total := generator.Render(&c, params, r).Total
+		if total > segment.MaxParts {
+			return errs.ErrorResponse{
+				Errors: []errs.ResponseError{
+					{
+						Type:    errs.ErrorTypeForm,
+						Message: fmt.Sprintf("%s Message to %s is %d parts long.", message.TooLongMessage, r.Original, total),
+						Field:   "Msg",
+					},
 				},
 			}
-			return response, errors.Wrap(resp, err.Error())
 		}
-	} else {
-		var files []file.File
-		files, err := svc.fileStore.List(&file.Criteria{
-			ID: request.FileID,
-		})
-		if err != nil || len(files) == 0 {
-			resp := errs.ErrorResponse{}
-			resp.Errors = []errs.ResponseError{
+		segments += int64(total)
+		return nil
+	})
+	closeRows()
+	if resp, ok := err.(errs.ErrorResponse); ok {
+		return response, resp
+	}
+	if err != nil {
+		return response, rowsError(&request, err)
+	}
+	c.ID, err = svc.campaignStore.Save(&c)
+	if err != nil {
+		respErr := errs.ErrorResponse{
+			Errors: []errs.ResponseError{
 				{
-					Type:    errs.ErrorTypeForm,
-					Message: "Couldn't get any file.",
-					Field:   "FileID",
+					Type:    errs.ErrorTypeDB,
+					Message: "Couldn't save campaign in db.",
 				},
-			}
-			return response, errors.Wrap(resp, err.Error())
+			},
 		}
-		reader, err := svc.fileManager.Open(files[0].Name)
-		if err != nil {
-			return response, err
+		return response, respErr
+	}
+	// campaign is charged once it's saved so debit entry has its ID, it's removed again if user can't pay for it
+	if err := credit.Charge(svc.creditStore, c.Username, segments, c.ID, "campaign "+c.Description); err != nil {
+		if delErr := svc.campaignStore.Delete(c.ID); delErr != nil {
+			svc.logger.Error("error", delErr, "msg", "couldn't delete campaign which couldn't be charged", "campaign", c.ID)
 		}
-		defer reader.Close()
-		numbers, err = file.ToNumbers(&files[0], svc.processExcelFunc, reader)
-		if err != nil {
-			resp := errs.ErrorResponse{}
-			resp.Errors = []errs.ResponseError{
+		return response, err
+	}
+	job := campaign.Job{
+		CampaignID: c.ID,
+		Status:     campaign.JobPending,
+		Total:      c.Total,
+		Segments:   segments,
+		Params:     params,
+		UpdatedAt:  time.Now().UTC().Unix(),
+	}
+	job.ID, err = svc.jobStore.Add(&job)
+	if err != nil {
+		svc.refund(c.Username, segments, c.ID, "campaign job couldn't be saved")
+		respErr := errs.ErrorResponse{
+			Errors: []errs.ResponseError{
 				{
-					Type:    errs.ErrorTypeForm,
-					Message: "Couldn't read numbers from file.",
-					Field:   "FileID",
+					Type:    errs.ErrorTypeDB,
+					Message: "Couldn't save campaign job in db.",
 				},
-			}
-			return response, errors.Wrap(resp, err.Error())
+			},
 		}
+		return response, errors.Wrap(respErr, err.Error())
 	}
+	go svc.generator.Generate(job, &c)
+	response.ID = c.ID
+	return response, nil
+}
 
-	c := campaign.Campaign{
+// Preview renders messages of a campaign without saving anything. It returns first request.Count messages, number of
+// recipients and segments, count of messages in each encoding and estimated time to send all segments through
+// connections of user's group.
+func (svc *service) Preview(ctx context.Context, request previewRequest) (previewResponse, error) {
+	response := previewResponse{
+		Encodings: make(map[string]int),
+	}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	c, params, rows, closeRows, err := svc.prepare(ctx, &request.startRequest)
+	if err != nil {
+		return response, err
+	}
+	defer closeRows()
+	if request.Count <= 0 {
+		request.Count = defaultPreviewCount
+	}
+	if request.Count > maxPreviewCount {
+		request.Count = maxPreviewCount
+	}
+	var g config.ConnGroup
+	if conf, err := svc.configStore.Get(); err == nil {
+		g, _ = conf.Group(u.ConnectionGroup)
+	} else {
+		svc.logger.Error("error", err, "msg", "couldn't get config, duration won't be estimated")
+	}
+	est := newEstimator(g)
+	err = file.Each(rows, func(r file.Row) error {
+		m := generator.Render(&c, params, r)
+		if response.Total < request.Count {
+			response.Messages = append(response.Messages, m)
+		}
+		response.Total++
+		response.Segments += m.Total
+		response.Encodings[m.Enc]++
+		est.add(m)
+		return nil
+	})
+	if err != nil {
+		return response, rowsError(&request.startRequest, err)
+	}
+	response.Duration = est.duration()
+	response.Unroutable = est.unroutable
+	return response, nil
+}
+
+// prepare validates a start request, including that its Src is approved for user, and opens its recipients. It returns campaign to be saved, parameters of its
+// job and recipients. Only first recipient is read, Total of campaign is known once rest of rows are read.
+// closeRows must be called once rows aren't needed anymore.
+func (svc *service) prepare(ctx context.Context, request *startRequest) (c campaign.Campaign, params campaign.JobParams, rows file.Rows, closeRows func(), err error) {
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return c, params, nil, nil, err
+	}
+	if request.Mask {
+		if !u.Can(permission.Mask) {
+			return c, params, nil, nil, errs.ForbiddenError{"user doesn't have mask permissions"}
+		}
+	}
+	if request.TemplateID != 0 {
+		t, err := template.Get(svc.templateStore, u, request.TemplateID, permission.ListTemplates, "TemplateID")
+		if err != nil {
+			return c, params, nil, nil, err
+		}
+		request.Msg = t.Msg
+	}
+	if request.TimeZone == "" {
+		request.TimeZone = u.TimeZone
+	}
+	c = campaign.Campaign{
 		Description: request.Description,
 		Src:         request.Src,
 		Msg:         request.Msg,
@@ -129,15 +246,31 @@ func (svc *service) Start(ctx context.Context, request startRequest) (startRespo
 		Priority:    request.Priority,
 		SendBefore:  request.SendBefore,
 		SendAfter:   request.SendAfter,
+		TimeZone:    request.TimeZone,
 		ScheduledAt: request.ScheduledAt,
 		Username:    u.Username,
+		TemplateID:  request.TemplateID,
+	}
+	if request.FileID == 0 && request.Numbers == "" {
+		resp := errs.ErrorResponse{}
+		resp.Errors = []errs.ResponseError{
+			{
+				Type:    errs.ErrorTypeRequest,
+				Message: "No numbers provided. You should either select a file or send comma separated list of numbers",
+			},
+		}
+		return c, params, nil, nil, resp
 	}
-
 	if errors := request.validate(); len(errors) != 0 {
 		respErr := errs.ErrorResponse{
 			Errors: errors,
 		}
-		return response, respErr
+		return c, params, nil, nil, respErr
+	}
+	if err := sender.Allowed(svc.senderStore, u.Username, request.Src); err == sender.ErrNotApproved {
+		return c, params, nil, nil, sender.SrcError(request.Src)
+	} else if err != nil {
+		return c, params, nil, nil, errors.Wrap(err, "couldn't get sender ids")
 	}
 	msg := request.Msg
 	if request.Mask {
@@ -149,89 +282,88 @@ func (svc *service) Start(ctx context.Context, request startRequest) (startRespo
 			c.Msg = strings.Replace(c.Msg, "[["+val+"]]", strings.Repeat("X", len(val)), -1)
 		}
 	}
-	c.Total = len(numbers)
-	c.ID, err = svc.campaignStore.Save(&c)
+	conf, err := svc.configStore.Get()
 	if err != nil {
-		respErr := errs.ErrorResponse{
-			Errors: []errs.ResponseError{
+		return c, params, nil, nil, errors.Wrap(err, "couldn't get config")
+	}
+	params = campaign.JobParams{
+		Msg:             msg,
+		Numbers:         request.Numbers,
+		ConnectionGroup: u.ConnectionGroup,
+		IsFlash:         request.IsFlash,
+		AllowMissing:    request.AllowMissing,
+		Defaults:        request.Defaults,
+		CountryCode:     conf.CountryCode(u.ConnectionGroup),
+	}
+	if request.FileID != 0 {
+		files, err := svc.fileStore.List(&file.Criteria{
+			ID: request.FileID,
+		})
+		if err != nil || len(files) == 0 {
+			resp := errs.ErrorResponse{}
+			resp.Errors = []errs.ResponseError{
 				{
-					Type:    errs.ErrorTypeDB,
-					Message: "Couldn't save campaign in db.",
+					Type:    errs.ErrorTypeForm,
+					Message: "Couldn't get any file.",
+					Field:   "FileID",
 				},
-			},
+			}
+			if err == nil {
+				return c, params, nil, nil, resp
+			}
+			return c, params, nil, nil, errors.Wrap(resp, err.Error())
 		}
-		return response, respErr
 	}
-	go svc.saveMessages(request, &c, u, numbers, msg)
-	response.ID = c.ID
-	return response, nil
+	rows, closeRows, err = svc.generator.Rows(&c, params)
+	if err != nil {
+		return c, params, nil, nil, rowsError(request, err)
+	}
+	// first row has columns of file which are checked against placeholders of message
+	first, err := rows.Next()
+	if err != nil {
+		closeRows()
+		return c, params, nil, nil, rowsError(request, err)
+	}
+	if errors := request.validatePlaceholders(first.Params); len(errors) != 0 {
+		closeRows()
+		return c, params, nil, nil, errs.ErrorResponse{
+			Errors: errors,
+		}
+	}
+	return c, params, &peekedRows{first: &first, rows: rows}, closeRows, nil
 }
 
-func (svc *service) saveMessages(request startRequest, c *campaign.Campaign, u *user.User, numbers []file.Row, msg string) {
-	enc := message.EncLatin
-	if len(numbers) > 0 {
-		encMsg := msg
-		for search, replace := range numbers[0].Params {
-			encMsg = strings.Replace(encMsg, "{{"+search+"}}", replace, -1)
-		}
-		if !stringutils.IsASCII(encMsg) {
-			enc = message.EncUCS
-		}
+// peekedRows returns a row which has already been read from rows before rest of rows
+type peekedRows struct {
+	first *file.Row
+	rows  file.Rows
+}
+
+func (p *peekedRows) Next() (file.Row, error) {
+	if p.first != nil {
+		r := *p.first
+		p.first = nil
+		return r, nil
 	}
-	total := message.Total(msg, enc)
+	return p.rows.Next()
+}
 
-	var ms []message.Message
-	c.Errors = make([]string, 0)
-	for i, nr := range numbers {
-		var (
-			queuedTime = time.Now().UTC().Unix()
-			status     = message.Queued
-		)
-		if request.ScheduledAt > 0 {
-			status = message.Scheduled
-		}
-		maskedMsg := c.Msg
-		realMsg := msg
-		for search, replace := range nr.Params {
-			realMsg = strings.Replace(realMsg, "{{"+search+"}}", replace, -1)
-			maskedMsg = strings.Replace(maskedMsg, "{{"+search+"}}", replace, -1)
-		}
-		realTotal := total
-		if msg != realMsg {
-			realTotal = message.Total(realMsg, enc)
-		}
-		m := message.Message{
-			ConnectionGroup: u.ConnectionGroup,
-			Username:        u.Username,
-			Msg:             maskedMsg,
-			RealMsg:         realMsg,
-			Enc:             enc,
-			Dst:             nr.Destination,
-			Src:             request.Src,
-			Priority:        request.Priority,
-			QueuedAt:        queuedTime,
-			Status:          status,
-			CampaignID:      c.ID,
-			SendBefore:      request.SendBefore,
-			SendAfter:       request.SendAfter,
-			ScheduledAt:     request.ScheduledAt,
-			Total:           realTotal,
-			Campaign:        request.Description,
-			IsFlash:         request.IsFlash,
-		}
-		ms = append(ms, m)
-		// if we have MaxInsertCount messages or last few messages
-		if (i+1)%svc.messageStore.MaxInsertCount() == 0 || (i+1) == len(numbers) {
-			_, err := svc.messageStore.SaveBulk(ms)
-			if err != nil {
-				c.Errors = append(c.Errors, err.Error())
-			}
-			ms = []message.Message{}
-		}
+// rowsError returns a form error for an error in reading recipients of request
+func rowsError(request *startRequest, err error) error {
+	field, msg := "Numbers", "Couldn't read numbers."
+	if request.FileID != 0 {
+		field, msg = "FileID", "Couldn't read numbers from file."
 	}
-	if len(c.Errors) > 0 {
-		svc.campaignStore.Save(c)
+	resp := errs.ErrorResponse{
+		Errors: []errs.ResponseError{
+			{
+				Type:    errs.ErrorTypeForm,
+				Message: msg,
+				Field:   field,
+			},
+		},
 	}
+	return errors.Wrap(resp, err.Error())
 }
 
 // Progress returns count of messages in different status in given campaign
@@ -250,19 +382,157 @@ func (svc *service) Progress(ctx context.Context, request progressRequest) (prog
 		return response, errors.Wrap(err, "couldn't get campaign progress")
 	}
 	response.Progress = p
+	jobs, err := svc.jobStore.List(&campaign.JobCriteria{CampaignID: cp[0].ID})
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't get campaign job")
+	}
+	if len(jobs) > 0 {
+		response.Job = &jobs[0]
+	}
 	return response, nil
 }
 
+// Stop stops pending messages of a campaign and refunds their segments. If its messages are still being generated,
+// generator stops inserting them and refunds segments of messages it hasn't inserted.
+// Campaigns of other users can be stopped with ManageCampaigns permission.
 func (svc *service) Stop(ctx context.Context, request stopRequest) (stopResponse, error) {
 	response := stopResponse{}
-	count, err := svc.messageStore.StopPending(request.CampaignID)
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	c, err := svc.campaign(request.CampaignID)
+	if err != nil {
+		return response, err
+	}
+	if err := authorize(u, c); err != nil {
+		return response, err
+	}
+	if err := svc.stopJob(c.ID); err != nil {
+		return response, errors.Wrap(err, "couldn't stop campaign job")
+	}
+	count, segments, err := svc.messageStore.StopPending(request.CampaignID)
 	if err != nil {
 		return response, errors.Wrap(err, "couldn't stop pending messages")
 	}
+	svc.refund(c.Username, segments, c.ID, "stopped messages")
+	response.Count = count
+	return response, nil
+}
+
+// Pause pauses queued and scheduled messages of a campaign, they aren't sent until campaign is resumed.
+// Campaigns of other users can be paused with ManageCampaigns permission.
+func (svc *service) Pause(ctx context.Context, request pauseRequest) (pauseResponse, error) {
+	response := pauseResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	c, err := svc.campaign(request.CampaignID)
+	if err != nil {
+		return response, err
+	}
+	if err := authorize(u, c); err != nil {
+		return response, err
+	}
+	// job is paused first so generator inserts rest of messages as paused
+	if err := svc.jobStore.Pause(c.ID, true); err != nil {
+		return response, errors.Wrap(err, "couldn't pause campaign job")
+	}
+	count, err := svc.messageStore.PausePending(request.CampaignID)
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't pause pending messages")
+	}
+	response.Count = count
+	return response, nil
+}
+
+// Resume puts paused messages of a campaign back in queue, or schedules them if their schedule time hasn't passed yet.
+// Campaigns of other users can be resumed with ManageCampaigns permission.
+func (svc *service) Resume(ctx context.Context, request resumeRequest) (resumeResponse, error) {
+	response := resumeResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	c, err := svc.campaign(request.CampaignID)
+	if err != nil {
+		return response, err
+	}
+	if err := authorize(u, c); err != nil {
+		return response, err
+	}
+	if err := svc.jobStore.Pause(c.ID, false); err != nil {
+		return response, errors.Wrap(err, "couldn't resume campaign job")
+	}
+	count, err := svc.messageStore.ResumePaused(request.CampaignID, time.Now().UTC().Unix())
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't resume paused messages")
+	}
 	response.Count = count
 	return response, nil
 }
 
+// Retry queues messages of a campaign which failed with an error again. Messages which weren't delivered are
+// retried too if request.NotDelivered is true. Messages which have already been retried maxRetries times are skipped.
+// Retried messages are charged to owner of campaign, so campaigns of other users can only be retried with
+// ManageCampaigns permission.
+func (svc *service) Retry(ctx context.Context, request retryRequest) (retryResponse, error) {
+	response := retryResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	c, err := svc.campaign(request.CampaignID)
+	if err != nil {
+		return response, err
+	}
+	if err := authorize(u, c); err != nil {
+		return response, err
+	}
+	statuses := []message.Status{message.Error}
+	if request.NotDelivered {
+		statuses = append(statuses, message.NotDelivered)
+	}
+	// retried messages are sent again, so they're charged again
+	var charged int64
+	retried, exhausted, err := svc.messageStore.Retry(message.RetryCriteria{
+		CampaignID: request.CampaignID,
+		Statuses:   statuses,
+		ErrorCodes: request.ErrorCodes,
+		MaxRetries: svc.maxRetries,
+		Charge: func(segments int64) error {
+			if err := credit.Charge(svc.creditStore, c.Username, segments, c.ID, "retry of campaign "+c.Description); err != nil {
+				return err
+			}
+			charged = segments
+			return nil
+		},
+	}, time.Now().UTC().Unix())
+	if err != nil {
+		if charged > 0 {
+			svc.refund(c.Username, charged, c.ID, "messages couldn't be retried")
+		}
+		if errResponse, ok := errors.Cause(err).(errs.ErrorResponse); ok {
+			return response, errResponse
+		}
+		return response, errors.Wrap(err, "couldn't retry messages")
+	}
+	if retried == 0 && exhausted > 0 {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeRequest,
+					Message: fmt.Sprintf("%d failed messages have already been retried %d times", exhausted, svc.maxRetries),
+				},
+			},
+		}
+	}
+	response.Count = retried
+	response.Exhausted = exhausted
+	return response, nil
+}
+
 func (svc *service) Report(ctx context.Context, request reportRequest) (reportResponse, error) {
 	response := reportResponse{}
 	c, err := svc.campaignStore.List(&campaign.Criteria{ID: request.CampaignID})
@@ -276,3 +546,66 @@ func (svc *service) Report(ctx context.Context, request reportRequest) (reportRe
 	response.Report = cr
 	return response, nil
 }
+
+// campaign returns campaign with id
+func (svc *service) campaign(id int64) (campaign.Campaign, error) {
+	cs, err := svc.campaignStore.List(&campaign.Criteria{ID: id})
+	if err != nil || len(cs) == 0 {
+		resp := errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "Couldn't get campaign.",
+					Field:   "CampaignID",
+				},
+			},
+		}
+		if err == nil {
+			err = errors.New("campaign not found")
+		}
+		return campaign.Campaign{}, errors.Wrap(resp, err.Error())
+	}
+	return cs[0], nil
+}
+
+// stopJob marks job of campaign campID as Stopping if its messages are still being generated, or Stopped if they've
+// all been inserted. Job is read again if it's updated by generator in between.
+func (svc *service) stopJob(campID int64) error {
+	for i := 0; i < maxJobUpdates; i++ {
+		jobs, err := svc.jobStore.List(&campaign.JobCriteria{CampaignID: campID})
+		if err != nil || len(jobs) == 0 {
+			return err
+		}
+		j := jobs[0]
+		switch j.Status {
+		case campaign.JobPending, campaign.JobGenerating:
+			j.Status = campaign.JobStopping
+		case campaign.JobReady:
+			j.Status = campaign.JobStopped
+		default:
+			return nil
+		}
+		j.UpdatedAt = time.Now().UTC().Unix()
+		ok, err := svc.jobStore.Update(&j)
+		if err != nil || ok {
+			return err
+		}
+	}
+	return errors.New("job was updated by another process")
+}
+
+// authorize returns an error unless c belongs to u or u has ManageCampaigns permission
+func authorize(u *user.User, c campaign.Campaign) error {
+	if c.Username != u.Username && !u.Can(permission.ManageCampaigns) {
+		return errs.ForbiddenError{"user doesn't have permission to manage campaigns of other users"}
+	}
+	return nil
+}
+
+// refund returns segments of messages of campaign campID which won't be sent to balance of username, errors are
+// only logged since request has already failed or succeeded
+func (svc *service) refund(username string, segments int64, campID int64, note string) {
+	if err := credit.RefundSegments(svc.creditStore, username, segments, campID, note); err != nil {
+		svc.logger.Error("error", err, "msg", "couldn't refund campaign", "campaign", campID, "segments", segments)
+	}
+}
@@ -3,6 +3,7 @@ package campaign
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"strconv"
 	"strings"
 	"time"
@@ -13,6 +14,8 @@ import (
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
 	"github.com/haisum/smpp-app/pkg/entities/campaign"
+	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/template"
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
 	"github.com/haisum/smpp-app/pkg/response"
@@ -31,6 +34,10 @@ func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kitht
 		authMid(makeStartEndpoint(svc)),
 		decodeStartRequest,
 		responseEncoder, opts...)
+	previewHandler := kithttp.NewServer(
+		authMid(makePreviewEndpoint(svc)),
+		decodePreviewRequest,
+		responseEncoder, opts...)
 	progressHandler := kithttp.NewServer(
 		authMid(makeProgressEndpoint(svc)),
 		decodeProgressRequest,
@@ -44,12 +51,29 @@ func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kitht
 		authMid(makeStopEndpoint(svc)),
 		decodeStopRequest,
 		responseEncoder, opts...)
+	pauseHandler := kithttp.NewServer(
+		authMid(makePauseEndpoint(svc)),
+		decodePauseRequest,
+		responseEncoder, opts...)
+	resumeHandler := kithttp.NewServer(
+		authMid(makeResumeEndpoint(svc)),
+		decodeResumeRequest,
+		responseEncoder, opts...)
+	authMid = middleware.AuthMiddleware(svc.(*service).authenticator, "", permission.RetryCampaign)
+	retryHandler := kithttp.NewServer(
+		authMid(makeRetryEndpoint(svc)),
+		decodeRetryRequest,
+		responseEncoder, opts...)
 	r := mux.NewRouter()
 
 	r.Handle("/campaign/v1/list", listHandler).Methods("GET", "POST")
 	r.Handle("/campaign/v1/start", startHandler).Methods("POST")
+	r.Handle("/campaign/v1/preview", previewHandler).Methods("POST")
 	r.Handle("/campaign/v1/progress", progressHandler).Methods("GET", "POST")
 	r.Handle("/campaign/v1/stop", stopHandler).Methods("POST")
+	r.Handle("/campaign/v1/pause", pauseHandler).Methods("POST")
+	r.Handle("/campaign/v1/resume", resumeHandler).Methods("POST")
+	r.Handle("/campaign/v1/retry", retryHandler).Methods("POST")
 	r.Handle("/campaign/v1/report", reportHandler).Methods("GET", "POST")
 	return r
 }
@@ -89,6 +113,117 @@ func decodeStopRequest(_ context.Context, r *http.Request) (interface{}, error)
 	return request, nil
 }
 
+type pauseRequest struct {
+	CampaignID int64
+	URL        string
+}
+
+type pauseResponse struct {
+	Count int64
+}
+
+func makePauseEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(pauseRequest)
+		v, err := svc.Pause(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodePauseRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request pauseRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type resumeRequest struct {
+	CampaignID int64
+	URL        string
+}
+
+type resumeResponse struct {
+	Count int64
+}
+
+func makeResumeEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(resumeRequest)
+		v, err := svc.Resume(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeResumeRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request resumeRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type retryRequest struct {
+	CampaignID int64
+	URL        string
+	// NotDelivered retries messages which SMSC couldn't deliver in addition to those which failed with an error
+	NotDelivered bool
+	// ErrorCodes limits retry to messages which failed with one of these errors such as ESME_RTHROTTLED
+	ErrorCodes []string
+}
+
+type retryResponse struct {
+	Count int64
+	// Exhausted is number of matching messages which weren't retried because they reached maximum retries
+	Exhausted int64
+}
+
+func makeRetryEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(retryRequest)
+		v, err := svc.Retry(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeRetryRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request retryRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
 type reportRequest struct {
 	CampaignID int64
 	URL        string
@@ -131,6 +266,8 @@ type progressRequest struct {
 
 type progressResponse struct {
 	campaign.Progress
+	// Job is state of generating messages of campaign, it's nil for campaigns started before jobs were introduced
+	Job *campaign.Job
 }
 
 func makeProgressEndpoint(svc Service) endpoint.Endpoint {
@@ -202,11 +339,65 @@ type startRequest struct {
 	Priority    int
 	Src         string
 	Msg         string
+	// TemplateID is id of a template whose text is used instead of Msg
+	TemplateID  int64
 	ScheduledAt int64
 	SendBefore  string
 	SendAfter   string
-	Mask        bool
-	IsFlash     bool
+	// TimeZone of SendAfter and SendBefore, user's time zone is used if it's empty
+	TimeZone string
+	Mask     bool
+	IsFlash  bool
+	// AllowMissing lets message have placeholders which aren't columns in file, they are replaced with Defaults
+	AllowMissing bool
+	Defaults     map[string]string
+}
+
+type previewRequest struct {
+	startRequest
+	// Count is number of rendered messages to return
+	Count int
+}
+
+type previewResponse struct {
+	// Messages are first Count rendered messages
+	Messages []message.Message
+	// Total is number of recipients
+	Total int
+	// Segments is number of short messages all messages are sent in
+	Segments int
+	// Encodings is number of messages in each encoding
+	Encodings map[string]int
+	// Duration is estimated number of seconds to send all segments
+	Duration int64
+	// Unroutable is number of messages whose destination doesn't match any connection of user's group
+	Unroutable int
+}
+
+func makePreviewEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(previewRequest)
+		v, err := svc.Preview(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodePreviewRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request previewRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
 }
 
 func (request *startRequest) validate() []errs.ResponseError {
@@ -278,6 +469,13 @@ func (request *startRequest) validate() []errs.ResponseError {
 			}
 		}
 	}
+	if _, err := message.LoadLocation(request.TimeZone); err != nil {
+		errors = append(errors, errs.ResponseError{
+			Type:    errs.ErrorTypeForm,
+			Field:   "TimeZone",
+			Message: "Time zone must be a valid IANA time zone such as \"Asia/Dubai\".",
+		})
+	}
 	if request.ScheduledAt != 0 && request.ScheduledAt < time.Now().UTC().Unix() {
 		errors = append(errors, errs.ResponseError{
 			Type:    errs.ErrorTypeForm,
@@ -288,6 +486,34 @@ func (request *startRequest) validate() []errs.ResponseError {
 	return errors
 }
 
+// validatePlaceholders checks that every placeholder in message has a column in file and every column is used in
+// message. columns are params of a row in file, all rows have same columns.
+func (request *startRequest) validatePlaceholders(columns map[string]string) []errs.ResponseError {
+	var errors []errs.ResponseError
+	field := "Msg"
+	if request.TemplateID != 0 {
+		field = "TemplateID"
+	}
+	for _, name := range template.Missing(request.Msg, columns) {
+		if _, ok := request.Defaults[name]; ok && request.AllowMissing {
+			continue
+		}
+		errors = append(errors, errs.ResponseError{
+			Type:    errs.ErrorTypeForm,
+			Field:   field,
+			Message: fmt.Sprintf("Placeholder {{%s}} doesn't have a matching column in file.", name),
+		})
+	}
+	for _, name := range template.Unused(request.Msg, columns) {
+		errors = append(errors, errs.ResponseError{
+			Type:    errs.ErrorTypeForm,
+			Field:   "FileID",
+			Message: fmt.Sprintf("Column %s isn't used in message.", name),
+		})
+	}
+	return errors
+}
+
 type startResponse struct {
 	ID int64
 }
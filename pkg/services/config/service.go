@@ -0,0 +1,159 @@
+package config
+
+import (
+	"context"
+
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/throttle"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/router"
+	"github.com/pkg/errors"
+)
+
+// Service is config service's interface
+type Service interface {
+	Get(ctx context.Context, request getRequest) (getResponse, error)
+	Edit(ctx context.Context, request editRequest) (editResponse, error)
+	Route(ctx context.Context, request routeRequest) (routeResponse, error)
+	Throttle(ctx context.Context, request throttleRequest) (throttleResponse, error)
+}
+
+type service struct {
+	logger        logger.Logger
+	configStore   config.Store
+	throttleStore throttle.Store
+	authenticator user.Authenticator
+}
+
+// NewService returns a new config service
+func NewService(logger logger.Logger, configStore config.Store, throttleStore throttle.Store, authenticator user.Authenticator) Service {
+	return &service{
+		logger, configStore, throttleStore, authenticator,
+	}
+}
+
+// Get returns current config
+func (s *service) Get(ctx context.Context, request getRequest) (getResponse, error) {
+	response := getResponse{}
+	c, err := s.configStore.Get()
+	if err != nil {
+		err = errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeConfig,
+					Message: "couldn't get config",
+				},
+			},
+		}, err.Error())
+		return response, err
+	}
+	response.Config = c
+	return response, nil
+}
+
+// Edit validates and replaces config. Running dispatchers pick up new config on their next reload.
+func (s *service) Edit(ctx context.Context, request editRequest) (editResponse, error) {
+	response := editResponse{}
+	c := request.Config
+	err := c.Validate()
+	if err != nil {
+		verrs := err.(*errs.ValidationError).Errors
+		errResp := errs.ErrorResponse{}
+		for k, v := range verrs {
+			errResp.Errors = append(errResp.Errors, errs.ResponseError{
+				Type:    errs.ErrorTypeForm,
+				Message: v,
+				Field:   k,
+			})
+		}
+		return response, errResp
+	}
+	err = s.configStore.Save(&c)
+	if err != nil {
+		err = errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't save config",
+				},
+			},
+		}, err.Error())
+		return response, err
+	}
+	response.Config = &c
+	return response, nil
+}
+
+// Route is a dry run of router, it returns connections which a message to request.Dst would be sent through.
+// If request.ConnectionGroup is empty, connection group of current user is used.
+func (s *service) Route(ctx context.Context, request routeRequest) (routeResponse, error) {
+	response := routeResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	group := request.ConnectionGroup
+	if group == "" {
+		group = u.ConnectionGroup
+	}
+	c, err := s.configStore.Get()
+	if err != nil {
+		err = errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeConfig,
+					Message: "couldn't get config",
+				},
+			},
+		}, err.Error())
+		return response, err
+	}
+	g, ok := c.Group(group)
+	if !ok {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "connection group doesn't exist",
+					Field:   "ConnectionGroup",
+				},
+			},
+		}
+	}
+	route, err := router.Find(g, request.Dst)
+	if err != nil {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: err.Error(),
+					Field:   "Dst",
+				},
+			},
+		}
+	}
+	response.ConnectionGroup = group
+	response.Route = route
+	return response, nil
+}
+
+// Throttle returns token levels of connections as last saved by dispatcher
+func (s *service) Throttle(ctx context.Context, request throttleRequest) (throttleResponse, error) {
+	response := throttleResponse{}
+	l, err := s.throttleStore.Get()
+	if err != nil {
+		err = errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't get token levels",
+				},
+			},
+		}, err.Error())
+		return response, err
+	}
+	response.Levels = l
+	return response, nil
+}
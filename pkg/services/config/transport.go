@@ -0,0 +1,183 @@
+package config
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/throttle"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/router"
+	"github.com/haisum/smpp-app/pkg/services/middleware"
+)
+
+// MakeHandler returns a http handler for the config service.
+func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kithttp.EncodeResponseFunc) http.Handler {
+	authenticator := svc.(*service).authenticator
+	authMid := middleware.AuthMiddleware(authenticator, "", permission.ShowConfig)
+	getHandler := kithttp.NewServer(
+		authMid(makeGetEndpoint(svc)),
+		decodeGetRequest,
+		responseEncoder, opts...)
+	authMid = middleware.AuthMiddleware(authenticator, "", permission.EditConfig)
+	editHandler := kithttp.NewServer(
+		authMid(makeEditEndpoint(svc)),
+		decodeEditRequest,
+		responseEncoder, opts...)
+	authMid = middleware.AuthMiddleware(authenticator, "", permission.ShowConfig)
+	routeHandler := kithttp.NewServer(
+		authMid(makeRouteEndpoint(svc)),
+		decodeRouteRequest,
+		responseEncoder, opts...)
+	throttleHandler := kithttp.NewServer(
+		authMid(makeThrottleEndpoint(svc)),
+		decodeThrottleRequest,
+		responseEncoder, opts...)
+	r := mux.NewRouter()
+
+	r.Handle("/config/v1/get", getHandler).Methods("GET")
+	r.Handle("/config/v1/edit", editHandler).Methods("POST")
+	r.Handle("/config/v1/route", routeHandler).Methods("POST")
+	r.Handle("/config/v1/throttle", throttleHandler).Methods("GET")
+	return r
+}
+
+type getRequest struct {
+	URL string
+}
+
+type getResponse struct {
+	Config *config.Config
+}
+
+func makeGetEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(getRequest)
+		v, err := svc.Get(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeGetRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request getRequest
+	request.URL = r.URL.RequestURI()
+	return request, nil
+}
+
+type editRequest struct {
+	URL string
+	config.Config
+}
+
+type editResponse struct {
+	Config *config.Config
+}
+
+func makeEditEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(editRequest)
+		v, err := svc.Edit(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeEditRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request editRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type routeRequest struct {
+	URL             string
+	ConnectionGroup string
+	Dst             string
+}
+
+type routeResponse struct {
+	ConnectionGroup string
+	router.Route
+}
+
+func makeRouteEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(routeRequest)
+		v, err := svc.Route(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeRouteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request routeRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type throttleRequest struct {
+	URL string
+}
+
+type throttleResponse struct {
+	Levels *throttle.Levels
+}
+
+func makeThrottleEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(throttleRequest)
+		v, err := svc.Throttle(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeThrottleRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request throttleRequest
+	request.URL = r.URL.RequestURI()
+	return request, nil
+}
@@ -0,0 +1,52 @@
+package inbox
+
+import (
+	"context"
+
+	"github.com/haisum/smpp-app/pkg/entities/inbound"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// Service is interface for inbox service
+type Service interface {
+	List(ctx context.Context, request listRequest) (listResponse, error)
+}
+
+type service struct {
+	logger        logger.Logger
+	inboundStore  inbound.Store
+	authenticator user.Authenticator
+}
+
+// NewService returns a new inbox service
+func NewService(logger logger.Logger, inboundStore inbound.Store, auth user.Authenticator) Service {
+	return &service{
+		logger, inboundStore, auth,
+	}
+}
+
+// List filters inbound messages. User needs ListInbound permission to list messages of other users, including
+// messages whose destination isn't owned by anyone. Only messages of logged in user are listed for users who don't
+// have it.
+func (svc *service) List(ctx context.Context, request listRequest) (listResponse, error) {
+	response := listResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Username == "" && !u.Can(permission.ListInbound) {
+		request.Username = u.Username
+	}
+	if request.Username != u.Username && !u.Can(permission.ListInbound) {
+		return response, errs.ForbiddenError{"user doesn't have permission to list inbound messages of other users"}
+	}
+	response.Messages, err = svc.inboundStore.List(&request.Criteria)
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't list inbound messages")
+	}
+	return response, nil
+}
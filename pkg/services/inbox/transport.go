@@ -0,0 +1,62 @@
+package inbox
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/inbound"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/services/middleware"
+)
+
+// MakeHandler returns a http handler for the inbox service.
+func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kithttp.EncodeResponseFunc) http.Handler {
+	authMid := middleware.AuthMiddleware(svc.(*service).authenticator, "", "")
+	listHandler := kithttp.NewServer(
+		authMid(makeListEndpoint(svc)),
+		decodeListRequest,
+		responseEncoder, opts...)
+	r := mux.NewRouter()
+	r.Handle("/inbox/v1/list", listHandler).Methods("GET", "POST")
+	return r
+}
+
+type listRequest struct {
+	inbound.Criteria
+	URL string
+}
+
+type listResponse struct {
+	Messages []inbound.Message
+}
+
+func makeListEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listRequest)
+		v, err := svc.List(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request listRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
@@ -2,18 +2,25 @@ package message
 
 import (
 	"context"
+	"fmt"
 	"io"
 	"regexp"
 	"strings"
 	"time"
 
+	"github.com/haisum/smpp-app/pkg/e164"
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
 	"github.com/haisum/smpp-app/pkg/entities/message"
+	"github.com/haisum/smpp-app/pkg/entities/optout"
+	"github.com/haisum/smpp-app/pkg/entities/sender"
+	"github.com/haisum/smpp-app/pkg/entities/template"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
 	"github.com/haisum/smpp-app/pkg/logger"
 	"github.com/haisum/smpp-app/pkg/response"
-	"github.com/haisum/smpp-app/pkg/stringutils"
+	"github.com/pkg/errors"
 )
 
 // Service is message service's interface
@@ -27,6 +34,11 @@ type Service interface {
 type service struct {
 	logger        logger.Logger
 	msgStore      message.Store
+	templateStore template.Store
+	configStore   config.Store
+	optOutStore   optout.Store
+	creditStore   credit.Store
+	senderStore   sender.Store
 	xlsExportFunc excelFunc
 	authenticator user.Authenticator
 }
@@ -34,9 +46,9 @@ type service struct {
 type excelFunc func(m []message.Message, TZ string, cols []string) (func(writer io.Writer) (err error), error)
 
 // NewService returns a new message service
-func NewService(logger logger.Logger, msgStore message.Store, xlsExportFunc excelFunc, auth user.Authenticator) Service {
+func NewService(logger logger.Logger, msgStore message.Store, templateStore template.Store, configStore config.Store, optOutStore optout.Store, creditStore credit.Store, senderStore sender.Store, xlsExportFunc excelFunc, auth user.Authenticator) Service {
 	return &service{
-		logger, msgStore, xlsExportFunc, auth,
+		logger, msgStore, templateStore, configStore, optOutStore, creditStore, senderStore, xlsExportFunc, auth,
 	}
 }
 
@@ -90,7 +102,7 @@ func (s *service) Stats(ctx context.Context, request statsRequest) (statsRespons
 	return response, err
 }
 
-// Send endpoint stores given message in message store
+// Send endpoint stores given message in message store. Src must match an approved sender id of user.
 func (s *service) Send(ctx context.Context, request sendRequest) (sendResponse, error) {
 	response := sendResponse{}
 
@@ -104,10 +116,52 @@ func (s *service) Send(ctx context.Context, request sendRequest) (sendResponse,
 			return response, &errs.ForbiddenError{Message: "user doesn't have masking permission"}
 		}
 	}
-	errors := request.validate()
-	if len(errors) > 0 {
+	if request.TimeZone == "" {
+		request.TimeZone = u.TimeZone
+	}
+	if request.TemplateID != 0 {
+		t, err := template.Get(s.templateStore, u, request.TemplateID, permission.ListTemplates, "TemplateID")
+		if err != nil {
+			return response, err
+		}
+		if missing := template.Missing(t.Msg, request.Params); len(missing) > 0 {
+			respErr := errs.ErrorResponse{}
+			for _, name := range missing {
+				respErr.Errors = append(respErr.Errors, errs.ResponseError{
+					Type:    errs.ErrorTypeForm,
+					Message: fmt.Sprintf("Value for template placeholder {{%s}} isn't provided.", name),
+					Field:   "Params",
+				})
+			}
+			return response, respErr
+		}
+		request.Msg = template.Render(t.Msg, request.Params)
+	}
+	validationErrors := request.validate()
+	if len(validationErrors) > 0 {
+		return response, errs.ErrorResponse{
+			Errors: validationErrors,
+		}
+	}
+	if err := sender.Allowed(s.senderStore, u.Username, request.Src); err == sender.ErrNotApproved {
+		return response, sender.SrcError(request.Src)
+	} else if err != nil {
+		return response, errors.Wrap(err, "couldn't get sender ids")
+	}
+	conf, err := s.configStore.Get()
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't get config")
+	}
+	dst, err := e164.Normalize(request.Dst, conf.CountryCode(u.ConnectionGroup))
+	if err != nil {
 		return response, errs.ErrorResponse{
-			Errors: errors,
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: fmt.Sprintf("Destination is invalid; %s.", err),
+					Field:   "Dst",
+				},
+			},
 		}
 	}
 
@@ -118,16 +172,23 @@ func (s *service) Send(ctx context.Context, request sendRequest) (sendResponse,
 	if request.ScheduledAt > 0 {
 		status = message.Scheduled
 	}
-	enc := message.EncLatin
-	if !stringutils.IsASCII(request.Msg) {
-		enc = message.EncUCS
+	// message to a number which has opted out is saved as suppressed so it shows up in reports but is never sent
+	suppressed, err := s.optOutStore.Suppressed(u.Username, []string{dst})
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't get opt outs")
+	}
+	if suppressed[dst] {
+		status = message.Suppressed
+		response.Suppressed = true
 	}
+	enc := message.DetectEnc(request.Msg)
 	m := &message.Message{
 		ConnectionGroup: u.ConnectionGroup,
 		Username:        u.Username,
 		Msg:             request.Msg,
 		Enc:             enc,
-		Dst:             request.Dst,
+		Dst:             dst,
+		OriginalDst:     request.Dst,
 		Src:             request.Src,
 		Priority:        request.Priority,
 		QueuedAt:        queuedTime,
@@ -135,6 +196,7 @@ func (s *service) Send(ctx context.Context, request sendRequest) (sendResponse,
 		ScheduledAt:     request.ScheduledAt,
 		SendAfter:       request.SendAfter,
 		SendBefore:      request.SendBefore,
+		TimeZone:        request.TimeZone,
 		IsFlash:         request.IsFlash,
 	}
 	msg := request.Msg
@@ -149,6 +211,19 @@ func (s *service) Send(ctx context.Context, request sendRequest) (sendResponse,
 	}
 	m.RealMsg = msg
 	m.Total = message.Total(msg, m.Enc)
+	// suppressed message is never sent, so it isn't charged
+	if status == message.Suppressed {
+		response.ID, err = s.msgStore.Save(m)
+		return response, err
+	}
+	if err := credit.Charge(s.creditStore, u.Username, int64(m.Total), 0, "message to "+dst); err != nil {
+		return response, err
+	}
 	response.ID, err = s.msgStore.Save(m)
+	if err != nil {
+		if err := credit.RefundSegments(s.creditStore, u.Username, int64(m.Total), 0, "message to "+dst+" couldn't be saved"); err != nil {
+			s.logger.Error("error", err, "msg", "couldn't refund message", "username", u.Username, "segments", m.Total)
+		}
+	}
 	return response, err
 }
@@ -14,6 +14,7 @@ import (
 	"github.com/haisum/smpp-app/pkg/entities/message"
 	"github.com/haisum/smpp-app/pkg/errs"
 	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/segment"
 	"github.com/haisum/smpp-app/pkg/services/middleware"
 )
 
@@ -155,7 +156,12 @@ type sendRequest struct {
 	IsFlash     bool
 	SendBefore  string
 	SendAfter   string
-	Mask        bool
+	// TimeZone of SendAfter and SendBefore, user's time zone is used if it's empty
+	TimeZone string
+	Mask     bool
+	// TemplateID is id of a template whose text is used instead of Msg, its placeholders are replaced with Params
+	TemplateID int64
+	Params     map[string]string
 }
 
 func (request *sendRequest) validate() []errs.ResponseError {
@@ -173,6 +179,12 @@ func (request *sendRequest) validate() []errs.ResponseError {
 			Field:   "Msg",
 			Message: "Can't send empty message",
 		})
+	} else if message.Total(request.Msg, message.DetectEnc(request.Msg)) > segment.MaxParts {
+		errors = append(errors, errs.ResponseError{
+			Type:    errs.ErrorTypeForm,
+			Field:   "Msg",
+			Message: message.TooLongMessage,
+		})
 	}
 	if request.Src == "" {
 		errors = append(errors, errs.ResponseError{
@@ -227,6 +239,13 @@ func (request *sendRequest) validate() []errs.ResponseError {
 			}
 		}
 	}
+	if _, err := message.LoadLocation(request.TimeZone); err != nil {
+		errors = append(errors, errs.ResponseError{
+			Type:    errs.ErrorTypeForm,
+			Field:   "TimeZone",
+			Message: "Time zone must be a valid IANA time zone such as \"Asia/Dubai\".",
+		})
+	}
 	if request.ScheduledAt != 0 && request.ScheduledAt < time.Now().UTC().Unix() {
 		errors = append(errors, errs.ResponseError{
 			Type:    errs.ErrorTypeForm,
@@ -239,6 +258,8 @@ func (request *sendRequest) validate() []errs.ResponseError {
 
 type sendResponse struct {
 	ID int64
+	// Suppressed is true if destination has opted out, message is saved but won't be sent
+	Suppressed bool
 }
 
 func makeSendEndpoint(svc Service) endpoint.Endpoint {
@@ -15,7 +15,9 @@ import (
 	"github.com/pkg/errors"
 )
 
-// AuthMiddleware returns a Basic Authentication middleware for a particular user and password.
+// AuthMiddleware returns an authentication middleware which allows users having all given actions.
+// Requests are authenticated either with HTTP Basic auth or with "Authorization: Bearer <token>" if authority
+// implements user.TokenAuthenticator.
 func AuthMiddleware(authority user.Authenticator, realm string, actions ...string) endpoint.Middleware {
 	return func(next endpoint.Endpoint) endpoint.Endpoint {
 		return func(ctx context.Context, request interface{}) (interface{}, error) {
@@ -23,11 +25,23 @@ func AuthMiddleware(authority user.Authenticator, realm string, actions ...strin
 			if !ok {
 				return nil, errs.AuthError{}
 			}
-			givenUser, givenPassword, ok := parseBasicAuth(auth)
-			if !ok {
-				return nil, errs.AuthError{}
+			var (
+				u   *user.User
+				err error
+			)
+			if token, ok := ParseBearerAuth(auth); ok {
+				tokenAuthority, ok := authority.(user.TokenAuthenticator)
+				if !ok {
+					return nil, errs.AuthError{}
+				}
+				u, err = tokenAuthority.AuthenticateToken(token)
+			} else {
+				givenUser, givenPassword, ok := parseBasicAuth(auth)
+				if !ok {
+					return nil, errs.AuthError{}
+				}
+				u, err = authority.Authenticate(stringutils.ByteToString(givenUser), stringutils.ByteToString(givenPassword))
 			}
-			u, err := authority.Authenticate(stringutils.ByteToString(givenUser), stringutils.ByteToString(givenPassword))
 			if err != nil {
 				return nil, errors.Wrap(errs.AuthError{}, err.Error())
 			}
@@ -42,6 +56,17 @@ func AuthMiddleware(authority user.Authenticator, realm string, actions ...strin
 	}
 }
 
+// ParseBearerAuth parses an HTTP Bearer Authentication string.
+// "Bearer abc" returns ("abc", true).
+func ParseBearerAuth(auth string) (token string, ok bool) {
+	const prefix = "Bearer "
+	if !strings.HasPrefix(auth, prefix) {
+		return
+	}
+	token = strings.TrimSpace(auth[len(prefix):])
+	return token, token != ""
+}
+
 // parseBasicAuth parses an HTTP Basic Authentication string.
 // "Basic QWxhZGRpbjpvcGVuIHNlc2FtZQ==" returns ([]byte("Aladdin"), []byte("open sesame"), true).
 func parseBasicAuth(auth string) (username, password []byte, ok bool) {
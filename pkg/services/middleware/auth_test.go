@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+
+	httptransport "github.com/go-kit/kit/transport/http"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/pkg/errors"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+type basicAuthenticator struct{}
+
+func (basicAuthenticator) Authenticate(username, password string) (*user.User, error) {
+	if username == "admin" && password == "secret" {
+		return &user.User{Username: username, Permissions: permission.List{permission.ListUsers}}, nil
+	}
+	return nil, errors.New("username or password is wrong")
+}
+
+type tokenAuthenticator struct {
+	basicAuthenticator
+}
+
+func (tokenAuthenticator) AuthenticateToken(token string) (*user.User, error) {
+	if token == "abc" {
+		return &user.User{Username: "admin"}, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	assert := assert.New(t)
+	next := func(ctx context.Context, request interface{}) (interface{}, error) {
+		u, err := user.FromContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+		return u.Username, nil
+	}
+	call := func(authority user.Authenticator, auth string, actions ...string) (interface{}, error) {
+		ctx := context.WithValue(context.Background(), httptransport.ContextKeyRequestAuthorization, auth)
+		return AuthMiddleware(authority, "", actions...)(next)(ctx, nil)
+	}
+	v, err := call(basicAuthenticator{}, "Basic YWRtaW46c2VjcmV0", permission.ListUsers)
+	assert.Nil(err)
+	assert.Equal("admin", v)
+	_, err = call(basicAuthenticator{}, "Basic YWRtaW46d3Jvbmc=")
+	assert.Equal(errs.AuthError{}, errors.Cause(err))
+	_, err = call(basicAuthenticator{}, "Bearer abc", "")
+	assert.Equal(errs.AuthError{}, errors.Cause(err))
+
+	v, err = call(tokenAuthenticator{}, "Bearer abc", "")
+	assert.Nil(err)
+	assert.Equal("admin", v)
+	_, err = call(tokenAuthenticator{}, "Bearer abc", permission.ListUsers)
+	assert.IsType(&errs.ForbiddenError{}, err)
+	_, err = call(tokenAuthenticator{}, "Bearer xyz", "")
+	assert.Equal(errs.AuthError{}, errors.Cause(err))
+}
+
+func TestParseBearerAuth(t *testing.T) {
+	assert := assert.New(t)
+	token, ok := ParseBearerAuth("Bearer abc ")
+	assert.True(ok)
+	assert.Equal("abc", token)
+	_, ok = ParseBearerAuth("Bearer ")
+	assert.False(ok)
+	_, ok = ParseBearerAuth("Basic abc")
+	assert.False(ok)
+}
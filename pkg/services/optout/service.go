@@ -0,0 +1,280 @@
+package optout
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/e164"
+	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
+	"github.com/haisum/smpp-app/pkg/entities/config"
+	"github.com/haisum/smpp-app/pkg/entities/optout"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// Service is interface for opt out service
+type Service interface {
+	Add(ctx context.Context, request addRequest) (addResponse, error)
+	Remove(ctx context.Context, request removeRequest) (removeResponse, error)
+	List(ctx context.Context, request listRequest) (listResponse, error)
+	Import(ctx context.Context, request importRequest) (importResponse, error)
+}
+
+type service struct {
+	logger           logger.Logger
+	optOutStore      optout.Store
+	configStore      config.Store
+	processExcelFunc file.ProcessExcelFunc
+	authenticator    user.Authenticator
+}
+
+// NewService returns a new opt out service
+func NewService(logger logger.Logger, optOutStore optout.Store, configStore config.Store, processExcelFunc file.ProcessExcelFunc, auth user.Authenticator) Service {
+	return &service{
+		logger, optOutStore, configStore, processExcelFunc, auth,
+	}
+}
+
+// Add opts numbers out from messages of a user, or from all messages if request is global.
+// Numbers are normalized to E.164 format with default country code of user's group.
+func (svc *service) Add(ctx context.Context, request addRequest) (addResponse, error) {
+	response := addResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	username, err := scope(u, request.Username, request.Global)
+	if err != nil {
+		return response, err
+	}
+	numbers, err := svc.normalize(u, request.Numbers)
+	if err != nil {
+		return response, err
+	}
+	var oo []optout.OptOut
+	now := time.Now().UTC().Unix()
+	for _, n := range numbers {
+		oo = append(oo, optout.OptOut{
+			Number:    n,
+			Username:  username,
+			Reason:    request.Reason,
+			AddedBy:   u.Username,
+			CreatedAt: now,
+		})
+		if len(oo) == optout.MaxAddCount {
+			if err := svc.add(oo, &response.Count); err != nil {
+				return response, err
+			}
+			oo = oo[:0]
+		}
+	}
+	err = svc.add(oo, &response.Count)
+	return response, err
+}
+
+// Remove deletes numbers from opt out list of a user, or from global list if request is global
+func (svc *service) Remove(ctx context.Context, request removeRequest) (removeResponse, error) {
+	response := removeResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	username, err := scope(u, request.Username, request.Global)
+	if err != nil {
+		return response, err
+	}
+	numbers, err := svc.normalize(u, request.Numbers)
+	if err != nil {
+		return response, err
+	}
+	response.Count, err = svc.optOutStore.Remove(username, numbers)
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't remove opt outs")
+	}
+	return response, nil
+}
+
+// List filters opt outs. Global list can be seen by everyone, user needs EditOptOuts permission to list opt outs of other users.
+func (svc *service) List(ctx context.Context, request listRequest) (listResponse, error) {
+	response := listResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if !request.Global && request.Username != u.Username && !u.Can(permission.EditOptOuts) {
+		return response, errs.ForbiddenError{"user doesn't have permission to list opt outs of other users"}
+	}
+	if request.Number != "" {
+		if request.Number, err = svc.normalizeOne(u, request.Number); err != nil {
+			return response, err
+		}
+	}
+	response.OptOuts, err = svc.optOutStore.List(&request.Criteria)
+	return response, err
+}
+
+// Import adds numbers of a csv, txt or xlsx file in same formats as campaign files to an opt out list.
+// Whole file is validated before any number is added.
+func (svc *service) Import(ctx context.Context, request importRequest) (importResponse, error) {
+	response := importResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	defer request.File.Close()
+	username, err := scope(u, request.Username, request.Global)
+	if err != nil {
+		return response, err
+	}
+	countryCode, err := svc.countryCode(u)
+	if err != nil {
+		return response, err
+	}
+	f := &file.File{
+		Name: request.FileName,
+		Type: file.Type(filepath.Ext(strings.ToLower(request.FileName))),
+	}
+	if f.Type != file.CSV && f.Type != file.TXT && f.Type != file.XLSX {
+		return response, fileError(fmt.Errorf("only csv, txt and xlsx extensions are allowed; given file %s has extension %s", f.Name, f.Type))
+	}
+	rows, err := file.NewRows(f, svc.processExcelFunc, request.File, countryCode)
+	if err == nil {
+		err = file.Each(rows, func(r file.Row) error {
+			response.Total++
+			return nil
+		})
+	}
+	if err != nil {
+		return response, fileError(err)
+	}
+	if _, err := request.File.Seek(0, io.SeekStart); err != nil {
+		return response, errors.Wrap(err, "couldn't read file again")
+	}
+	rows, err = file.NewRows(f, svc.processExcelFunc, request.File, countryCode)
+	if err != nil {
+		return response, fileError(err)
+	}
+	var oo []optout.OptOut
+	now := time.Now().UTC().Unix()
+	err = file.Each(rows, func(r file.Row) error {
+		oo = append(oo, optout.OptOut{
+			Number:    r.Destination,
+			Username:  username,
+			Reason:    request.Reason,
+			AddedBy:   u.Username,
+			CreatedAt: now,
+		})
+		if len(oo) < optout.MaxAddCount {
+			return nil
+		}
+		err := svc.add(oo, &response.Count)
+		oo = oo[:0]
+		return err
+	})
+	if err == nil {
+		err = svc.add(oo, &response.Count)
+	}
+	return response, err
+}
+
+// add saves opt outs and adds number of saved ones to count
+func (svc *service) add(oo []optout.OptOut, count *int64) error {
+	n, err := svc.optOutStore.Add(oo)
+	if err != nil {
+		return errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't save opt outs",
+				},
+			},
+		}, err.Error())
+	}
+	*count += n
+	return nil
+}
+
+// scope returns username whose opt out list a request is for, it's empty for global list. u needs EditOptOuts
+// permission to change global list or list of another user.
+func scope(u *user.User, username string, global bool) (string, error) {
+	if global {
+		username = ""
+	} else if username == "" {
+		username = u.Username
+	}
+	if username != u.Username && !u.Can(permission.EditOptOuts) {
+		return "", errs.ForbiddenError{"user doesn't have permission to edit global opt outs or opt outs of other users"}
+	}
+	return username, nil
+}
+
+// countryCode returns default country code of u's connection group
+func (svc *service) countryCode(u *user.User) (string, error) {
+	conf, err := svc.configStore.Get()
+	if err != nil {
+		return "", errors.Wrap(err, "couldn't get config")
+	}
+	return conf.CountryCode(u.ConnectionGroup), nil
+}
+
+// normalize converts numbers to E.164 format, invalid numbers are returned as form errors
+func (svc *service) normalize(u *user.User, numbers []string) ([]string, error) {
+	if len(numbers) == 0 {
+		return nil, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "No numbers provided.",
+					Field:   "Numbers",
+				},
+			},
+		}
+	}
+	countryCode, err := svc.countryCode(u)
+	if err != nil {
+		return nil, err
+	}
+	resp := errs.ErrorResponse{}
+	normalized := make([]string, len(numbers))
+	for i, n := range numbers {
+		if normalized[i], err = e164.Normalize(n, countryCode); err != nil {
+			resp.Errors = append(resp.Errors, errs.ResponseError{
+				Type:    errs.ErrorTypeForm,
+				Message: fmt.Sprintf("Number %s is invalid; %s.", n, err),
+				Field:   "Numbers",
+			})
+		}
+	}
+	if len(resp.Errors) > 0 {
+		return nil, resp
+	}
+	return normalized, nil
+}
+
+func (svc *service) normalizeOne(u *user.User, number string) (string, error) {
+	numbers, err := svc.normalize(u, []string{number})
+	if err != nil {
+		return "", err
+	}
+	return numbers[0], nil
+}
+
+// fileError returns a form error for an error in reading imported file
+func fileError(err error) error {
+	return errors.Wrap(errs.ErrorResponse{
+		Errors: []errs.ResponseError{
+			{
+				Type:    errs.ErrorTypeForm,
+				Message: "Couldn't read numbers from file.",
+				Field:   "File",
+			},
+		},
+	}, err.Error())
+}
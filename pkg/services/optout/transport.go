@@ -0,0 +1,215 @@
+package optout
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"strconv"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/campaign/file"
+	"github.com/haisum/smpp-app/pkg/entities/optout"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/services/middleware"
+	"github.com/pkg/errors"
+)
+
+// MakeHandler returns a http handler for the opt out service.
+func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kithttp.EncodeResponseFunc) http.Handler {
+	authMid := middleware.AuthMiddleware(svc.(*service).authenticator, "", "")
+	addHandler := kithttp.NewServer(
+		authMid(makeAddEndpoint(svc)),
+		decodeAddRequest,
+		responseEncoder, opts...)
+	removeHandler := kithttp.NewServer(
+		authMid(makeRemoveEndpoint(svc)),
+		decodeRemoveRequest,
+		responseEncoder, opts...)
+	listHandler := kithttp.NewServer(
+		authMid(makeListEndpoint(svc)),
+		decodeListRequest,
+		responseEncoder, opts...)
+	importHandler := kithttp.NewServer(
+		authMid(makeImportEndpoint(svc)),
+		decodeImportRequest,
+		responseEncoder, opts...)
+	r := mux.NewRouter()
+	r.Handle("/optout/v1/add", addHandler).Methods("POST")
+	r.Handle("/optout/v1/remove", removeHandler).Methods("POST")
+	r.Handle("/optout/v1/list", listHandler).Methods("GET", "POST")
+	r.Handle("/optout/v1/import", importHandler).Methods("POST")
+	return r
+}
+
+type addRequest struct {
+	URL     string
+	Numbers []string
+	// Username is user whose list numbers are added to, it's logged in user if empty
+	Username string
+	// Global adds numbers to list which applies to messages of all users
+	Global bool
+	Reason string
+}
+
+type addResponse struct {
+	// Count is number of added opt outs, numbers which had already opted out aren't counted
+	Count int64
+}
+
+func makeAddEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addRequest)
+		v, err := svc.Add(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeAddRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request addRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type removeRequest struct {
+	URL      string
+	Numbers  []string
+	Username string
+	Global   bool
+}
+
+type removeResponse struct {
+	Count int64
+}
+
+func makeRemoveEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(removeRequest)
+		v, err := svc.Remove(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeRemoveRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request removeRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type listRequest struct {
+	optout.Criteria
+	URL string
+}
+
+type listResponse struct {
+	OptOuts []optout.OptOut
+}
+
+func makeListEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listRequest)
+		v, err := svc.List(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request listRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type importRequest struct {
+	URL      string
+	FileName string
+	Username string
+	Global   bool
+	Reason   string
+	File     multipart.File `json:"-"`
+}
+
+type importResponse struct {
+	// Count is number of added opt outs, numbers which had already opted out aren't counted
+	Count int64
+	// Total is number of unique numbers in file
+	Total int64
+}
+
+func makeImportEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(importRequest)
+		v, err := svc.Import(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeImportRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	request := importRequest{}
+	request.URL = r.URL.RequestURI()
+	maxPostSize := file.MaxFileSize + (1024 * 512)
+	if r.ContentLength > maxPostSize {
+		return request, fmt.Errorf("file size can't be larger than %d", file.MaxFileSize)
+	}
+	if err := r.ParseMultipartForm(maxPostSize); err != nil {
+		return request, errors.Wrap(err, "error in parsing multi part form, check size")
+	}
+	f, h, err := r.FormFile("File")
+	if err != nil {
+		return request, errors.Wrap(err, "couldn't read uploaded file")
+	}
+	request.File = f
+	request.FileName = h.Filename
+	request.Username = r.PostFormValue("Username")
+	request.Global, _ = strconv.ParseBool(r.PostFormValue("Global"))
+	request.Reason = r.PostFormValue("Reason")
+	return request, nil
+}
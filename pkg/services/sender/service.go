@@ -0,0 +1,192 @@
+package sender
+
+import (
+	"context"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/sender"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// Service is interface for sender id service
+type Service interface {
+	Request(ctx context.Context, request requestRequest) (requestResponse, error)
+	Approve(ctx context.Context, request reviewRequest) (reviewResponse, error)
+	Reject(ctx context.Context, request reviewRequest) (reviewResponse, error)
+	List(ctx context.Context, request listRequest) (listResponse, error)
+	Log(ctx context.Context, request logRequest) (logResponse, error)
+}
+
+type service struct {
+	logger        logger.Logger
+	senderStore   sender.Store
+	authenticator user.Authenticator
+}
+
+// NewService returns a new sender id service
+func NewService(logger logger.Logger, senderStore sender.Store, auth user.Authenticator) Service {
+	return &service{
+		logger, senderStore, auth,
+	}
+}
+
+// Request asks for a sender id for logged in user. A sender id which was rejected earlier can be requested again,
+// one which is pending or approved can't. Users with ApproveSenderIDs permission can request for other users.
+func (svc *service) Request(ctx context.Context, request requestRequest) (requestResponse, error) {
+	response := requestResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Username == "" {
+		request.Username = u.Username
+	}
+	if request.Username != u.Username && !u.Can(permission.ApproveSenderIDs) {
+		return response, errs.ForbiddenError{"user doesn't have permission to request sender ids for other users"}
+	}
+	now := time.Now().UTC().Unix()
+	s := sender.Sender{
+		Username:  request.Username,
+		Src:       request.Src,
+		Status:    sender.Pending,
+		Note:      request.Note,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := s.Validate(); err != nil {
+		return response, err.(*errs.ValidationError).FormErrors()
+	}
+	existing, err := svc.senderStore.List(&sender.Criteria{Username: s.Username, Src: s.Src})
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't get sender ids")
+	}
+	if len(existing) > 0 {
+		if existing[0].Status != sender.Rejected {
+			return response, errs.ErrorResponse{
+				Errors: []errs.ResponseError{
+					{
+						Type:    errs.ErrorTypeForm,
+						Message: "Sender ID has already been requested.",
+						Field:   "Src",
+					},
+				},
+			}
+		}
+		s.ID = existing[0].ID
+		s.CreatedAt = existing[0].CreatedAt
+	}
+	err = svc.save(&s, sender.ActionRequested, u.Username, request.Note)
+	response.Sender = s
+	return response, err
+}
+
+// Approve allows user of a sender id to send messages from it
+func (svc *service) Approve(ctx context.Context, request reviewRequest) (reviewResponse, error) {
+	return svc.review(ctx, request, sender.Approved, sender.ActionApproved)
+}
+
+// Reject rejects a pending sender id, or revokes an approved one
+func (svc *service) Reject(ctx context.Context, request reviewRequest) (reviewResponse, error) {
+	return svc.review(ctx, request, sender.Rejected, sender.ActionRejected)
+}
+
+// review changes status of a sender id and records who changed it
+func (svc *service) review(ctx context.Context, request reviewRequest, status sender.Status, action sender.Action) (reviewResponse, error) {
+	response := reviewResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	ss, err := svc.senderStore.List(&sender.Criteria{ID: request.ID})
+	if err != nil || len(ss) == 0 {
+		resp := errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "Couldn't get sender ID.",
+					Field:   "ID",
+				},
+			},
+		}
+		if err == nil {
+			err = sender.ErrNotFound
+		}
+		return response, errors.Wrap(resp, err.Error())
+	}
+	s := ss[0]
+	if s.Status == status {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeRequest,
+					Message: "Sender ID is already " + string(status) + ".",
+				},
+			},
+		}
+	}
+	s.Status = status
+	s.ReviewedBy = u.Username
+	s.ReviewNote = request.Note
+	s.UpdatedAt = time.Now().UTC().Unix()
+	err = svc.save(&s, action, u.Username, request.Note)
+	response.Sender = s
+	return response, err
+}
+
+// List filters sender ids. User needs ApproveSenderIDs permission to list sender ids of other users, including
+// pending requests of all users when Username is empty.
+func (svc *service) List(ctx context.Context, request listRequest) (listResponse, error) {
+	response := listResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Username != u.Username && !u.Can(permission.ApproveSenderIDs) {
+		return response, errs.ForbiddenError{"user doesn't have permission to list sender ids of other users"}
+	}
+	response.Senders, err = svc.senderStore.List(&request.Criteria)
+	return response, err
+}
+
+// Log filters audit trail of requests, approvals and rejections of sender ids. User needs ApproveSenderIDs permission
+// to see audit trail of other users.
+func (svc *service) Log(ctx context.Context, request logRequest) (logResponse, error) {
+	response := logResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Username != u.Username && !u.Can(permission.ApproveSenderIDs) {
+		return response, errs.ForbiddenError{"user doesn't have permission to see sender id log of other users"}
+	}
+	response.Audits, err = svc.senderStore.Audits(&request.AuditCriteria)
+	return response, err
+}
+
+// save saves s and records action in its audit trail
+func (svc *service) save(s *sender.Sender, action sender.Action, by, note string) error {
+	a := sender.Audit{
+		Username:  s.Username,
+		Src:       s.Src,
+		Action:    action,
+		ChangedBy: by,
+		Note:      note,
+		CreatedAt: s.UpdatedAt,
+	}
+	var err error
+	if s.ID, err = svc.senderStore.Save(s, &a); err != nil {
+		return errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't save sender id",
+				},
+			},
+		}, err.Error())
+	}
+	return nil
+}
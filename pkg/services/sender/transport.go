@@ -0,0 +1,194 @@
+package sender
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/sender"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/services/middleware"
+)
+
+// MakeHandler returns a http handler for the sender id service.
+func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kithttp.EncodeResponseFunc) http.Handler {
+	authenticator := svc.(*service).authenticator
+	authMid := middleware.AuthMiddleware(authenticator, "", "")
+	requestHandler := kithttp.NewServer(
+		authMid(makeRequestEndpoint(svc)),
+		decodeRequestRequest,
+		responseEncoder, opts...)
+	listHandler := kithttp.NewServer(
+		authMid(makeListEndpoint(svc)),
+		decodeListRequest,
+		responseEncoder, opts...)
+	logHandler := kithttp.NewServer(
+		authMid(makeLogEndpoint(svc)),
+		decodeLogRequest,
+		responseEncoder, opts...)
+	authMid = middleware.AuthMiddleware(authenticator, "", permission.ApproveSenderIDs)
+	approveHandler := kithttp.NewServer(
+		authMid(makeReviewEndpoint(svc.Approve)),
+		decodeReviewRequest,
+		responseEncoder, opts...)
+	rejectHandler := kithttp.NewServer(
+		authMid(makeReviewEndpoint(svc.Reject)),
+		decodeReviewRequest,
+		responseEncoder, opts...)
+	r := mux.NewRouter()
+	r.Handle("/sender/v1/request", requestHandler).Methods("POST")
+	r.Handle("/sender/v1/approve", approveHandler).Methods("POST")
+	r.Handle("/sender/v1/reject", rejectHandler).Methods("POST")
+	r.Handle("/sender/v1/list", listHandler).Methods("GET", "POST")
+	r.Handle("/sender/v1/log", logHandler).Methods("GET", "POST")
+	return r
+}
+
+type requestRequest struct {
+	URL string
+	Src string
+	// Username is user who will send from Src, it's logged in user if empty
+	Username string
+	Note     string
+}
+
+type requestResponse struct {
+	Sender sender.Sender
+}
+
+func makeRequestEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(requestRequest)
+		v, err := svc.Request(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeRequestRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request requestRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type reviewRequest struct {
+	URL  string
+	ID   int64
+	Note string
+}
+
+type reviewResponse struct {
+	Sender sender.Sender
+}
+
+func makeReviewEndpoint(review func(context.Context, reviewRequest) (reviewResponse, error)) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(reviewRequest)
+		v, err := review(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeReviewRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request reviewRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type listRequest struct {
+	sender.Criteria
+	URL string
+}
+
+type listResponse struct {
+	Senders []sender.Sender
+}
+
+func makeListEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listRequest)
+		v, err := svc.List(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request listRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type logRequest struct {
+	sender.AuditCriteria
+	URL string
+}
+
+type logResponse struct {
+	Audits []sender.Audit
+}
+
+func makeLogEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(logRequest)
+		v, err := svc.Log(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeLogRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request logRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
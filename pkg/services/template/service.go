@@ -0,0 +1,134 @@
+package template
+
+import (
+	"context"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/template"
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+// Service is interface for template service
+type Service interface {
+	Add(ctx context.Context, request addRequest) (addResponse, error)
+	Edit(ctx context.Context, request editRequest) (editResponse, error)
+	List(ctx context.Context, request listRequest) (listResponse, error)
+	Delete(ctx context.Context, request deleteRequest) (deleteResponse, error)
+}
+
+type service struct {
+	logger        logger.Logger
+	templateStore template.Store
+	authenticator user.Authenticator
+}
+
+// NewService returns a new template service
+func NewService(logger logger.Logger, templateStore template.Store, auth user.Authenticator) Service {
+	return &service{
+		logger, templateStore, auth,
+	}
+}
+
+// Add saves a new template for logged in user
+func (svc *service) Add(ctx context.Context, request addRequest) (addResponse, error) {
+	response := addResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	now := time.Now().UTC().Unix()
+	t := template.Template{
+		Name:        request.Name,
+		Description: request.Description,
+		Msg:         request.Msg,
+		Username:    u.Username,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := t.Validate(); err != nil {
+		return response, err.(*errs.ValidationError).FormErrors()
+	}
+	t.ID, err = svc.templateStore.Save(&t)
+	if err != nil {
+		return response, errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't save template",
+				},
+			},
+		}, err.Error())
+	}
+	response.Template = t
+	return response, nil
+}
+
+// Edit changes name, description or text of a template. Templates of other users can be edited with EditTemplates permission.
+func (svc *service) Edit(ctx context.Context, request editRequest) (editResponse, error) {
+	response := editResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	t, err := template.Get(svc.templateStore, u, request.ID, permission.EditTemplates, "ID")
+	if err != nil {
+		return response, err
+	}
+	if request.Name != "" {
+		t.Name = request.Name
+	}
+	if request.Description != "" {
+		t.Description = request.Description
+	}
+	if request.Msg != "" {
+		t.Msg = request.Msg
+	}
+	t.UpdatedAt = time.Now().UTC().Unix()
+	if err := t.Validate(); err != nil {
+		return response, err.(*errs.ValidationError).FormErrors()
+	}
+	if _, err := svc.templateStore.Save(&t); err != nil {
+		return response, errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't update template",
+				},
+			},
+		}, err.Error())
+	}
+	response.Template = t
+	return response, nil
+}
+
+// List filters templates, user needs ListTemplates permission to list templates of other users
+func (svc *service) List(ctx context.Context, request listRequest) (listResponse, error) {
+	response := listResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Username != u.Username && !u.Can(permission.ListTemplates) {
+		return response, errs.ForbiddenError{"user doesn't have permission to list templates"}
+	}
+	response.Templates, err = svc.templateStore.List(&request.Criteria)
+	return response, err
+}
+
+// Delete deletes a template. Templates of other users can be deleted with EditTemplates permission.
+func (svc *service) Delete(ctx context.Context, request deleteRequest) (deleteResponse, error) {
+	response := deleteResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if _, err := template.Get(svc.templateStore, u, request.ID, permission.EditTemplates, "ID"); err != nil {
+		return response, err
+	}
+	err = svc.templateStore.Delete(request.ID)
+	return response, err
+}
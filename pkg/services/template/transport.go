@@ -0,0 +1,186 @@
+package template
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/template"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/services/middleware"
+)
+
+// MakeHandler returns a http handler for the template service.
+func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kithttp.EncodeResponseFunc) http.Handler {
+	authMid := middleware.AuthMiddleware(svc.(*service).authenticator, "", "")
+	addHandler := kithttp.NewServer(
+		authMid(makeAddEndpoint(svc)),
+		decodeAddRequest,
+		responseEncoder, opts...)
+	editHandler := kithttp.NewServer(
+		authMid(makeEditEndpoint(svc)),
+		decodeEditRequest,
+		responseEncoder, opts...)
+	listHandler := kithttp.NewServer(
+		authMid(makeListEndpoint(svc)),
+		decodeListRequest,
+		responseEncoder, opts...)
+	deleteHandler := kithttp.NewServer(
+		authMid(makeDeleteEndpoint(svc)),
+		decodeDeleteRequest,
+		responseEncoder, opts...)
+	r := mux.NewRouter()
+	r.Handle("/template/v1/add", addHandler).Methods("POST")
+	r.Handle("/template/v1/edit", editHandler).Methods("POST")
+	r.Handle("/template/v1/list", listHandler).Methods("GET", "POST")
+	r.Handle("/template/v1/delete", deleteHandler).Methods("POST")
+	return r
+}
+
+type addRequest struct {
+	URL         string
+	Name        string
+	Description string
+	Msg         string
+}
+
+type addResponse struct {
+	Template template.Template
+}
+
+func makeAddEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addRequest)
+		v, err := svc.Add(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeAddRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request addRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type editRequest struct {
+	URL         string
+	ID          int64
+	Name        string
+	Description string
+	Msg         string
+}
+
+type editResponse struct {
+	Template template.Template
+}
+
+func makeEditEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(editRequest)
+		v, err := svc.Edit(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeEditRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request editRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type listRequest struct {
+	template.Criteria
+	URL string
+}
+
+type listResponse struct {
+	Templates []template.Template
+}
+
+func makeListEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listRequest)
+		v, err := svc.List(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request listRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type deleteRequest struct {
+	URL string
+	ID  int64
+}
+
+type deleteResponse struct {
+}
+
+func makeDeleteEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteRequest)
+		v, err := svc.Delete(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeDeleteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request deleteRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
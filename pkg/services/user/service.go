@@ -3,27 +3,34 @@ package user
 import (
 	"context"
 
+	"github.com/haisum/smpp-app/pkg/entities/credit"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/errs"
 	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
 )
 
 // Service is user service's interface
 type Service interface {
 	Info(ctx context.Context, request infoRequest) (infoResponse, error)
 	Edit(ctx context.Context, request editRequest) (editResponse, error)
+	Login(ctx context.Context, request loginRequest) (loginResponse, error)
+	Logout(ctx context.Context, request logoutRequest) (logoutResponse, error)
+	Ledger(ctx context.Context, request ledgerRequest) (ledgerResponse, error)
 }
 
 type service struct {
 	logger        logger.Logger
 	userStore     user.Store
+	tokenStore    user.TokenStore
+	creditStore   credit.Store
 	authenticator user.Authenticator
 }
 
 // NewService returns a new user service
-func NewService(logger logger.Logger, userStore user.Store, authenticator user.Authenticator) Service {
+func NewService(logger logger.Logger, userStore user.Store, tokenStore user.TokenStore, creditStore credit.Store, authenticator user.Authenticator) Service {
 	return &service{
-		logger, userStore, authenticator,
+		logger, userStore, tokenStore, creditStore, authenticator,
 	}
 }
 
@@ -37,6 +44,7 @@ func (s *service) Info(ctx context.Context, request infoRequest) (infoResponse,
 	response.ConnectionGroup = u.ConnectionGroup
 	response.Permissions = u.Permissions
 	response.Suspended = u.Suspended
+	response.TimeZone = u.TimeZone
 	response.RegisteredAt = u.RegisteredAt
 	response.Username = u.Username
 	response.Name = u.Name
@@ -56,6 +64,9 @@ func (s *service) Edit(ctx context.Context, request editRequest) (editResponse,
 	if request.Email != "" {
 		u.Email = request.Email
 	}
+	if request.TimeZone != "" {
+		u.TimeZone = request.TimeZone
+	}
 	if request.Password != "" {
 		u.Password = request.Password
 	}
@@ -77,6 +88,103 @@ func (s *service) Edit(ctx context.Context, request editRequest) (editResponse,
 		s.logger.Error("msg", "couldn't update user", "error", err)
 		return response, err
 	}
+	// tokens issued with old password must not keep working
+	if len(request.Password) > 1 {
+		if _, err := s.tokenStore.DeleteAll(u.Username); err != nil {
+			s.logger.Error("msg", "couldn't revoke tokens", "error", err)
+			return response, err
+		}
+	}
 	response.User = u
 	return response, nil
 }
+
+// Login endpoint authenticates username and password and issues a token which can be used in
+// "Authorization: Bearer" header until it isn't used for Validity seconds
+func (s *service) Login(ctx context.Context, request loginRequest) (loginResponse, error) {
+	response := loginResponse{}
+	u, err := s.authenticator.Authenticate(request.Username, request.Password)
+	if err != nil {
+		return response, errors.Wrap(errs.AuthError{}, err.Error())
+	}
+	if u.Suspended {
+		return response, &errs.ForbiddenError{Message: "user is suspended"}
+	}
+	validity := request.Validity
+	if validity == 0 {
+		validity = user.DefaultTokenValidity
+	}
+	if validity < 0 || validity > user.MaxTokenValidity {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "validity must be between 1 and 2592000 seconds",
+					Field:   "Validity",
+				},
+			},
+		}
+	}
+	token, err := s.tokenStore.Add(u.Username, validity)
+	if err != nil {
+		err = errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't create token",
+				},
+			},
+		}, err.Error())
+		return response, err
+	}
+	response.Token = token
+	response.Validity = validity
+	return response, nil
+}
+
+// Logout endpoint revokes token used for current request
+func (s *service) Logout(ctx context.Context, request logoutRequest) (logoutResponse, error) {
+	response := logoutResponse{}
+	if request.token == "" {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeRequest,
+					Message: "logout requires token authentication",
+				},
+			},
+		}
+	}
+	err := s.tokenStore.Delete(request.token)
+	if err != nil {
+		err = errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't delete token",
+				},
+			},
+		}, err.Error())
+		return response, err
+	}
+	return response, nil
+}
+
+// Ledger returns balance of user in current context and filters their ledger entries
+func (s *service) Ledger(ctx context.Context, request ledgerRequest) (ledgerResponse, error) {
+	response := ledgerResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	request.Username = u.Username
+	response.Balance, err = s.creditStore.Balance(u.Username)
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't get balance")
+	}
+	response.Entries, err = s.creditStore.Ledger(&request.Criteria)
+	if err != nil {
+		return response, errors.Wrap(err, "couldn't get ledger")
+	}
+	return response, nil
+}
@@ -8,6 +8,7 @@ import (
 	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
@@ -27,10 +28,25 @@ func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kitht
 		authMid(makeEditEndpoint(svc)),
 		decodeEditRequest,
 		responseEncoder, opts...)
+	loginHandler := kithttp.NewServer(
+		makeLoginEndpoint(svc),
+		decodeLoginRequest,
+		responseEncoder, opts...)
+	logoutHandler := kithttp.NewServer(
+		authMid(makeLogoutEndpoint(svc)),
+		decodeLogoutRequest,
+		responseEncoder, opts...)
+	ledgerHandler := kithttp.NewServer(
+		authMid(makeLedgerEndpoint(svc)),
+		decodeLedgerRequest,
+		responseEncoder, opts...)
 	r := mux.NewRouter()
 
 	r.Handle("/user/v1/info", infoHandler).Methods("GET")
 	r.Handle("/user/v1/edit", editHandler).Methods("POST")
+	r.Handle("/user/v1/login", loginHandler).Methods("POST")
+	r.Handle("/user/v1/logout", logoutHandler).Methods("POST")
+	r.Handle("/user/v1/ledger", ledgerHandler).Methods("GET", "POST")
 	return r
 }
 
@@ -46,6 +62,7 @@ type infoResponse struct {
 	Permissions     []permission.Permission
 	RegisteredAt    int64
 	Suspended       bool
+	TimeZone        string
 }
 
 func makeInfoEndpoint(svc Service) endpoint.Endpoint {
@@ -76,6 +93,7 @@ type editRequest struct {
 	Password string
 	Name     string
 	Email    string
+	TimeZone string
 }
 
 type editResponse struct {
@@ -108,3 +126,110 @@ func decodeEditRequest(_ context.Context, r *http.Request) (interface{}, error)
 	}
 	return request, nil
 }
+
+type loginRequest struct {
+	URL      string
+	Username string
+	Password string
+	// Validity is seconds token stays valid after its last use, user.DefaultTokenValidity is used if it's zero
+	Validity int64
+}
+
+type loginResponse struct {
+	Token    string
+	Validity int64
+}
+
+func makeLoginEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(loginRequest)
+		v, err := svc.Login(ctx, req)
+		req.Password = ""
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeLoginRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request loginRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type logoutRequest struct {
+	URL   string
+	token string
+}
+
+type logoutResponse struct{}
+
+func makeLogoutEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(logoutRequest)
+		v, err := svc.Logout(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeLogoutRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request logoutRequest
+	request.URL = r.URL.RequestURI()
+	request.token, _ = middleware.ParseBearerAuth(r.Header.Get("Authorization"))
+	return request, nil
+}
+
+type ledgerRequest struct {
+	credit.Criteria
+	URL string
+}
+
+type ledgerResponse struct {
+	Balance int64
+	Entries []credit.Entry
+}
+
+func makeLedgerEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(ledgerRequest)
+		v, err := svc.Ledger(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeLedgerRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request ledgerRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
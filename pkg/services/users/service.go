@@ -2,9 +2,11 @@ package users
 
 import (
 	"context"
+	"fmt"
 
 	"time"
 
+	"github.com/haisum/smpp-app/pkg/entities/credit"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
@@ -18,18 +20,22 @@ type Service interface {
 	Edit(ctx context.Context, request editRequest) (editResponse, error)
 	Add(ctx context.Context, request addRequest) (addResponse, error)
 	List(ctx context.Context, request listRequest) (listResponse, error)
+	RevokeTokens(ctx context.Context, request revokeTokensRequest) (revokeTokensResponse, error)
+	Credit(ctx context.Context, request creditRequest) (creditResponse, error)
 }
 
 type service struct {
 	logger        logger.Logger
 	userStore     user.Store
+	tokenStore    user.TokenStore
+	creditStore   credit.Store
 	authenticator user.Authenticator
 }
 
 // NewService returns a new user service
-func NewService(logger logger.Logger, userStore user.Store, authenticator user.Authenticator) Service {
+func NewService(logger logger.Logger, userStore user.Store, tokenStore user.TokenStore, creditStore credit.Store, authenticator user.Authenticator) Service {
 	return &service{
-		logger, userStore, authenticator,
+		logger, userStore, tokenStore, creditStore, authenticator,
 	}
 }
 
@@ -63,6 +69,12 @@ func (s *service) Edit(ctx context.Context, request editRequest) (editResponse,
 	if request.ConnectionGroup != "" {
 		u.ConnectionGroup = request.ConnectionGroup
 	}
+	if request.TimeZone != "" {
+		u.TimeZone = request.TimeZone
+	}
+	if request.Numbers != nil {
+		u.Numbers = request.Numbers
+	}
 	if request.Password != "" {
 		u.Password = request.Password
 	}
@@ -93,6 +105,9 @@ func (s *service) Edit(ctx context.Context, request editRequest) (editResponse,
 		return response, errResp
 	}
 	err = s.userStore.Update(u, len(request.Password) > 1)
+	if e, ok := errors.Cause(err).(user.NumberTakenError); ok {
+		return response, numberTakenResponse(e)
+	}
 	if err != nil {
 		err = errors.Wrap(errs.ErrorResponse{
 			Errors: []errs.ResponseError{
@@ -104,6 +119,20 @@ func (s *service) Edit(ctx context.Context, request editRequest) (editResponse,
 		}, err.Error())
 		return response, err
 	}
+	// tokens issued before suspension or password change must not keep working
+	if u.Suspended || len(request.Password) > 1 {
+		if _, err := s.tokenStore.DeleteAll(u.Username); err != nil {
+			err = errors.Wrap(errs.ErrorResponse{
+				Errors: []errs.ResponseError{
+					{
+						Type:    errs.ErrorTypeDB,
+						Message: "couldn't revoke tokens",
+					},
+				},
+			}, err.Error())
+			return response, err
+		}
+	}
 	response.User = u
 	return response, nil
 
@@ -120,6 +149,8 @@ func (s *service) Add(ctx context.Context, request addRequest) (addResponse, err
 		Permissions:     request.Permissions,
 		RegisteredAt:    time.Now().UTC().Unix(),
 		Suspended:       request.Suspended,
+		TimeZone:        request.TimeZone,
+		Numbers:         request.Numbers,
 	}
 	err := u.Validate()
 	if err != nil {
@@ -138,6 +169,9 @@ func (s *service) Add(ctx context.Context, request addRequest) (addResponse, err
 		return response, errResp
 	}
 	id, err := s.userStore.Add(u)
+	if e, ok := errors.Cause(err).(user.NumberTakenError); ok {
+		return response, numberTakenResponse(e)
+	}
 	if err != nil {
 		err = errors.Wrap(errs.ErrorResponse{
 			Errors: []errs.ResponseError{
@@ -170,3 +204,97 @@ func (s *service) List(ctx context.Context, request listRequest) (listResponse,
 	response.Users = users
 	return response, nil
 }
+
+// RevokeTokens logs a user out of all sessions by deleting all of their tokens
+func (s *service) RevokeTokens(ctx context.Context, request revokeTokensRequest) (revokeTokensResponse, error) {
+	response := revokeTokensResponse{}
+	if request.Username == "" {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "username can't be empty",
+					Field:   "Username",
+				},
+			},
+		}
+	}
+	n, err := s.tokenStore.DeleteAll(request.Username)
+	if err != nil {
+		err = errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't revoke tokens",
+				},
+			},
+		}, err.Error())
+		return response, err
+	}
+	response.Revoked = n
+	return response, nil
+}
+
+// Credit tops up balance of a user with given number of credits, one credit is charged for every message segment
+func (s *service) Credit(ctx context.Context, request creditRequest) (creditResponse, error) {
+	response := creditResponse{}
+	admin, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Amount <= 0 {
+		return response, errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "amount must be greater than zero",
+					Field:   "Amount",
+				},
+			},
+		}
+	}
+	if _, err := s.userStore.Get(request.Username); err != nil {
+		return response, errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "couldn't get user",
+					Field:   "Username",
+				},
+			},
+		}, err.Error())
+	}
+	e := credit.Entry{
+		Username:  request.Username,
+		Kind:      credit.TopUp,
+		Amount:    request.Amount,
+		Note:      request.Note,
+		AddedBy:   admin.Username,
+		CreatedAt: time.Now().UTC().Unix(),
+	}
+	if err := s.creditStore.Add(&e); err != nil {
+		return response, errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't add credit",
+				},
+			},
+		}, err.Error())
+	}
+	response.Entry = e
+	return response, nil
+}
+
+// numberTakenResponse returns form error of a user who is given a number owned by another user
+func numberTakenResponse(e user.NumberTakenError) errs.ErrorResponse {
+	return errs.ErrorResponse{
+		Errors: []errs.ResponseError{
+			{
+				Type:    errs.ErrorTypeForm,
+				Message: fmt.Sprintf("Number %s is owned by another user.", e.Number),
+				Field:   "Numbers",
+			},
+		},
+	}
+}
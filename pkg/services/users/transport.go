@@ -9,6 +9,7 @@ import (
 	"github.com/go-kit/kit/endpoint"
 	kithttp "github.com/go-kit/kit/transport/http"
 	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/credit"
 	"github.com/haisum/smpp-app/pkg/entities/user"
 	"github.com/haisum/smpp-app/pkg/entities/user/permission"
 	"github.com/haisum/smpp-app/pkg/errs"
@@ -39,12 +40,24 @@ func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kitht
 		authMid(makeListEndpoint(svc)),
 		decodeListRequest,
 		responseEncoder, opts...)
+	authMid = middleware.AuthMiddleware(authenticator, "", permission.EditUsers)
+	revokeTokensHandler := kithttp.NewServer(
+		authMid(makeRevokeTokensEndpoint(svc)),
+		decodeRevokeTokensRequest,
+		responseEncoder, opts...)
+	authMid = middleware.AuthMiddleware(authenticator, "", permission.AddCredit)
+	creditHandler := kithttp.NewServer(
+		authMid(makeCreditEndpoint(svc)),
+		decodeCreditRequest,
+		responseEncoder, opts...)
 	r := mux.NewRouter()
 
 	r.Handle("/users/v1/permissions", permissionsHandler).Methods("GET")
 	r.Handle("/users/v1/add", addHandler).Methods("POST")
 	r.Handle("/users/v1/edit", editHandler).Methods("POST")
 	r.Handle("/users/v1/list", listHandler).Methods("GET", "POST")
+	r.Handle("/users/v1/revoke", revokeTokensHandler).Methods("POST")
+	r.Handle("/users/v1/credit", creditHandler).Methods("POST")
 	return r
 }
 
@@ -123,6 +136,8 @@ type editRequest struct {
 	Email           string
 	ConnectionGroup string
 	Suspended       bool
+	TimeZone        string
+	Numbers         []string
 }
 
 type editResponse struct {
@@ -164,6 +179,8 @@ type addRequest struct {
 	Email           string
 	ConnectionGroup string
 	Suspended       bool
+	TimeZone        string
+	Numbers         []string
 }
 
 type addResponse struct {
@@ -195,3 +212,76 @@ func makeAddEndpoint(svc Service) endpoint.Endpoint {
 		return resp, nil
 	}
 }
+
+type revokeTokensRequest struct {
+	URL      string
+	Username string
+}
+
+type revokeTokensResponse struct {
+	Revoked int64
+}
+
+func decodeRevokeTokensRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var request revokeTokensRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func makeRevokeTokensEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(revokeTokensRequest)
+		v, err := svc.RevokeTokens(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+type creditRequest struct {
+	URL      string
+	Username string
+	// Amount is number of credits added to balance of user
+	Amount int64
+	Note   string
+}
+
+type creditResponse struct {
+	Entry credit.Entry
+}
+
+func decodeCreditRequest(ctx context.Context, r *http.Request) (interface{}, error) {
+	var request creditRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+func makeCreditEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(creditRequest)
+		v, err := svc.Credit(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
@@ -0,0 +1,187 @@
+package webhook
+
+import (
+	"context"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/user"
+	"github.com/haisum/smpp-app/pkg/entities/user/permission"
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/stringutils"
+	"github.com/pkg/errors"
+)
+
+// Service is interface for webhook service
+type Service interface {
+	Add(ctx context.Context, request addRequest) (addResponse, error)
+	Edit(ctx context.Context, request editRequest) (editResponse, error)
+	List(ctx context.Context, request listRequest) (listResponse, error)
+	Delete(ctx context.Context, request deleteRequest) (deleteResponse, error)
+	Log(ctx context.Context, request logRequest) (logResponse, error)
+}
+
+type service struct {
+	logger        logger.Logger
+	webhookStore  webhook.Store
+	outboxStore   webhook.OutboxStore
+	authenticator user.Authenticator
+}
+
+// NewService returns a new webhook service
+func NewService(logger logger.Logger, webhookStore webhook.Store, outboxStore webhook.OutboxStore, auth user.Authenticator) Service {
+	return &service{
+		logger, webhookStore, outboxStore, auth,
+	}
+}
+
+// Add registers a new webhook for logged in user
+func (svc *service) Add(ctx context.Context, request addRequest) (addResponse, error) {
+	response := addResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	now := time.Now().UTC().Unix()
+	w := webhook.Webhook{
+		Username:  u.Username,
+		URL:       request.WebhookURL,
+		Secret:    request.Secret,
+		Events:    stringutils.StringList(request.Events),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := w.Validate(); err != nil {
+		return response, validationResponse(err)
+	}
+	w.ID, err = svc.webhookStore.Save(&w)
+	if err != nil {
+		return response, errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't save webhook",
+				},
+			},
+		}, err.Error())
+	}
+	response.Webhook = w
+	return response, nil
+}
+
+// Edit changes url, secret or events of a webhook. Webhooks of other users can be edited with EditWebhooks permission.
+func (svc *service) Edit(ctx context.Context, request editRequest) (editResponse, error) {
+	response := editResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	w, err := svc.get(u, request.ID)
+	if err != nil {
+		return response, err
+	}
+	if request.WebhookURL != "" {
+		w.URL = request.WebhookURL
+	}
+	if request.Secret != "" {
+		w.Secret = request.Secret
+	}
+	if len(request.Events) > 0 {
+		w.Events = stringutils.StringList(request.Events)
+	}
+	w.UpdatedAt = time.Now().UTC().Unix()
+	if err := w.Validate(); err != nil {
+		return response, validationResponse(err)
+	}
+	if _, err := svc.webhookStore.Save(&w); err != nil {
+		return response, errors.Wrap(errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeDB,
+					Message: "couldn't update webhook",
+				},
+			},
+		}, err.Error())
+	}
+	response.Webhook = w
+	return response, nil
+}
+
+// List filters webhooks, user needs EditWebhooks permission to list webhooks of other users
+func (svc *service) List(ctx context.Context, request listRequest) (listResponse, error) {
+	response := listResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Username != u.Username && !u.Can(permission.EditWebhooks) {
+		return response, errs.ForbiddenError{"user doesn't have permission to list webhooks of other users"}
+	}
+	response.Webhooks, err = svc.webhookStore.List(&request.Criteria)
+	return response, err
+}
+
+// Delete deletes a webhook and its pending deliveries. Webhooks of other users can be deleted with EditWebhooks permission.
+func (svc *service) Delete(ctx context.Context, request deleteRequest) (deleteResponse, error) {
+	response := deleteResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if _, err := svc.get(u, request.ID); err != nil {
+		return response, err
+	}
+	err = svc.webhookStore.Delete(request.ID)
+	return response, err
+}
+
+// Log filters delivery attempts with their response codes, user needs EditWebhooks permission to see attempts of
+// other users
+func (svc *service) Log(ctx context.Context, request logRequest) (logResponse, error) {
+	response := logResponse{}
+	u, err := user.FromContext(ctx)
+	if err != nil {
+		return response, err
+	}
+	if request.Username != u.Username && !u.Can(permission.EditWebhooks) {
+		return response, errs.ForbiddenError{"user doesn't have permission to see webhook deliveries of other users"}
+	}
+	response.Attempts, err = svc.outboxStore.Attempts(&request.AttemptCriteria)
+	return response, err
+}
+
+// get returns webhook with id if it belongs to u or u has EditWebhooks permission
+func (svc *service) get(u *user.User, id int64) (webhook.Webhook, error) {
+	ws, err := svc.webhookStore.List(&webhook.Criteria{ID: id})
+	if err != nil || len(ws) == 0 {
+		resp := errs.ErrorResponse{
+			Errors: []errs.ResponseError{
+				{
+					Type:    errs.ErrorTypeForm,
+					Message: "Couldn't get webhook.",
+					Field:   "ID",
+				},
+			},
+		}
+		if err == nil {
+			err = webhook.ErrNotFound
+		}
+		return webhook.Webhook{}, errors.Wrap(resp, err.Error())
+	}
+	if ws[0].Username != u.Username && !u.Can(permission.EditWebhooks) {
+		return webhook.Webhook{}, errs.ForbiddenError{"user doesn't have permission to access webhooks of other users"}
+	}
+	return ws[0], nil
+}
+
+// validationResponse converts a validation error to form errors, URL of webhook is WebhookURL in requests
+func validationResponse(err error) errs.ErrorResponse {
+	resp := err.(*errs.ValidationError).FormErrors()
+	for i := range resp.Errors {
+		if resp.Errors[i].Field == "URL" {
+			resp.Errors[i].Field = "WebhookURL"
+		}
+	}
+	return resp
+}
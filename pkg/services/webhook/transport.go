@@ -0,0 +1,227 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+
+	"github.com/go-kit/kit/endpoint"
+	kithttp "github.com/go-kit/kit/transport/http"
+	"github.com/gorilla/mux"
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"github.com/haisum/smpp-app/pkg/errs"
+	"github.com/haisum/smpp-app/pkg/response"
+	"github.com/haisum/smpp-app/pkg/services/middleware"
+)
+
+// MakeHandler returns a http handler for the webhook service.
+func MakeHandler(svc Service, opts []kithttp.ServerOption, responseEncoder kithttp.EncodeResponseFunc) http.Handler {
+	authMid := middleware.AuthMiddleware(svc.(*service).authenticator, "", "")
+	addHandler := kithttp.NewServer(
+		authMid(makeAddEndpoint(svc)),
+		decodeAddRequest,
+		responseEncoder, opts...)
+	editHandler := kithttp.NewServer(
+		authMid(makeEditEndpoint(svc)),
+		decodeEditRequest,
+		responseEncoder, opts...)
+	listHandler := kithttp.NewServer(
+		authMid(makeListEndpoint(svc)),
+		decodeListRequest,
+		responseEncoder, opts...)
+	deleteHandler := kithttp.NewServer(
+		authMid(makeDeleteEndpoint(svc)),
+		decodeDeleteRequest,
+		responseEncoder, opts...)
+	logHandler := kithttp.NewServer(
+		authMid(makeLogEndpoint(svc)),
+		decodeLogRequest,
+		responseEncoder, opts...)
+	r := mux.NewRouter()
+	r.Handle("/webhook/v1/add", addHandler).Methods("POST")
+	r.Handle("/webhook/v1/edit", editHandler).Methods("POST")
+	r.Handle("/webhook/v1/list", listHandler).Methods("GET", "POST")
+	r.Handle("/webhook/v1/delete", deleteHandler).Methods("POST")
+	r.Handle("/webhook/v1/log", logHandler).Methods("GET", "POST")
+	return r
+}
+
+type addRequest struct {
+	URL string
+	// WebhookURL is url which is called, URL is url of request itself
+	WebhookURL string
+	Secret     string
+	Events     []string
+}
+
+type addResponse struct {
+	Webhook webhook.Webhook
+}
+
+func makeAddEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(addRequest)
+		v, err := svc.Add(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeAddRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request addRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type editRequest struct {
+	URL        string
+	ID         int64
+	WebhookURL string
+	Secret     string
+	Events     []string
+}
+
+type editResponse struct {
+	Webhook webhook.Webhook
+}
+
+func makeEditEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(editRequest)
+		v, err := svc.Edit(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeEditRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request editRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type listRequest struct {
+	webhook.Criteria
+	URL string
+}
+
+type listResponse struct {
+	Webhooks []webhook.Webhook
+}
+
+func makeListEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(listRequest)
+		v, err := svc.List(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeListRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request listRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type deleteRequest struct {
+	URL string
+	ID  int64
+}
+
+type deleteResponse struct {
+}
+
+func makeDeleteEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(deleteRequest)
+		v, err := svc.Delete(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeDeleteRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request deleteRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
+
+type logRequest struct {
+	webhook.AttemptCriteria
+	URL string
+}
+
+type logResponse struct {
+	Attempts []webhook.Attempt
+}
+
+func makeLogEndpoint(svc Service) endpoint.Endpoint {
+	return func(ctx context.Context, request interface{}) (interface{}, error) {
+		req := request.(logRequest)
+		v, err := svc.Log(ctx, req)
+		if err != nil {
+			if errResponse, ok := err.(errs.ErrorResponse); ok {
+				errResponse.Response.Request = req
+				return nil, errResponse
+			}
+			return nil, err
+		}
+		resp := response.Success{Obj: v}
+		resp.Request = req
+		return resp, nil
+	}
+}
+
+func decodeLogRequest(_ context.Context, r *http.Request) (interface{}, error) {
+	var request logRequest
+	request.URL = r.URL.RequestURI()
+	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+		return nil, err
+	}
+	return request, nil
+}
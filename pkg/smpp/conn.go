@@ -0,0 +1,49 @@
+// Package smpp implements SMPP v3.4 sessions on top of pdu package.
+// It has only as much of protocol as is required to submit messages to an SMSC and receive deliver_sm from it.
+package smpp
+
+import (
+	"bufio"
+	"net"
+	"sync"
+	"sync/atomic"
+
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+)
+
+// Conn wraps a net.Conn and reads/writes PDUs over it
+// Write is safe for concurrent use, Read must only be called from a single go routine
+type Conn struct {
+	net.Conn
+	r   *bufio.Reader
+	wmu sync.Mutex
+	seq uint32
+}
+
+// NewConn returns a new Conn for given net.Conn
+func NewConn(c net.Conn) *Conn {
+	return &Conn{
+		Conn: c,
+		r:    bufio.NewReader(c),
+	}
+}
+
+// Read reads next PDU from connection
+func (c *Conn) Read() (*pdu.PDU, error) {
+	return pdu.Decode(c.r)
+}
+
+// Write writes a PDU to connection. If p.Seq is zero, next sequence number is assigned to it.
+func (c *Conn) Write(p *pdu.PDU) error {
+	if p.Seq == 0 {
+		p.Seq = atomic.AddUint32(&c.seq, 1)
+	}
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+	_, err = c.Conn.Write(b)
+	return err
+}
@@ -0,0 +1,204 @@
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Name is name of a mandatory PDU parameter
+type Name string
+
+// Mandatory parameter names as given in SMPP specification
+const (
+	SystemID             Name = "system_id"
+	Password             Name = "password"
+	SystemType           Name = "system_type"
+	InterfaceVersion     Name = "interface_version"
+	AddrTON              Name = "addr_ton"
+	AddrNPI              Name = "addr_npi"
+	AddressRange         Name = "address_range"
+	ServiceType          Name = "service_type"
+	SourceAddrTON        Name = "source_addr_ton"
+	SourceAddrNPI        Name = "source_addr_npi"
+	SourceAddr           Name = "source_addr"
+	DestAddrTON          Name = "dest_addr_ton"
+	DestAddrNPI          Name = "dest_addr_npi"
+	DestinationAddr      Name = "destination_addr"
+	ESMClass             Name = "esm_class"
+	ProtocolID           Name = "protocol_id"
+	PriorityFlag         Name = "priority_flag"
+	ScheduleDeliveryTime Name = "schedule_delivery_time"
+	ValidityPeriod       Name = "validity_period"
+	RegisteredDelivery   Name = "registered_delivery"
+	ReplaceIfPresentFlag Name = "replace_if_present_flag"
+	DataCoding           Name = "data_coding"
+	SMDefaultMsgID       Name = "sm_default_msg_id"
+	ShortMessage         Name = "short_message"
+	MessageID            Name = "message_id"
+)
+
+// Fields holds mandatory parameters of a PDU.
+// C-Octet strings are stored as string, integers as uint8 and short_message as []byte
+type Fields map[Name]interface{}
+
+// String returns value of a C-Octet string field or empty string if field isn't set
+func (f Fields) String(name Name) string {
+	v, _ := f[name].(string)
+	return v
+}
+
+// Uint8 returns value of an integer field or zero if field isn't set
+func (f Fields) Uint8(name Name) uint8 {
+	v, _ := f[name].(uint8)
+	return v
+}
+
+// Bytes returns value of an octet string field or nil if field isn't set
+func (f Fields) Bytes(name Name) []byte {
+	v, _ := f[name].([]byte)
+	return v
+}
+
+type kind int
+
+const (
+	cString kind = iota
+	integer
+	// octets is an octet string preceded by its one octet length, such as sm_length and short_message
+	octets
+)
+
+type field struct {
+	name Name
+	kind kind
+}
+
+var (
+	bindLayout = []field{
+		{SystemID, cString},
+		{Password, cString},
+		{SystemType, cString},
+		{InterfaceVersion, integer},
+		{AddrTON, integer},
+		{AddrNPI, integer},
+		{AddressRange, cString},
+	}
+	smLayout = []field{
+		{ServiceType, cString},
+		{SourceAddrTON, integer},
+		{SourceAddrNPI, integer},
+		{SourceAddr, cString},
+		{DestAddrTON, integer},
+		{DestAddrNPI, integer},
+		{DestinationAddr, cString},
+		{ESMClass, integer},
+		{ProtocolID, integer},
+		{PriorityFlag, integer},
+		{ScheduleDeliveryTime, cString},
+		{ValidityPeriod, cString},
+		{RegisteredDelivery, integer},
+		{ReplaceIfPresentFlag, integer},
+		{DataCoding, integer},
+		{SMDefaultMsgID, integer},
+		{ShortMessage, octets},
+	}
+	layouts = map[ID][]field{
+		BindReceiverID:        bindLayout,
+		BindTransmitterID:     bindLayout,
+		BindTransceiverID:     bindLayout,
+		BindReceiverRespID:    {{SystemID, cString}},
+		BindTransmitterRespID: {{SystemID, cString}},
+		BindTransceiverRespID: {{SystemID, cString}},
+		SubmitSMID:            smLayout,
+		DeliverSMID:           smLayout,
+		SubmitSMRespID:        {{MessageID, cString}},
+		DeliverSMRespID:       {{MessageID, cString}},
+	}
+)
+
+func (f field) encode(w *bytes.Buffer, fields Fields) error {
+	switch f.kind {
+	case cString:
+		w.WriteString(fields.String(f.name))
+		w.WriteByte(0)
+	case integer:
+		w.WriteByte(fields.Uint8(f.name))
+	case octets:
+		b := fields.Bytes(f.name)
+		if len(b) > 254 {
+			return fmt.Errorf("%s can't be longer than 254 octets", f.name)
+		}
+		w.WriteByte(uint8(len(b)))
+		w.Write(b)
+	}
+	return nil
+}
+
+func (f field) decode(r *bytes.Buffer, fields Fields) error {
+	switch f.kind {
+	case cString:
+		b, err := r.ReadBytes(0)
+		if err != nil {
+			return fmt.Errorf("%s isn't null terminated", f.name)
+		}
+		fields[f.name] = string(b[:len(b)-1])
+	case integer:
+		b, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("%s is missing", f.name)
+		}
+		fields[f.name] = b
+	case octets:
+		l, err := r.ReadByte()
+		if err != nil {
+			return fmt.Errorf("length of %s is missing", f.name)
+		}
+		b := make([]byte, l)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return fmt.Errorf("%s is shorter than its length", f.name)
+		}
+		fields[f.name] = b
+	}
+	return nil
+}
+
+// Tag is tag of an optional (TLV) parameter
+type Tag uint16
+
+// Optional parameter tags
+const (
+	ReceiptedMessageID Tag = 0x001E
+	MessageState       Tag = 0x0427
+	MessagePayload     Tag = 0x0424
+	SARMsgRefNum       Tag = 0x020C
+	SARTotalSegments   Tag = 0x020E
+	SARSegmentSeqnum   Tag = 0x020F
+)
+
+// TLVs holds optional parameters of a PDU
+type TLVs map[Tag][]byte
+
+func (t TLVs) encode(w *bytes.Buffer) {
+	for tag, v := range t {
+		binary.Write(w, binary.BigEndian, uint16(tag))
+		binary.Write(w, binary.BigEndian, uint16(len(v)))
+		w.Write(v)
+	}
+}
+
+func (t TLVs) decode(r *bytes.Buffer) error {
+	for r.Len() > 0 {
+		if r.Len() < 4 {
+			return fmt.Errorf("truncated tlv header")
+		}
+		tag := Tag(binary.BigEndian.Uint16(r.Next(2)))
+		l := int(binary.BigEndian.Uint16(r.Next(2)))
+		if r.Len() < l {
+			return fmt.Errorf("tlv 0x%04x is shorter than its length", uint16(tag))
+		}
+		t[tag] = append([]byte(nil), r.Next(l)...)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+// Package pdu implements encoding and decoding of SMPP v3.4 protocol data units.
+// Only PDUs needed for sending messages and receiving delivery receipts are supported.
+package pdu
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+
+	"github.com/pkg/errors"
+)
+
+// ID is command_id of a PDU
+type ID uint32
+
+// Supported command ids
+const (
+	GenericNACKID         ID = 0x80000000
+	BindReceiverID        ID = 0x00000001
+	BindReceiverRespID    ID = 0x80000001
+	BindTransmitterID     ID = 0x00000002
+	BindTransmitterRespID ID = 0x80000002
+	SubmitSMID            ID = 0x00000004
+	SubmitSMRespID        ID = 0x80000004
+	DeliverSMID           ID = 0x00000005
+	DeliverSMRespID       ID = 0x80000005
+	UnbindID              ID = 0x00000006
+	UnbindRespID          ID = 0x80000006
+	BindTransceiverID     ID = 0x00000009
+	BindTransceiverRespID ID = 0x80000009
+	EnquireLinkID         ID = 0x00000015
+	EnquireLinkRespID     ID = 0x80000015
+)
+
+var idNames = map[ID]string{
+	GenericNACKID:         "generic_nack",
+	BindReceiverID:        "bind_receiver",
+	BindReceiverRespID:    "bind_receiver_resp",
+	BindTransmitterID:     "bind_transmitter",
+	BindTransmitterRespID: "bind_transmitter_resp",
+	SubmitSMID:            "submit_sm",
+	SubmitSMRespID:        "submit_sm_resp",
+	DeliverSMID:           "deliver_sm",
+	DeliverSMRespID:       "deliver_sm_resp",
+	UnbindID:              "unbind",
+	UnbindRespID:          "unbind_resp",
+	BindTransceiverID:     "bind_transceiver",
+	BindTransceiverRespID: "bind_transceiver_resp",
+	EnquireLinkID:         "enquire_link",
+	EnquireLinkRespID:     "enquire_link_resp",
+}
+
+// String returns name of command as given in SMPP specification
+func (id ID) String() string {
+	if name, ok := idNames[id]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08x", uint32(id))
+}
+
+// IsResp returns true if id is a response command id
+func (id ID) IsResp() bool {
+	return id&0x80000000 != 0
+}
+
+// Resp returns response command id for a request command id
+func (id ID) Resp() ID {
+	return id | 0x80000000
+}
+
+// Status is command_status of a PDU
+type Status uint32
+
+// Common command statuses
+const (
+	StatusOK             Status = 0x00000000
+	StatusInvMsgLen      Status = 0x00000001
+	StatusInvCmdLen      Status = 0x00000002
+	StatusInvCmdID       Status = 0x00000003
+	StatusInvBnd         Status = 0x00000004
+	StatusAlyBnd         Status = 0x00000005
+	StatusSysErr         Status = 0x00000008
+	StatusInvSrcAdr      Status = 0x0000000A
+	StatusInvDstAdr      Status = 0x0000000B
+	StatusBindFail       Status = 0x0000000D
+	StatusInvPaswd       Status = 0x0000000E
+	StatusInvSysID       Status = 0x0000000F
+	StatusMsgQFul        Status = 0x00000014
+	StatusSubmitFail     Status = 0x00000045
+	StatusThrottled      Status = 0x00000058
+	StatusInvDCS         Status = 0x00000104
+	StatusDeliveryFailed Status = 0x000000FE
+)
+
+var statusNames = map[Status]string{
+	StatusOK:             "ESME_ROK",
+	StatusInvMsgLen:      "ESME_RINVMSGLEN",
+	StatusInvCmdLen:      "ESME_RINVCMDLEN",
+	StatusInvCmdID:       "ESME_RINVCMDID",
+	StatusInvBnd:         "ESME_RINVBNDSTS",
+	StatusAlyBnd:         "ESME_RALYBND",
+	StatusSysErr:         "ESME_RSYSERR",
+	StatusInvSrcAdr:      "ESME_RINVSRCADR",
+	StatusInvDstAdr:      "ESME_RINVDSTADR",
+	StatusBindFail:       "ESME_RBINDFAIL",
+	StatusInvPaswd:       "ESME_RINVPASWD",
+	StatusInvSysID:       "ESME_RINVSYSID",
+	StatusMsgQFul:        "ESME_RMSGQFUL",
+	StatusSubmitFail:     "ESME_RSUBMITFAIL",
+	StatusThrottled:      "ESME_RTHROTTLED",
+	StatusInvDCS:         "ESME_RINVDCS",
+	StatusDeliveryFailed: "ESME_RDELIVERYFAILURE",
+}
+
+// Error implements error interface. It returns name of status as given in SMPP specification
+func (s Status) Error() string {
+	if name, ok := statusNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("0x%08x", uint32(s))
+}
+
+const (
+	// HeaderLen is length of PDU header in octets
+	HeaderLen = 16
+	// MaxLen is maximum length of a PDU we are willing to read
+	MaxLen = 64 * 1024
+)
+
+// Header is first 16 octets of every PDU
+type Header struct {
+	Len    uint32
+	ID     ID
+	Status Status
+	Seq    uint32
+}
+
+// PDU is a single SMPP protocol data unit.
+// Mandatory parameters are stored in Fields by their names, optional parameters are stored in TLVs.
+type PDU struct {
+	Header
+	Fields Fields
+	TLVs   TLVs
+}
+
+// New returns a new PDU with given command id and empty fields
+func New(id ID) *PDU {
+	return &PDU{
+		Header: Header{ID: id},
+		Fields: Fields{},
+		TLVs:   TLVs{},
+	}
+}
+
+// NewResp returns a response PDU for p with given status
+func NewResp(p *PDU, status Status) *PDU {
+	resp := New(p.ID.Resp())
+	resp.Seq = p.Seq
+	resp.Status = status
+	return resp
+}
+
+// MarshalBinary encodes PDU in SMPP wire format
+func (p *PDU) MarshalBinary() ([]byte, error) {
+	var body bytes.Buffer
+	// bodies of response PDUs with error status may be empty
+	if p.Status == StatusOK || !p.ID.IsResp() {
+		for _, f := range layouts[p.ID] {
+			if err := f.encode(&body, p.Fields); err != nil {
+				return nil, errors.Wrapf(err, "couldn't encode %s", p.ID)
+			}
+		}
+		p.TLVs.encode(&body)
+	}
+	p.Len = uint32(HeaderLen + body.Len())
+	b := make([]byte, HeaderLen, p.Len)
+	binary.BigEndian.PutUint32(b[0:], p.Len)
+	binary.BigEndian.PutUint32(b[4:], uint32(p.ID))
+	binary.BigEndian.PutUint32(b[8:], uint32(p.Status))
+	binary.BigEndian.PutUint32(b[12:], p.Seq)
+	return append(b, body.Bytes()...), nil
+}
+
+// Encode writes PDU to w in SMPP wire format
+func Encode(w io.Writer, p *PDU) error {
+	b, err := p.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// Decode reads a single PDU from r
+func Decode(r io.Reader) (*PDU, error) {
+	hb := make([]byte, HeaderLen)
+	if _, err := io.ReadFull(r, hb); err != nil {
+		return nil, err
+	}
+	p := New(ID(binary.BigEndian.Uint32(hb[4:])))
+	p.Len = binary.BigEndian.Uint32(hb[0:])
+	p.Status = Status(binary.BigEndian.Uint32(hb[8:]))
+	p.Seq = binary.BigEndian.Uint32(hb[12:])
+	if p.Len < HeaderLen || p.Len > MaxLen {
+		return nil, fmt.Errorf("invalid pdu length %d", p.Len)
+	}
+	body := make([]byte, p.Len-HeaderLen)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return nil, err
+	}
+	buf := bytes.NewBuffer(body)
+	for _, f := range layouts[p.ID] {
+		// bodies of response PDUs with error status may be truncated
+		if buf.Len() == 0 {
+			break
+		}
+		if err := f.decode(buf, p.Fields); err != nil {
+			return nil, errors.Wrapf(err, "couldn't decode %s", p.ID)
+		}
+	}
+	if err := p.TLVs.decode(buf); err != nil {
+		return nil, errors.Wrapf(err, "couldn't decode %s", p.ID)
+	}
+	return p, nil
+}
@@ -0,0 +1,51 @@
+package pdu
+
+import (
+	"bytes"
+	"testing"
+
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	assert := assert.New(t)
+	p := New(SubmitSMID)
+	p.Seq = 7
+	p.Fields[SourceAddr] = "Sender"
+	p.Fields[DestinationAddr] = "971501234567"
+	p.Fields[DataCoding] = uint8(0x08)
+	p.Fields[ShortMessage] = []byte("hello")
+	p.TLVs[MessagePayload] = []byte("world")
+	var buf bytes.Buffer
+	assert.Nil(Encode(&buf, p))
+	assert.Equal(int(p.Len), buf.Len())
+	d, err := Decode(&buf)
+	assert.Nil(err)
+	assert.Equal(SubmitSMID, d.ID)
+	assert.Equal(uint32(7), d.Seq)
+	assert.Equal("Sender", d.Fields.String(SourceAddr))
+	assert.Equal("971501234567", d.Fields.String(DestinationAddr))
+	assert.Equal(uint8(0x08), d.Fields.Uint8(DataCoding))
+	assert.Equal([]byte("hello"), d.Fields.Bytes(ShortMessage))
+	assert.Equal([]byte("world"), d.TLVs[MessagePayload])
+}
+
+func TestDecodeErrorResp(t *testing.T) {
+	assert := assert.New(t)
+	p := NewResp(&PDU{Header: Header{ID: SubmitSMID, Seq: 3}}, StatusThrottled)
+	b, err := p.MarshalBinary()
+	assert.Nil(err)
+	assert.Len(b, HeaderLen)
+	d, err := Decode(bytes.NewReader(b))
+	assert.Nil(err)
+	assert.Equal(SubmitSMRespID, d.ID)
+	assert.Equal(StatusThrottled, d.Status)
+	assert.Equal("ESME_RTHROTTLED", d.Status.Error())
+	assert.Equal("", d.Fields.String(MessageID))
+}
+
+func TestDecodeInvalidLen(t *testing.T) {
+	b := []byte{0, 0, 0, 4, 0, 0, 0, 4, 0, 0, 0, 0, 0, 0, 0, 1}
+	_, err := Decode(bytes.NewReader(b))
+	assert.NotNil(t, err)
+}
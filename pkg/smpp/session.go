@@ -0,0 +1,220 @@
+package smpp
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultRespTimeout is time we wait for a response before giving up on a request
+	DefaultRespTimeout = 10 * time.Second
+	// DefaultEnquireLink is interval between enquire_link requests
+	DefaultEnquireLink = 30 * time.Second
+	interfaceVersion   = 0x34
+)
+
+var (
+	// ErrClosed is returned when a request is made on a closed session
+	ErrClosed = errors.New("smpp session is closed")
+	// ErrTimeout is returned when response to a request isn't received in time
+	ErrTimeout = errors.New("timeout waiting for response")
+)
+
+// HandlerFunc is called for each deliver_sm received in a session. Returned status is sent in deliver_sm_resp.
+type HandlerFunc func(p *pdu.PDU) pdu.Status
+
+// BindOpts are options for binding a session with SMSC
+type BindOpts struct {
+	Addr     string
+	SystemID string
+	Password string
+	// BindType must be one of pdu.BindTransmitterID, pdu.BindReceiverID or pdu.BindTransceiverID
+	BindType pdu.ID
+	// Handler is called for every deliver_sm in a receiver or transceiver session
+	Handler     HandlerFunc
+	RespTimeout time.Duration
+	EnquireLink time.Duration
+}
+
+// Session is a bound SMPP session with an SMSC
+type Session struct {
+	conn        *Conn
+	handler     HandlerFunc
+	respTimeout time.Duration
+
+	mu      sync.Mutex
+	pending map[uint32]chan *pdu.PDU
+	closed  bool
+
+	done chan struct{}
+	err  error
+}
+
+// Bind dials addr and binds a session with it
+func Bind(ctx context.Context, opts BindOpts) (*Session, error) {
+	if opts.RespTimeout == 0 {
+		opts.RespTimeout = DefaultRespTimeout
+	}
+	if opts.EnquireLink == 0 {
+		opts.EnquireLink = DefaultEnquireLink
+	}
+	var d net.Dialer
+	nc, err := d.DialContext(ctx, "tcp", opts.Addr)
+	if err != nil {
+		return nil, errors.Wrap(err, "couldn't dial smsc")
+	}
+	s := &Session{
+		conn:        NewConn(nc),
+		handler:     opts.Handler,
+		respTimeout: opts.RespTimeout,
+		pending:     make(map[uint32]chan *pdu.PDU),
+		done:        make(chan struct{}),
+	}
+	go s.readLoop()
+	bind := pdu.New(opts.BindType)
+	bind.Fields[pdu.SystemID] = opts.SystemID
+	bind.Fields[pdu.Password] = opts.Password
+	bind.Fields[pdu.InterfaceVersion] = uint8(interfaceVersion)
+	if _, err = s.request(bind); err != nil {
+		s.conn.Close()
+		return nil, errors.Wrap(err, "couldn't bind")
+	}
+	go s.enquireLink(opts.EnquireLink)
+	return s, nil
+}
+
+// Submit sends a submit_sm PDU and returns message id given by SMSC
+func (s *Session) Submit(p *pdu.PDU) (string, error) {
+	resp, err := s.request(p)
+	if err != nil {
+		return "", err
+	}
+	return resp.Fields.String(pdu.MessageID), nil
+}
+
+// Done returns a channel which is closed when session ends
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns error due to which session ended
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+// Close unbinds session and closes underlying connection
+func (s *Session) Close() error {
+	s.request(pdu.New(pdu.UnbindID))
+	return s.conn.Close()
+}
+
+// request writes p to connection and waits for its response.
+// Response with non OK status is returned as pdu.Status error.
+func (s *Session) request(p *pdu.PDU) (*pdu.PDU, error) {
+	ch := make(chan *pdu.PDU, 1)
+	p.Seq = 0
+	// sequence number is assigned in Write, so we register it under the same lock
+	// to make sure response can't arrive before we are waiting for it
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return nil, ErrClosed
+	}
+	err := s.conn.Write(p)
+	if err == nil {
+		s.pending[p.Seq] = ch
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, p.Seq)
+		s.mu.Unlock()
+	}()
+	select {
+	case resp := <-ch:
+		if resp.ID == pdu.GenericNACKID {
+			return resp, errors.Wrapf(resp.Status, "%s rejected with generic_nack", p.ID)
+		}
+		if resp.Status != pdu.StatusOK {
+			return resp, resp.Status
+		}
+		return resp, nil
+	case <-s.done:
+		return nil, ErrClosed
+	case <-time.After(s.respTimeout):
+		return nil, errors.Wrap(ErrTimeout, p.ID.String())
+	}
+}
+
+func (s *Session) readLoop() {
+	var err error
+	defer func() {
+		s.mu.Lock()
+		s.closed = true
+		s.err = err
+		s.mu.Unlock()
+		s.conn.Close()
+		close(s.done)
+	}()
+	for {
+		var p *pdu.PDU
+		p, err = s.conn.Read()
+		if err != nil {
+			return
+		}
+		if p.ID.IsResp() {
+			s.mu.Lock()
+			ch, ok := s.pending[p.Seq]
+			s.mu.Unlock()
+			if ok {
+				ch <- p
+			}
+			continue
+		}
+		switch p.ID {
+		case pdu.DeliverSMID:
+			status := pdu.StatusOK
+			if s.handler != nil {
+				status = s.handler(p)
+			}
+			s.conn.Write(pdu.NewResp(p, status))
+		case pdu.EnquireLinkID:
+			s.conn.Write(pdu.NewResp(p, pdu.StatusOK))
+		case pdu.UnbindID:
+			s.conn.Write(pdu.NewResp(p, pdu.StatusOK))
+			err = ErrClosed
+			return
+		default:
+			nack := pdu.New(pdu.GenericNACKID)
+			nack.Seq = p.Seq
+			nack.Status = pdu.StatusInvCmdID
+			s.conn.Write(nack)
+		}
+	}
+}
+
+func (s *Session) enquireLink(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			if _, err := s.request(pdu.New(pdu.EnquireLinkID)); err != nil {
+				s.conn.Close()
+				return
+			}
+		case <-s.done:
+			return
+		}
+	}
+}
@@ -0,0 +1,252 @@
+// Package fake implements an in process SMSC for integration tests and demos.
+// It accepts binds, answers submit_sm with generated message ids or configured errors and sends
+// delivery receipts back on receiver or transceiver sessions. Every PDU it receives is recorded.
+package fake
+
+import (
+	"fmt"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/haisum/smpp-app/pkg/smpp"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+)
+
+const (
+	// receiptTimeFormat is format of submit date and done date in delivery receipts
+	receiptTimeFormat = "0601021504"
+	// esmClassReceipt is esm_class value of a deliver_sm which carries a delivery receipt
+	esmClassReceipt = 0x04
+)
+
+// Server is a fake SMSC. Exported fields must be set before calling Start.
+type Server struct {
+	// Users maps system_id to password. If nil, every bind is accepted.
+	Users map[string]string
+	// IDFunc generates message ids for accepted submit_sm. Default generates sequential numbers.
+	IDFunc func() string
+	// ErrorRate is fraction, between 0 and 1, of submit_sm which are answered with ErrorStatus
+	ErrorRate float64
+	// ErrorStatus is command_status for failed submit_sm. Default is pdu.StatusSubmitFail.
+	ErrorStatus pdu.Status
+	// DeliveryDelay is time after which delivery receipt of an accepted message is sent
+	DeliveryDelay time.Duration
+	// DeliveryStat is stat reported in delivery receipts. Default is DELIVRD.
+	DeliveryStat string
+	// DisableReceipts stops server from sending delivery receipts
+	DisableReceipts bool
+	Log             logger.Logger
+
+	l        net.Listener
+	lastID   uint64
+	mu       sync.Mutex
+	received []*pdu.PDU
+	conns    map[*smpp.Conn]session
+	wg       sync.WaitGroup
+}
+
+type session struct {
+	systemID string
+	bindType pdu.ID
+}
+
+// New returns a fake SMSC with default settings
+func New() *Server {
+	return &Server{
+		ErrorStatus:  pdu.StatusSubmitFail,
+		DeliveryStat: "DELIVRD",
+		Log:          logger.Get(),
+	}
+}
+
+// Start listens on addr and starts serving connections in background.
+// Use "127.0.0.1:0" to listen on a random port and Addr to find it.
+func (s *Server) Start(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	if s.IDFunc == nil {
+		s.IDFunc = func() string {
+			return strconv.FormatUint(atomic.AddUint64(&s.lastID, 1), 10)
+		}
+	}
+	s.l = l
+	s.conns = make(map[*smpp.Conn]session)
+	s.wg.Add(1)
+	go s.serve()
+	return nil
+}
+
+// Addr returns address server is listening on
+func (s *Server) Addr() string {
+	return s.l.Addr().String()
+}
+
+// Close stops listening and closes all connections
+func (s *Server) Close() error {
+	err := s.l.Close()
+	s.mu.Lock()
+	for c := range s.conns {
+		c.Close()
+	}
+	s.mu.Unlock()
+	s.wg.Wait()
+	return err
+}
+
+// Received returns all PDUs received so far
+func (s *Server) Received() []*pdu.PDU {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]*pdu.PDU(nil), s.received...)
+}
+
+// Submitted returns all submit_sm PDUs received so far
+func (s *Server) Submitted() []*pdu.PDU {
+	var sms []*pdu.PDU
+	for _, p := range s.Received() {
+		if p.ID == pdu.SubmitSMID {
+			sms = append(sms, p)
+		}
+	}
+	return sms
+}
+
+func (s *Server) serve() {
+	defer s.wg.Done()
+	for {
+		nc, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		c := smpp.NewConn(nc)
+		s.mu.Lock()
+		s.conns[c] = session{}
+		s.mu.Unlock()
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.handle(c)
+		}()
+	}
+}
+
+func (s *Server) handle(c *smpp.Conn) {
+	defer func() {
+		s.mu.Lock()
+		delete(s.conns, c)
+		s.mu.Unlock()
+		c.Close()
+	}()
+	for {
+		p, err := c.Read()
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.received = append(s.received, p)
+		sess := s.conns[c]
+		s.mu.Unlock()
+		switch p.ID {
+		case pdu.BindTransmitterID, pdu.BindReceiverID, pdu.BindTransceiverID:
+			resp := pdu.NewResp(p, s.authenticate(p))
+			resp.Fields[pdu.SystemID] = "fakesmsc"
+			c.Write(resp)
+			if resp.Status != pdu.StatusOK {
+				return
+			}
+			s.mu.Lock()
+			s.conns[c] = session{systemID: p.Fields.String(pdu.SystemID), bindType: p.ID}
+			s.mu.Unlock()
+		case pdu.SubmitSMID:
+			if sess.bindType != pdu.BindTransmitterID && sess.bindType != pdu.BindTransceiverID {
+				c.Write(pdu.NewResp(p, pdu.StatusInvBnd))
+				continue
+			}
+			s.submit(c, sess, p)
+		case pdu.EnquireLinkID:
+			c.Write(pdu.NewResp(p, pdu.StatusOK))
+		case pdu.UnbindID:
+			c.Write(pdu.NewResp(p, pdu.StatusOK))
+			return
+		default:
+			// responses such as deliver_sm_resp are only recorded
+			if !p.ID.IsResp() {
+				nack := pdu.New(pdu.GenericNACKID)
+				nack.Seq = p.Seq
+				nack.Status = pdu.StatusInvCmdID
+				c.Write(nack)
+			}
+		}
+	}
+}
+
+func (s *Server) authenticate(p *pdu.PDU) pdu.Status {
+	if s.Users == nil {
+		return pdu.StatusOK
+	}
+	passwd, ok := s.Users[p.Fields.String(pdu.SystemID)]
+	if !ok {
+		return pdu.StatusInvSysID
+	}
+	if passwd != p.Fields.String(pdu.Password) {
+		return pdu.StatusInvPaswd
+	}
+	return pdu.StatusOK
+}
+
+func (s *Server) submit(c *smpp.Conn, sess session, p *pdu.PDU) {
+	if s.ErrorRate > 0 && rand.Float64() < s.ErrorRate {
+		c.Write(pdu.NewResp(p, s.ErrorStatus))
+		return
+	}
+	id := s.IDFunc()
+	resp := pdu.NewResp(p, pdu.StatusOK)
+	resp.Fields[pdu.MessageID] = id
+	if err := c.Write(resp); err != nil {
+		return
+	}
+	if s.DisableReceipts || p.Fields.Uint8(pdu.RegisteredDelivery)&0x01 == 0 {
+		return
+	}
+	submitted := time.Now()
+	time.AfterFunc(s.DeliveryDelay, func() {
+		s.sendReceipt(sess.systemID, id, p, submitted)
+	})
+}
+
+// sendReceipt sends a delivery receipt on a receiver or transceiver session bound by systemID
+func (s *Server) sendReceipt(systemID, id string, sm *pdu.PDU, submitted time.Time) {
+	var rc *smpp.Conn
+	s.mu.Lock()
+	for c, sess := range s.conns {
+		if sess.systemID == systemID && (sess.bindType == pdu.BindReceiverID || sess.bindType == pdu.BindTransceiverID) {
+			rc = c
+			break
+		}
+	}
+	s.mu.Unlock()
+	if rc == nil {
+		s.Log.Error("msg", "no receiver session to send delivery receipt", "systemID", systemID, "id", id)
+		return
+	}
+	errCode := "000"
+	if s.DeliveryStat != "DELIVRD" {
+		errCode = "001"
+	}
+	text := fmt.Sprintf("id:%s sub:001 dlvrd:001 submit date:%s done date:%s stat:%s err:%s text:",
+		id, submitted.Format(receiptTimeFormat), time.Now().Format(receiptTimeFormat), s.DeliveryStat, errCode)
+	p := pdu.New(pdu.DeliverSMID)
+	p.Fields[pdu.SourceAddr] = sm.Fields.String(pdu.DestinationAddr)
+	p.Fields[pdu.DestinationAddr] = sm.Fields.String(pdu.SourceAddr)
+	p.Fields[pdu.ESMClass] = uint8(esmClassReceipt)
+	p.Fields[pdu.ShortMessage] = []byte(text)
+	p.TLVs[pdu.ReceiptedMessageID] = append([]byte(id), 0)
+	rc.Write(p)
+}
@@ -0,0 +1,81 @@
+package fake
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/smpp"
+	"github.com/haisum/smpp-app/pkg/smpp/pdu"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+func TestServer_SubmitAndReceipt(t *testing.T) {
+	assert := assert.New(t)
+	s := New()
+	s.Users = map[string]string{"user": "pass"}
+	s.IDFunc = func() string { return "abc" }
+	assert.Nil(s.Start("127.0.0.1:0"))
+	defer s.Close()
+
+	receipts := make(chan *pdu.PDU, 1)
+	sess, err := smpp.Bind(context.Background(), smpp.BindOpts{
+		Addr:     s.Addr(),
+		SystemID: "user",
+		Password: "pass",
+		BindType: pdu.BindTransceiverID,
+		Handler: func(p *pdu.PDU) pdu.Status {
+			receipts <- p
+			return pdu.StatusOK
+		},
+	})
+	assert.Nil(err)
+	defer sess.Close()
+	sm := pdu.New(pdu.SubmitSMID)
+	sm.Fields[pdu.DestinationAddr] = "971501234567"
+	sm.Fields[pdu.RegisteredDelivery] = uint8(1)
+	sm.Fields[pdu.ShortMessage] = []byte("hello")
+	id, err := sess.Submit(sm)
+	assert.Nil(err)
+	assert.Equal("abc", id)
+	select {
+	case r := <-receipts:
+		assert.Contains(string(r.Fields.Bytes(pdu.ShortMessage)), "id:abc ")
+		assert.Contains(string(r.Fields.Bytes(pdu.ShortMessage)), "stat:DELIVRD")
+	case <-time.After(time.Second * 2):
+		t.Error("receipt not received")
+	}
+	assert.Len(s.Submitted(), 1)
+	assert.Equal([]byte("hello"), s.Submitted()[0].Fields.Bytes(pdu.ShortMessage))
+}
+
+func TestServer_BindFail(t *testing.T) {
+	s := New()
+	s.Users = map[string]string{"user": "pass"}
+	assert.Nil(t, s.Start("127.0.0.1:0"))
+	defer s.Close()
+	_, err := smpp.Bind(context.Background(), smpp.BindOpts{
+		Addr:     s.Addr(),
+		SystemID: "user",
+		Password: "wrong",
+		BindType: pdu.BindTransmitterID,
+	})
+	assert.NotNil(t, err)
+}
+
+func TestServer_ErrorRate(t *testing.T) {
+	assert := assert.New(t)
+	s := New()
+	s.ErrorRate = 1
+	s.ErrorStatus = pdu.StatusThrottled
+	assert.Nil(s.Start("127.0.0.1:0"))
+	defer s.Close()
+	sess, err := smpp.Bind(context.Background(), smpp.BindOpts{
+		Addr:     s.Addr(),
+		BindType: pdu.BindTransmitterID,
+	})
+	assert.Nil(err)
+	defer sess.Close()
+	_, err = sess.Submit(pdu.New(pdu.SubmitSMID))
+	assert.Equal(pdu.StatusThrottled, err)
+}
@@ -1,6 +1,7 @@
 package stringutils
 
 import (
+	"database/sql/driver"
 	"fmt"
 	"strings"
 )
@@ -12,11 +13,18 @@ type StringList []string
 func (s *StringList) Scan(vals interface{}) error {
 	sl := strings.Split(fmt.Sprintf("%s", vals), ",")
 	for _, v := range sl {
-		*s = append(*s, v)
+		if v = strings.TrimSpace(v); v != "" {
+			*s = append(*s, v)
+		}
 	}
 	return nil
 }
 
+// Value implements driver.Valuer interface
+func (s StringList) Value() (driver.Value, error) {
+	return strings.Join(s, ","), nil
+}
+
 // String implements String interface
 func (s *StringList) String() string {
 	var vals []string
@@ -0,0 +1,356 @@
+// Package webhook posts events of messages to webhooks of their users.
+// Notifier writes a delivery for every subscribed webhook in a persisted outbox, so events aren't lost if a webhook
+// is down or process restarts. Sender posts due deliveries with an HMAC-SHA256 signature of body in SignatureHeader
+// and retries failed ones with exponential back off until MaxAttempts. Every attempt is logged with
+// response code of webhook. Deliveries are claimed before they're posted, so any number of senders can run at once.
+// Sender refuses to connect to loopback, link local and private addresses, so webhooks can't reach internal services
+// even if their host resolves to one, or redirects to one.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"github.com/pkg/errors"
+)
+
+const (
+	// DefaultCacheTTL is time for which webhooks are cached by Notifier
+	DefaultCacheTTL = 30 * time.Second
+	// DefaultInterval is time to wait between polls when there are no due deliveries
+	DefaultInterval = 5 * time.Second
+	// DefaultBatchSize is maximum number of deliveries posted in a poll
+	DefaultBatchSize = 100
+	// DefaultTimeout is time after which a webhook request is cancelled
+	DefaultTimeout = 10 * time.Second
+	// DefaultMaxAttempts is number of attempts after which a delivery is Failed
+	DefaultMaxAttempts = 10
+	// DefaultBackoff is delay before second attempt, it doubles after every failed attempt
+	DefaultBackoff = 30 * time.Second
+	// DefaultMaxBackoff is maximum delay between two attempts
+	DefaultMaxBackoff = 6 * time.Hour
+
+	// SignatureHeader has hex encoded HMAC-SHA256 of request body with secret of webhook as key, prefixed by sha256=
+	SignatureHeader = "X-Webhook-Signature"
+	// EventHeader has event of payload
+	EventHeader = "X-Webhook-Event"
+	// DeliveryHeader has id of delivery, it's same for every attempt so receivers can ignore duplicates
+	DeliveryHeader = "X-Webhook-Delivery"
+
+	// maxErrorLen is maximum length of error saved in an attempt
+	maxErrorLen = 255
+)
+
+// ErrForbiddenAddress is returned when a webhook connects to an address which isn't public
+var ErrForbiddenAddress = errors.New("address is loopback, link local or private")
+
+// Sign returns value of SignatureHeader for body signed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Notifier queues payloads in outbox for subscribed webhooks. Webhooks are read from store at most once every CacheTTL.
+type Notifier struct {
+	webhookStore webhook.Store
+	outboxStore  webhook.OutboxStore
+	log          logger.Logger
+	CacheTTL     time.Duration
+
+	mu       sync.Mutex
+	webhooks map[string][]webhook.Webhook
+	loadedAt time.Time
+}
+
+// NewNotifier returns a new notifier for webhooks in webhookStore
+func NewNotifier(webhookStore webhook.Store, outboxStore webhook.OutboxStore, log logger.Logger) *Notifier {
+	return &Notifier{
+		webhookStore: webhookStore,
+		outboxStore:  outboxStore,
+		log:          log,
+		CacheTTL:     DefaultCacheTTL,
+	}
+}
+
+// Notify adds a delivery of p to outbox for every webhook of username subscribed to p.Event.
+// Errors are logged, they don't stop caller from updating message.
+func (n *Notifier) Notify(username string, p webhook.Payload) {
+	if username == "" {
+		return
+	}
+	if p.Time == 0 {
+		p.Time = time.Now().UTC().Unix()
+	}
+	ws := n.subscribed(username, p.Event)
+	if len(ws) == 0 {
+		return
+	}
+	body, err := json.Marshal(p)
+	if err != nil {
+		n.log.Error("error", err, "msg", "couldn't encode webhook payload", "event", p.Event)
+		return
+	}
+	ds := make([]webhook.Delivery, len(ws))
+	for i, w := range ws {
+		ds[i] = webhook.Delivery{
+			WebhookID:     w.ID,
+			Username:      username,
+			Event:         p.Event,
+			Payload:       string(body),
+			Status:        webhook.DeliveryPending,
+			NextAttemptAt: p.Time,
+			CreatedAt:     p.Time,
+		}
+	}
+	if err := n.outboxStore.Add(ds); err != nil {
+		n.log.Error("error", err, "msg", "couldn't queue webhook deliveries", "event", p.Event, "username", username)
+	}
+}
+
+// subscribed returns webhooks of username which are subscribed to e
+func (n *Notifier) subscribed(username string, e webhook.Event) []webhook.Webhook {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	if n.webhooks == nil || time.Since(n.loadedAt) > n.CacheTTL {
+		if err := n.load(); err != nil {
+			n.log.Error("error", err, "msg", "couldn't load webhooks")
+		}
+	}
+	var ws []webhook.Webhook
+	for _, w := range n.webhooks[username] {
+		if w.Subscribed(e) {
+			ws = append(ws, w)
+		}
+	}
+	return ws
+}
+
+// load reads all webhooks from store, page by page
+func (n *Notifier) load() error {
+	webhooks := make(map[string][]webhook.Webhook)
+	c := webhook.Criteria{OrderByKey: "ID", OrderByDir: "ASC", PerPage: 1000}
+	for {
+		ws, err := n.webhookStore.List(&c)
+		if err != nil {
+			return err
+		}
+		for _, w := range ws {
+			webhooks[w.Username] = append(webhooks[w.Username], w)
+		}
+		if len(ws) < int(c.PerPage) {
+			break
+		}
+		c.From = strconv.FormatInt(ws[len(ws)-1].ID, 10)
+	}
+	n.webhooks = webhooks
+	n.loadedAt = time.Now()
+	return nil
+}
+
+// Sender posts due deliveries in outbox to their webhooks
+type Sender struct {
+	webhookStore webhook.Store
+	outboxStore  webhook.OutboxStore
+	client       *http.Client
+	log          logger.Logger
+	Interval     time.Duration
+	BatchSize    uint
+	MaxAttempts  int
+	Backoff      time.Duration
+	MaxBackoff   time.Duration
+}
+
+// NewSender returns a new sender for deliveries in outboxStore
+func NewSender(webhookStore webhook.Store, outboxStore webhook.OutboxStore, log logger.Logger) *Sender {
+	return &Sender{
+		webhookStore: webhookStore,
+		outboxStore:  outboxStore,
+		client:       newClient(),
+		log:          log,
+		Interval:     DefaultInterval,
+		BatchSize:    DefaultBatchSize,
+		MaxAttempts:  DefaultMaxAttempts,
+		Backoff:      DefaultBackoff,
+		MaxBackoff:   DefaultMaxBackoff,
+	}
+}
+
+// Run posts due deliveries until ctx is done
+func (s *Sender) Run(ctx context.Context) {
+	for {
+		n := s.send(ctx)
+		// a full batch means there may be more due deliveries, keep going without waiting
+		if n >= int(s.BatchSize) {
+			if ctx.Err() != nil {
+				return
+			}
+			continue
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(s.Interval):
+		}
+	}
+}
+
+// send posts a batch of due deliveries concurrently and returns number of deliveries in batch
+func (s *Sender) send(ctx context.Context) int {
+	now := time.Now().UTC()
+	ds, err := s.outboxStore.Due(now.Unix(), s.BatchSize)
+	if err != nil {
+		s.log.Error("error", err, "msg", "couldn't list due webhook deliveries")
+		return 0
+	}
+	// a claimed delivery isn't retried by other senders until request has timed out
+	until := now.Add(s.client.Timeout + time.Minute).Unix()
+	var wg sync.WaitGroup
+	for i := range ds {
+		d := &ds[i]
+		ok, err := s.outboxStore.Claim(d, until)
+		if err != nil {
+			s.log.Error("error", err, "msg", "couldn't claim webhook delivery", "id", d.ID)
+			continue
+		}
+		if !ok {
+			continue
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.deliver(ctx, d)
+		}()
+	}
+	wg.Wait()
+	return len(ds)
+}
+
+// deliver posts d to its webhook, records attempt and schedules next attempt if it failed
+func (s *Sender) deliver(ctx context.Context, d *webhook.Delivery) {
+	log := s.log.(logger.WithLogger).With("delivery", d.ID, "webhook", d.WebhookID)
+	ws, err := s.webhookStore.List(&webhook.Criteria{ID: d.WebhookID})
+	if err != nil {
+		log.Error("error", err, "msg", "couldn't get webhook of delivery")
+		return
+	}
+	d.Attempts++
+	a := webhook.Attempt{
+		DeliveryID:  d.ID,
+		WebhookID:   d.WebhookID,
+		Username:    d.Username,
+		Event:       d.Event,
+		Number:      d.Attempts,
+		AttemptedAt: time.Now().UTC().Unix(),
+	}
+	if len(ws) == 0 {
+		a.Error = webhook.ErrNotFound.Error()
+		d.Status = webhook.DeliveryFailed
+	} else {
+		a.URL = ws[0].URL
+		start := time.Now()
+		a.ResponseCode, err = s.post(ctx, &ws[0], d)
+		a.Duration = int64(time.Since(start) / time.Millisecond)
+		if err != nil {
+			a.Error = truncate(err.Error(), maxErrorLen)
+		}
+		switch {
+		case a.ResponseCode >= 200 && a.ResponseCode < 300:
+			d.Status = webhook.DeliveryDelivered
+		case d.Attempts >= s.MaxAttempts:
+			d.Status = webhook.DeliveryFailed
+		default:
+			d.NextAttemptAt = time.Now().Add(s.backoff(d.Attempts)).UTC().Unix()
+		}
+	}
+	if d.Status == webhook.DeliveryFailed {
+		log.Info("msg", "webhook delivery failed", "attempts", d.Attempts, "error", a.Error, "code", a.ResponseCode)
+	}
+	if err := s.outboxStore.Update(d, &a); err != nil {
+		log.Error("error", err, "msg", "couldn't save webhook delivery attempt")
+	}
+}
+
+// post sends payload of d to w and returns response code
+func (s *Sender) post(ctx context.Context, w *webhook.Webhook, d *webhook.Delivery) (int, error) {
+	body := []byte(d.Payload)
+	req, err := http.NewRequest("POST", w.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req = req.WithContext(ctx)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(w.Secret, body))
+	req.Header.Set(EventHeader, string(d.Event))
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(d.ID, 10))
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	// body is read so connection can be reused
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 1<<16))
+	return resp.StatusCode, nil
+}
+
+// newClient returns an http client which only connects to public addresses. Address is checked when connection is
+// dialed, after host has been resolved, so a host can't resolve to a public address when it's validated and to a
+// private one when request is made. Proxies from environment aren't used, address of proxy would be checked instead.
+func newClient() *http.Client {
+	dialer := &net.Dialer{Timeout: DefaultTimeout, Control: publicOnly}
+	return &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: DefaultTimeout,
+			MaxIdleConnsPerHost: 2,
+		},
+	}
+}
+
+// publicOnly is a net.Dialer Control func which returns ErrForbiddenAddress if address isn't public
+func publicOnly(network, address string, c syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsPrivate() ||
+		ip.IsUnspecified() || ip.IsMulticast() {
+		return errors.Wrapf(ErrForbiddenAddress, "couldn't connect to %s", address)
+	}
+	return nil
+}
+
+// backoff returns delay after attempt number n, doubling from Backoff up to MaxBackoff
+func (s *Sender) backoff(n int) time.Duration {
+	b := s.Backoff
+	for i := 1; i < n && b < s.MaxBackoff; i++ {
+		b *= 2
+	}
+	if b > s.MaxBackoff {
+		b = s.MaxBackoff
+	}
+	return b
+}
+
+func truncate(s string, n int) string {
+	if len(s) > n {
+		return s[:n]
+	}
+	return s
+}
@@ -0,0 +1,185 @@
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/haisum/smpp-app/pkg/entities/webhook"
+	"github.com/haisum/smpp-app/pkg/logger"
+	"gopkg.in/stretchr/testify.v1/assert"
+)
+
+type memWebhookStore struct {
+	webhook.Store
+	webhooks []webhook.Webhook
+}
+
+func (s *memWebhookStore) List(c *webhook.Criteria) ([]webhook.Webhook, error) {
+	var ws []webhook.Webhook
+	for _, w := range s.webhooks {
+		if c.ID == 0 || w.ID == c.ID {
+			ws = append(ws, w)
+		}
+	}
+	return ws, nil
+}
+
+type memOutboxStore struct {
+	webhook.OutboxStore
+	deliveries []webhook.Delivery
+	attempts   []webhook.Attempt
+}
+
+func (s *memOutboxStore) Add(ds []webhook.Delivery) error {
+	for _, d := range ds {
+		d.ID = int64(len(s.deliveries) + 1)
+		s.deliveries = append(s.deliveries, d)
+	}
+	return nil
+}
+
+func (s *memOutboxStore) Due(now int64, limit uint) ([]webhook.Delivery, error) {
+	var ds []webhook.Delivery
+	for _, d := range s.deliveries {
+		if d.Status == webhook.DeliveryPending && d.NextAttemptAt <= now {
+			ds = append(ds, d)
+		}
+	}
+	return ds, nil
+}
+
+func (s *memOutboxStore) Claim(d *webhook.Delivery, until int64) (bool, error) {
+	if s.deliveries[d.ID-1].NextAttemptAt != d.NextAttemptAt {
+		return false, nil
+	}
+	s.deliveries[d.ID-1].NextAttemptAt = until
+	d.NextAttemptAt = until
+	return true, nil
+}
+
+func (s *memOutboxStore) Update(d *webhook.Delivery, a *webhook.Attempt) error {
+	s.deliveries[d.ID-1] = *d
+	s.attempts = append(s.attempts, *a)
+	return nil
+}
+
+func TestNotifier_Notify(t *testing.T) {
+	assert := assert.New(t)
+	webhooks := &memWebhookStore{webhooks: []webhook.Webhook{
+		{ID: 1, Username: "alice", Events: []string{"sent", "delivered"}},
+		{ID: 2, Username: "alice", Events: []string{"delivered"}},
+		{ID: 3, Username: "bob", Events: []string{"sent"}},
+	}}
+	outbox := &memOutboxStore{}
+	n := NewNotifier(webhooks, outbox, logger.Get())
+	n.Notify("alice", webhook.Payload{Event: webhook.EventSent, MessageID: 9, RespID: "r9"})
+	n.Notify("alice", webhook.Payload{Event: webhook.EventError, MessageID: 10})
+	if assert.Len(outbox.deliveries, 1) {
+		d := outbox.deliveries[0]
+		assert.Equal(int64(1), d.WebhookID)
+		assert.Equal(webhook.DeliveryPending, d.Status)
+		var p webhook.Payload
+		assert.Nil(json.Unmarshal([]byte(d.Payload), &p))
+		assert.Equal(int64(9), p.MessageID)
+		assert.Equal("r9", p.RespID)
+	}
+	n.Notify("alice", webhook.Payload{Event: webhook.EventDelivered, MessageID: 9})
+	assert.Len(outbox.deliveries, 3)
+}
+
+func TestSender_Deliver(t *testing.T) {
+	assert := assert.New(t)
+	codes := []int{http.StatusInternalServerError, http.StatusOK}
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		assert.Equal(Sign("0123456789abcdef", body), r.Header.Get(SignatureHeader))
+		assert.Equal("sent", r.Header.Get(EventHeader))
+		assert.Equal("1", r.Header.Get(DeliveryHeader))
+		w.WriteHeader(codes[0])
+		codes = codes[1:]
+	}))
+	defer srv.Close()
+	webhooks := &memWebhookStore{webhooks: []webhook.Webhook{
+		{ID: 1, Username: "alice", URL: srv.URL, Secret: "0123456789abcdef", Events: []string{"sent"}},
+	}}
+	outbox := &memOutboxStore{}
+	NewNotifier(webhooks, outbox, logger.Get()).Notify("alice", webhook.Payload{Event: webhook.EventSent, MessageID: 9})
+	s := NewSender(webhooks, outbox, logger.Get())
+	// test server listens on loopback, which default client refuses to connect to
+	s.client = &http.Client{Timeout: DefaultTimeout}
+
+	// failed attempt is retried after back off
+	assert.Equal(1, s.send(context.Background()))
+	d := outbox.deliveries[0]
+	assert.Equal(webhook.DeliveryPending, d.Status)
+	assert.Equal(1, d.Attempts)
+	assert.InDelta(time.Now().Add(s.Backoff).Unix(), d.NextAttemptAt, 2)
+	assert.Equal(0, s.send(context.Background()))
+
+	outbox.deliveries[0].NextAttemptAt = 0
+	assert.Equal(1, s.send(context.Background()))
+	assert.Equal(webhook.DeliveryDelivered, outbox.deliveries[0].Status)
+	if assert.Len(outbox.attempts, 2) {
+		assert.Equal(http.StatusInternalServerError, outbox.attempts[0].ResponseCode)
+		assert.Equal(1, outbox.attempts[0].Number)
+		assert.Equal(http.StatusOK, outbox.attempts[1].ResponseCode)
+		assert.Equal(srv.URL, outbox.attempts[1].URL)
+	}
+	assert.Equal(bodies[0], bodies[1])
+}
+
+func TestSender_DeliverPrivate(t *testing.T) {
+	assert := assert.New(t)
+	called := false
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	}))
+	defer srv.Close()
+	webhooks := &memWebhookStore{webhooks: []webhook.Webhook{
+		{ID: 1, Username: "alice", URL: srv.URL, Secret: "0123456789abcdef", Events: []string{"sent"}},
+	}}
+	outbox := &memOutboxStore{}
+	NewNotifier(webhooks, outbox, logger.Get()).Notify("alice", webhook.Payload{Event: webhook.EventSent, MessageID: 9})
+	s := NewSender(webhooks, outbox, logger.Get())
+	assert.Equal(1, s.send(context.Background()))
+	assert.False(called)
+	if assert.Len(outbox.attempts, 1) {
+		assert.Equal(0, outbox.attempts[0].ResponseCode)
+		assert.Contains(outbox.attempts[0].Error, ErrForbiddenAddress.Error())
+	}
+
+	for addr, public := range map[string]bool{
+		"93.184.216.34:443":  true,
+		"[2606:2800::1]:80":  true,
+		"127.0.0.1:80":       false,
+		"[::1]:80":           false,
+		"10.1.2.3:80":        false,
+		"172.16.0.1:80":      false,
+		"192.168.1.1:80":     false,
+		"169.254.169.254:80": false,
+		"[fe80::1]:80":       false,
+		"[fd00::1]:80":       false,
+		"0.0.0.0:80":         false,
+	} {
+		assert.Equal(public, publicOnly("tcp", addr, nil) == nil, addr)
+	}
+}
+
+func TestSender_Backoff(t *testing.T) {
+	assert := assert.New(t)
+	s := NewSender(nil, nil, logger.Get())
+	s.Backoff = time.Second
+	s.MaxBackoff = 5 * time.Second
+	assert.Equal(time.Second, s.backoff(1))
+	assert.Equal(2*time.Second, s.backoff(2))
+	assert.Equal(4*time.Second, s.backoff(3))
+	assert.Equal(5*time.Second, s.backoff(4))
+	assert.Equal(5*time.Second, s.backoff(20))
+}
@@ -6,6 +6,7 @@ CREATE TABLE IF NOT EXISTS `user` (
   `Name` varchar(100) NOT NULL,
   `Email` varchar(100) NOT NULL,
   `ConnectionGroup` varchar(100) NOT NULL,
+  `TimeZone` varchar(50) NOT NULL DEFAULT '',
   `RegisteredAt` bigint(20) NOT NULL DEFAULT '0',
   `Permissions` varchar(255) NOT NULL,
   PRIMARY KEY (`ID`),
@@ -14,6 +15,25 @@ CREATE TABLE IF NOT EXISTS `user` (
 ) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8;
 
 
+-- Numbers of users are kept in usernumber, one row per number without leading +. To upgrade a database which keeps
+-- them comma separated in user.Numbers, copy them in usernumber and drop the column. A number listed for more than one
+-- user fails the primary key and has to be given to one of them first.
+--   INSERT INTO `usernumber` (`Number`, `Username`)
+--     WITH RECURSIVE n (`Username`, `Number`, `Rest`) AS (
+--       SELECT `Username`, CAST('' AS CHAR(20)), CONCAT(`Numbers`, ',') FROM `user` WHERE `Numbers` != ''
+--       UNION ALL
+--       SELECT `Username`, TRIM(LEADING '+' FROM TRIM(SUBSTRING_INDEX(`Rest`, ',', 1))), SUBSTRING(`Rest`, LOCATE(',', `Rest`) + 1)
+--       FROM n WHERE `Rest` != '')
+--     SELECT DISTINCT `Number`, `Username` FROM n WHERE `Number` != '';
+--   ALTER TABLE `user` DROP COLUMN `Numbers`;
+CREATE TABLE IF NOT EXISTS `usernumber` (
+  `Number` varchar(20) NOT NULL,
+  `Username` varchar(100) NOT NULL,
+  PRIMARY KEY (`Number`),
+  KEY `Username` (`Username`),
+  CONSTRAINT `usernumber_username` FOREIGN KEY (`Username`) REFERENCES `user` (`Username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE IF NOT EXISTS `numfile` (
   `ID` int(11) NOT NULL AUTO_INCREMENT,
   `Name` varchar(200) NOT NULL,
@@ -34,6 +54,7 @@ CREATE TABLE IF NOT EXISTS `campaign` (
   `ID` int(11) NOT NULL AUTO_INCREMENT,
   `SendAfter` varchar(50) NOT NULL DEFAULT '',
   `SendBefore` varchar(50) NOT NULL DEFAULT '',
+  `TimeZone` varchar(50) NOT NULL DEFAULT '',
   `Dst` varchar(50) NOT NULL DEFAULT '',
   `Priority` int(11) NOT NULL DEFAULT '1',
   `ScheduledAt` bigint(20) NOT NULL DEFAULT '0',
@@ -43,6 +64,7 @@ CREATE TABLE IF NOT EXISTS `campaign` (
   `Src` varchar(50) NOT NULL,
   `Username` varchar(100) NOT NULL,
   `NumFileID` int(11) NOT NULL,
+  `TemplateID` int(11) NOT NULL DEFAULT '0',
   PRIMARY KEY (`ID`),
   KEY `SubmittedAt` (`SubmittedAt`),
   KEY `Src` (`Src`),
@@ -58,6 +80,7 @@ CREATE TABLE IF NOT EXISTS `message` (
   `SendAfter` varchar(50) NOT NULL DEFAULT '',
   `SendBefore` varchar(50) NOT NULL DEFAULT '',
   `Dst` varchar(50) NOT NULL DEFAULT '',
+  `OriginalDst` varchar(50) NOT NULL DEFAULT '',
   `RespID` varchar(50) NOT NULL DEFAULT '',
   `Priority` int(11) NOT NULL DEFAULT '1',
   `ScheduledAt` bigint(20) NOT NULL DEFAULT '0',
@@ -78,6 +101,9 @@ CREATE TABLE IF NOT EXISTS `message` (
   `Campaign` varchar(50) NOT NULL DEFAULT '',
   `DeliverySM` json DEFAULT NULL,
   `Total` int(11) NOT NULL DEFAULT '1',
+  `Retries` int(11) NOT NULL DEFAULT '0',
+  `TimeZone` varchar(50) NOT NULL DEFAULT '',
+  `HeldUntil` bigint(20) NOT NULL DEFAULT '0',
   PRIMARY KEY (`ID`),
   KEY `Dst` (`Dst`),
   KEY `RespID` (`RespID`),
@@ -86,20 +112,180 @@ CREATE TABLE IF NOT EXISTS `message` (
   KEY `Connection` (`Connection`),
   KEY `Username` (`Username`),
   KEY `Message_CampaignID` (`CampaignID`),
+  KEY `Status_ScheduledAt` (`Status`, `ScheduledAt`),
   CONSTRAINT `Message_CampaignID` FOREIGN KEY (`CampaignID`) REFERENCES `campaign` (`ID`),
   CONSTRAINT `Message_Username` FOREIGN KEY (`Username`) REFERENCES `user` (`Username`)
 ) ENGINE=InnoDB DEFAULT CHARSET=utf8;
 
+CREATE TABLE IF NOT EXISTS `campaignjob` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `CampaignID` int(11) NOT NULL,
+  `Status` varchar(20) NOT NULL DEFAULT 'Pending',
+  `Checkpoint` int(11) NOT NULL DEFAULT '0',
+  `Total` int(11) NOT NULL DEFAULT '0',
+  `Segments` bigint(20) NOT NULL DEFAULT '0',
+  `Paused` tinyint(4) NOT NULL DEFAULT '0',
+  `Params` json NOT NULL,
+  `Error` text NOT NULL,
+  `Version` int(11) NOT NULL DEFAULT '0',
+  `UpdatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  UNIQUE KEY `CampaignID` (`CampaignID`),
+  KEY `Status_UpdatedAt` (`Status`,`UpdatedAt`),
+  CONSTRAINT `campaignjob_campaignid` FOREIGN KEY (`CampaignID`) REFERENCES `campaign` (`ID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `template` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `Name` varchar(200) NOT NULL,
+  `Description` text NOT NULL,
+  `Msg` text NOT NULL,
+  `Username` varchar(100) NOT NULL,
+  `CreatedAt` bigint(20) NOT NULL DEFAULT '0',
+  `UpdatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  KEY `Username` (`Username`),
+  CONSTRAINT `template_username` FOREIGN KEY (`Username`) REFERENCES `user` (`Username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `inbound` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `Src` varchar(50) NOT NULL,
+  `Dst` varchar(50) NOT NULL,
+  `Msg` text NOT NULL,
+  `Enc` varchar(10) NOT NULL,
+  `Connection` varchar(100) NOT NULL DEFAULT '',
+  `Username` varchar(100) NOT NULL DEFAULT '',
+  `ReceivedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  KEY `Username_ReceivedAt` (`Username`,`ReceivedAt`),
+  KEY `Dst` (`Dst`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `optout` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `Number` varchar(20) NOT NULL,
+  `Username` varchar(100) NOT NULL DEFAULT '',
+  `Reason` varchar(255) NOT NULL DEFAULT '',
+  `AddedBy` varchar(100) NOT NULL,
+  `CreatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  UNIQUE KEY `Username_Number` (`Username`,`Number`),
+  KEY `Number` (`Number`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `webhook` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `Username` varchar(100) NOT NULL,
+  `URL` varchar(2048) NOT NULL,
+  `Secret` varchar(255) NOT NULL,
+  `Events` varchar(255) NOT NULL,
+  `CreatedAt` bigint(20) NOT NULL DEFAULT '0',
+  `UpdatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  KEY `Username` (`Username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `webhookdelivery` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `WebhookID` int(11) NOT NULL,
+  `Username` varchar(100) NOT NULL,
+  `Event` varchar(20) NOT NULL,
+  `Payload` text NOT NULL,
+  `Status` varchar(20) NOT NULL DEFAULT 'Pending',
+  `Attempts` int(11) NOT NULL DEFAULT '0',
+  `NextAttemptAt` bigint(20) NOT NULL DEFAULT '0',
+  `CreatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  KEY `Status_NextAttemptAt` (`Status`,`NextAttemptAt`),
+  KEY `WebhookID` (`WebhookID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `webhookattempt` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `DeliveryID` int(11) NOT NULL,
+  `WebhookID` int(11) NOT NULL,
+  `Username` varchar(100) NOT NULL,
+  `Event` varchar(20) NOT NULL,
+  `URL` varchar(2048) NOT NULL,
+  `Number` int(11) NOT NULL DEFAULT '0',
+  `ResponseCode` int(11) NOT NULL DEFAULT '0',
+  `Error` varchar(255) NOT NULL DEFAULT '',
+  `Duration` bigint(20) NOT NULL DEFAULT '0',
+  `AttemptedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  KEY `Username_AttemptedAt` (`Username`,`AttemptedAt`),
+  KEY `DeliveryID` (`DeliveryID`),
+  KEY `WebhookID` (`WebhookID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+-- Messages are charged from balance in credit, a user without a row in it can't send. To upgrade a database of an
+-- earlier version, give existing users an opening balance so they can keep sending:
+--   INSERT INTO `credit` (`Username`, `Balance`) SELECT `Username`, 1000000 FROM `user`;
+--   INSERT INTO `ledger` (`Username`, `Kind`, `Amount`, `Balance`, `Note`, `AddedBy`, `CreatedAt`)
+--     SELECT `Username`, 'Top up', 1000000, 1000000, 'Opening balance', 'admin', UNIX_TIMESTAMP() FROM `user`;
+CREATE TABLE IF NOT EXISTS `credit` (
+  `Username` varchar(100) NOT NULL,
+  `Balance` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`Username`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `ledger` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `Username` varchar(100) NOT NULL,
+  `Kind` varchar(20) NOT NULL,
+  `Amount` bigint(20) NOT NULL,
+  `Balance` bigint(20) NOT NULL,
+  `MessageID` int(11) NOT NULL DEFAULT '0',
+  `CampaignID` int(11) NOT NULL DEFAULT '0',
+  `Note` varchar(255) NOT NULL DEFAULT '',
+  `AddedBy` varchar(100) NOT NULL DEFAULT '',
+  `CreatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  KEY `Username_ID` (`Username`,`ID`),
+  KEY `CampaignID` (`CampaignID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `sender` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `Username` varchar(100) NOT NULL,
+  `Src` varchar(20) NOT NULL,
+  `Status` varchar(20) NOT NULL DEFAULT 'Pending',
+  `Note` varchar(255) NOT NULL DEFAULT '',
+  `ReviewedBy` varchar(100) NOT NULL DEFAULT '',
+  `ReviewNote` varchar(255) NOT NULL DEFAULT '',
+  `CreatedAt` bigint(20) NOT NULL DEFAULT '0',
+  `UpdatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  UNIQUE KEY `Username_Src` (`Username`,`Src`),
+  KEY `Status` (`Status`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
+CREATE TABLE IF NOT EXISTS `senderaudit` (
+  `ID` int(11) NOT NULL AUTO_INCREMENT,
+  `SenderID` int(11) NOT NULL,
+  `Username` varchar(100) NOT NULL,
+  `Src` varchar(20) NOT NULL,
+  `Action` varchar(20) NOT NULL,
+  `ChangedBy` varchar(100) NOT NULL,
+  `Note` varchar(255) NOT NULL DEFAULT '',
+  `CreatedAt` bigint(20) NOT NULL DEFAULT '0',
+  PRIMARY KEY (`ID`),
+  KEY `SenderID` (`SenderID`),
+  KEY `Username_ID` (`Username`,`ID`)
+) ENGINE=InnoDB DEFAULT CHARSET=utf8;
+
 CREATE TABLE IF NOT EXISTS `settings` (
   `ID` int(11) NOT NULL AUTO_INCREMENT,
   `Name` varchar(50) NOT NULL,
   `Value` json NOT NULL,
   PRIMARY KEY (`ID`),
   UNIQUE KEY `Name` (`Name`)
-) ENGINE=InnoDB AUTO_INCREMENT=2 DEFAULT CHARSET=utf8;
+) ENGINE=InnoDB AUTO_INCREMENT=3 DEFAULT CHARSET=utf8;
 
 INSERT INTO `settings` (`ID`, `Name`, `Value`) VALUES
-  (1, 'config', '{"ConnGroups": [{"Name": "Default", "Conns": [{"ID": "du-1", "URL": "192.168.0.105:2775", "Pfxs": ["+97105", "+97106"], "Size": 5, "Time": 1, "User": "smppclient1", "Fields": {"ESMClass": 0, "ProtocolID": 0, "DestAddrNPI": 0, "DestAddrTON": 0, "ServiceType": "", "PriorityFlag": 0, "SourceAddrNPI": 0, "SourceAddrTON": 0, "SMDefaultMsgID": 0, "ReplaceIfPresentFlag": 0, "ScheduleDeliveryTime": ""}, "Passwd": "password", "Receiver": ""}, {"ID": "du-2", "URL": "192.168.0.105:2775", "Pfxs": ["+97107", "+97108"], "Size": 5, "Time": 1, "User": "smppclient2", "Passwd": "password", "Receiver": ""}], "DefaultPfx": "+97105"}, {"Name": "AADC", "Conns": [{"ID": "du-2", "URL": "192.168.0.105:2775", "Pfxs": ["+97107", "+97108"], "Size": 5, "Time": 1, "User": "smppclient2", "Passwd": "password", "Receiver": ""}], "DefaultPfx": "+97105"}]}');
+  (1, 'config', '{"ConnGroups": [{"Name": "Default", "Conns": [{"ID": "du-1", "URL": "192.168.0.105:2775", "Pfxs": ["+97105", "+97106"], "Size": 5, "Time": 1, "User": "smppclient1", "Fields": {"ESMClass": 0, "ProtocolID": 0, "DestAddrNPI": 0, "DestAddrTON": 0, "ServiceType": "", "PriorityFlag": 0, "SourceAddrNPI": 0, "SourceAddrTON": 0, "SMDefaultMsgID": 0, "ReplaceIfPresentFlag": 0, "ScheduleDeliveryTime": ""}, "Passwd": "password", "Receiver": ""}, {"ID": "du-2", "URL": "192.168.0.105:2775", "Pfxs": ["+97107", "+97108"], "Size": 5, "Time": 1, "User": "smppclient2", "Passwd": "password", "Receiver": ""}], "DefaultPfx": "+97105", "CountryCode": "971"}, {"Name": "AADC", "Conns": [{"ID": "du-2", "URL": "192.168.0.105:2775", "Pfxs": ["+97107", "+97108"], "Size": 5, "Time": 1, "User": "smppclient2", "Passwd": "password", "Receiver": ""}], "DefaultPfx": "+97107", "CountryCode": "971"}]}'),
+  (2, 'throttle', '{"Conns": [], "UpdatedAt": 0}');
 
 CREATE TABLE IF NOT EXISTS `token` (
   `ID` int(11) NOT NULL AUTO_INCREMENT,
@@ -115,4 +301,10 @@ CREATE TABLE IF NOT EXISTS `token` (
 
 
 INSERT INTO `user` (`ID`, `Username`, `Password`, `Name`, `Email`, `ConnectionGroup`, `RegisteredAt`, `Permissions`) VALUES
-  (1, 'admin', '$2a$10$2dgWOU4i12GnSyKl2JfpT.IYWNSaE0vXp2IJvtTLRFUjrs4qQXJre', 'Admin', 'admin@localhost', 'Default', 0, '["Add users", "Edit users", "List users", "Show config", "Edit config", "Send message", "Start a campaign", "List messages", "List number files", "Delete a number file", "List campaigns", "Stop campaign", "Retry campaign", "Get status of services", "Mask Messages"]');
\ No newline at end of file
+  (1, 'admin', '$2a$10$2dgWOU4i12GnSyKl2JfpT.IYWNSaE0vXp2IJvtTLRFUjrs4qQXJre', 'Admin', 'admin@localhost', 'Default', 0, '["Add users", "Edit users", "List users", "Show config", "Edit config", "Send message", "Start a campaign", "List messages", "List number files", "Delete a number file", "List campaigns", "Stop campaign", "Retry campaign", "Get status of services", "Mask Messages", "List templates", "Edit templates", "Edit opt-outs", "List inbound messages", "Edit webhooks", "Add credit", "Approve sender IDs", "Manage campaigns"]');
+
+INSERT INTO `credit` (`Username`, `Balance`) VALUES
+  ('admin', 1000000);
+
+INSERT INTO `ledger` (`Username`, `Kind`, `Amount`, `Balance`, `Note`, `AddedBy`, `CreatedAt`) VALUES
+  ('admin', 'Top up', 1000000, 1000000, 'Opening balance', 'admin', 0);